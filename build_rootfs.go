@@ -0,0 +1,114 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/anubhavg-icpl/agni/internal/gui"
+	"github.com/anubhavg-icpl/agni/internal/image"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	flags "github.com/jessevdk/go-flags"
+	log "github.com/sirupsen/logrus"
+)
+
+// buildRootfsCommand is the subcommand building root filesystems from container images
+const buildRootfsCommand = "build-rootfs"
+
+type buildRootfsOptions struct {
+	Source       string   `long:"source" required:"true" description:"docker save or OCI layout tarball"`
+	Reference    string   `long:"reference" description:"Image in the tarball, by tag or OCI ref name (default: the first)"`
+	Output       string   `long:"output" short:"o" required:"true" description:"ext4 image to create"`
+	SizeMiB      int64    `long:"size" description:"Filesystem size in MiB (default: the contents plus headroom)"`
+	Init         bool     `long:"init" description:"Install /sbin/agni-init, which runs the image's entrypoint; boot with init=/sbin/agni-init"`
+	InitCommands []string `long:"init-command" description:"Shell command agni-init runs before the entrypoint, can be specified multiple times"`
+	Register     string   `long:"register" description:"Register the image under this name with the GUI's image library; the GUI must not be running"`
+	DataDir      string   `long:"data-dir" description:"GUI data directory (default: ~/.local/share/agni)"`
+}
+
+// runBuildRootfs builds a root filesystem image from the command line
+func runBuildRootfs(args []string) {
+	opts := &buildRootfsOptions{}
+	p := flags.NewParser(opts, flags.Default)
+	p.Usage = buildRootfsCommand + " [OPTIONS]"
+	if _, err := p.ParseArgs(args); err != nil {
+		if val, ok := err.(*flags.Error); ok && val.Type == flags.ErrHelp {
+			os.Exit(0)
+		}
+		os.Exit(1)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := buildRootfs(ctx, opts); err != nil {
+		log.Fatalf("Error: %s", err)
+	}
+}
+
+// buildRootfs builds and optionally registers a root filesystem image
+func buildRootfs(ctx context.Context, opts *buildRootfsOptions) error {
+	output, err := filepath.Abs(opts.Output)
+	if err != nil {
+		return err
+	}
+
+	result, err := image.BuildRootfs(ctx, image.BuildOptions{
+		Source:       opts.Source,
+		Reference:    opts.Reference,
+		Output:       output,
+		SizeMiB:      opts.SizeMiB,
+		Init:         opts.Init,
+		InitCommands: opts.InitCommands,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Built %s (%d MiB)\n", result.Path, result.SizeMiB)
+
+	if opts.Register == "" {
+		return nil
+	}
+
+	dataDir := opts.DataDir
+	if dataDir == "" {
+		dataDir = gui.GetDataDir()
+	}
+	store, err := storage.NewStore(filepath.Join(dataDir, "agni.db"))
+	if err != nil {
+		return fmt.Errorf("failed to open the image library, is the GUI running? %w", err)
+	}
+	defer store.Close()
+
+	labels := map[string]string{"source": filepath.Base(opts.Source)}
+	if opts.Init {
+		labels["init"] = image.InitPath
+	}
+	img, err := image.NewRegistry(store).Register(models.RegisterImageRequest{
+		Name:   opts.Register,
+		Type:   models.ImageTypeRootfs,
+		Arch:   result.Arch,
+		Path:   result.Path,
+		Labels: labels,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Registered image %s (sha256 %s)\n", img.ID, img.SHA256)
+	return nil
+}
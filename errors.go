@@ -23,6 +23,9 @@ var (
 	errInvalidDriveSpecificationNoSuffix = errors.New("invalid drive specification. Must have :rw or :ro suffix")
 	errInvalidDriveSpecificationNoPath   = errors.New("invalid drive specification. Must have path")
 
+	// error parsing rate limiters
+	errInvalidRateLimiter = errors.New("invalid rate limiter. Must be of the form KEY=SIZE:REFILL_MS[:BURST]")
+
 	// error parsing vsock
 	errUnableToParseVsockDevices = errors.New("unable to parse vsock devices")
 	errUnableToParseVsockCID     = errors.New("unable to parse vsock CID as a number")
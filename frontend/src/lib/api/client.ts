@@ -4,6 +4,15 @@ interface ApiError {
 	error: string;
 }
 
+function listQuery(params: object): string {
+	const query = new URLSearchParams();
+	for (const [key, value] of Object.entries(params)) {
+		if (value !== undefined && value !== '') query.set(key, String(value));
+	}
+	const encoded = query.toString();
+	return encoded ? `?${encoded}` : '';
+}
+
 class ApiClient {
 	private token: string | null = null;
 
@@ -76,9 +85,34 @@ class ApiClient {
 		return this.request('GET', '/auth/me');
 	}
 
+	async changePassword(currentPassword: string, newPassword: string): Promise<void> {
+		await this.request('POST', '/auth/password', {
+			current_password: currentPassword,
+			new_password: newPassword
+		});
+	}
+
 	// VMs
-	async listVMs(): Promise<VM[]> {
-		return this.request('GET', '/vms');
+	// Lifecycle events of the caller's VMs. EventSource reconnects on its own
+	// and resumes after the last event it received. Returns a function that
+	// closes the stream.
+	subscribeEvents(onEvent: (event: VMEvent) => void): () => void {
+		const token = encodeURIComponent(this.getToken() ?? '');
+		const source = new EventSource(`${API_BASE}/events?token=${token}`);
+		for (const type of VM_EVENT_TYPES) {
+			source.addEventListener(type, (e) => onEvent(JSON.parse((e as MessageEvent).data)));
+		}
+		return () => source.close();
+	}
+
+	async listVMs(params: VMListParams = {}): Promise<Paginated<VM>> {
+		return this.request('GET', `/vms${listQuery(params)}`);
+	}
+
+	// Number of the caller's VMs, optionally only those with the given status
+	async countVMs(status?: VM['status']): Promise<number> {
+		const result = await this.listVMs({ status, page_size: 1 });
+		return result.total;
 	}
 
 	async getVM(id: string): Promise<VM> {
@@ -101,8 +135,24 @@ class ApiClient {
 		return this.request('POST', `/vms/${id}/stop`);
 	}
 
-	async shutdownVM(id: string): Promise<VMActionResponse> {
-		return this.request('POST', `/vms/${id}/shutdown`);
+	async shutdownVM(id: string, timeoutSeconds?: number): Promise<ShutdownVMResponse> {
+		return this.request('POST', `/vms/${id}/shutdown`, timeoutSeconds ? { timeout_seconds: timeoutSeconds } : undefined);
+	}
+
+	async cloneVM(id: string, data: CloneVMRequest = {}): Promise<VM[]> {
+		return this.request('POST', `/vms/${id}/clone`, data);
+	}
+
+	async bulkVMAction(action: BulkVMAction, data: BulkVMRequest): Promise<BulkVMResponse> {
+		return this.request('POST', `/vms:${action}`, data);
+	}
+
+	async pauseVM(id: string): Promise<VMActionResponse> {
+		return this.request('POST', `/vms/${id}/pause`);
+	}
+
+	async resumeVM(id: string): Promise<VMActionResponse> {
+		return this.request('POST', `/vms/${id}/resume`);
 	}
 
 	async getVMMetrics(id: string): Promise<VMMetrics> {
@@ -110,8 +160,8 @@ class ApiClient {
 	}
 
 	// Configs
-	async listConfigs(): Promise<ConfigTemplate[]> {
-		return this.request('GET', '/configs');
+	async listConfigs(params: ListParams = {}): Promise<Paginated<ConfigTemplate>> {
+		return this.request('GET', `/configs${listQuery(params)}`);
 	}
 
 	async getConfig(id: string): Promise<ConfigTemplate> {
@@ -126,6 +176,74 @@ class ApiClient {
 		await this.request('DELETE', `/configs/${id}`);
 	}
 
+	// Images
+	async listImages(type?: ImageType): Promise<Image[]> {
+		return this.request('GET', type ? `/images?type=${type}` : '/images');
+	}
+
+	async registerImage(data: RegisterImageRequest): Promise<Image> {
+		return this.request('POST', '/images', data);
+	}
+
+	async deleteImage(id: string): Promise<void> {
+		await this.request('DELETE', `/images/${id}`);
+	}
+
+	async verifyImage(id: string): Promise<Image> {
+		return this.request('POST', `/images/${id}/verify`);
+	}
+
+	async buildImage(data: BuildRootfsRequest): Promise<Image> {
+		return this.request('POST', '/images/build', data);
+	}
+
+	// Users
+	async listUsers(params: ListParams = {}): Promise<Paginated<User>> {
+		return this.request('GET', `/users${listQuery(params)}`);
+	}
+
+	async createUser(data: CreateUserRequest): Promise<User> {
+		return this.request('POST', '/users', data);
+	}
+
+	async getQuota(userId: string): Promise<QuotaStatus> {
+		return this.request('GET', `/users/${userId}/quota`);
+	}
+
+	async updateQuota(userId: string, quota: UserQuota | null): Promise<User> {
+		return this.request('PUT', `/users/${userId}/quota`, quota);
+	}
+
+	// Webhooks (admin only)
+	async listWebhooks(): Promise<Webhook[]> {
+		return this.request('GET', '/webhooks');
+	}
+
+	async createWebhook(data: CreateWebhookRequest): Promise<Webhook> {
+		return this.request('POST', '/webhooks', data);
+	}
+
+	async updateWebhook(id: string, data: UpdateWebhookRequest): Promise<Webhook> {
+		return this.request('PUT', `/webhooks/${id}`, data);
+	}
+
+	async deleteWebhook(id: string): Promise<void> {
+		await this.request('DELETE', `/webhooks/${id}`);
+	}
+
+	async listDeliveries(id: string, limit?: number): Promise<WebhookDelivery[]> {
+		return this.request('GET', `/webhooks/${id}/deliveries${limit ? `?limit=${limit}` : ''}`);
+	}
+
+	async redeliver(id: string, deliveryId: string): Promise<WebhookDelivery> {
+		return this.request('POST', `/webhooks/${id}/deliveries/${deliveryId}/redeliver`);
+	}
+
+	// Audit log (admin only)
+	async listAudit(params: AuditParams = {}): Promise<AuditPage> {
+		return this.request('GET', `/audit${listQuery(params)}`);
+	}
+
 	// Health
 	async getHealth(): Promise<HealthStatus> {
 		return this.request('GET', '/health');
@@ -145,6 +263,32 @@ export interface User {
 	role: string;
 	created_at: string;
 	last_login_at?: string;
+	quota?: UserQuota;
+}
+
+export interface UserQuota {
+	max_vms?: number;
+	max_cpus?: number;
+	max_memory_mb?: number;
+	max_disk_mb?: number;
+}
+
+export interface QuotaStatus {
+	user_id: string;
+	quota?: UserQuota;
+	usage: {
+		vms: number;
+		cpus: number;
+		memory_mb: number;
+		disk_mb: number;
+	};
+}
+
+export interface CreateUserRequest {
+	username: string;
+	password: string;
+	role?: 'admin' | 'user';
+	quota?: UserQuota;
 }
 
 export interface LoginResponse {
@@ -156,13 +300,19 @@ export interface LoginResponse {
 export interface VM {
 	id: string;
 	name: string;
-	status: 'stopped' | 'starting' | 'running' | 'stopping' | 'error';
+	owner_id?: string;
+	labels?: Record<string, string>;
+	status: 'stopped' | 'starting' | 'running' | 'paused' | 'stopping' | 'error';
 	config: VMConfig;
 	metrics?: VMMetrics;
 	error?: string;
 	created_at: string;
 	started_at?: string;
 	stopped_at?: string;
+	exit_code?: number;
+	restart_count?: number;
+	autostart: boolean;
+	boot_order?: number;
 }
 
 export interface VMConfig {
@@ -181,6 +331,19 @@ export interface VMConfig {
 	metadata?: string;
 	log_level: string;
 	jailer?: JailerConfig;
+	balloon?: Balloon;
+	restart_policy?: RestartPolicy;
+	kernel_image_id?: string;
+	initrd_image_id?: string;
+	rootfs_image_id?: string;
+}
+
+export interface RestartPolicy {
+	policy: 'never' | 'on-failure' | 'always';
+	max_retries?: number;
+	window_seconds?: number;
+	initial_backoff_ms?: number;
+	max_backoff_ms?: number;
 }
 
 export interface JailerConfig {
@@ -196,11 +359,36 @@ export interface Drive {
 	path: string;
 	read_only: boolean;
 	part_uuid?: string;
+	rate_limiter?: RateLimiter;
 }
 
 export interface NIC {
 	device: string;
 	mac_address: string;
+	managed?: boolean;
+	cni?: CNIConfig;
+	ip_address?: string;
+	gateway?: string;
+	rx_rate_limiter?: RateLimiter;
+	tx_rate_limiter?: RateLimiter;
+}
+
+export interface CNIConfig {
+	network_name: string;
+	conf_dir?: string;
+	bin_path?: string[];
+	if_name?: string;
+}
+
+export interface RateLimiter {
+	bandwidth?: TokenBucket;
+	ops?: TokenBucket;
+}
+
+export interface TokenBucket {
+	size: number;
+	refill_time_ms: number;
+	one_time_burst?: number;
 }
 
 export interface Vsock {
@@ -208,6 +396,27 @@ export interface Vsock {
 	cid: number;
 }
 
+export interface Balloon {
+	amount_mib: number;
+	deflate_on_oom: boolean;
+	stats_polling_interval_s?: number;
+}
+
+export interface BalloonStats {
+	target_mib: number;
+	actual_mib: number;
+	target_pages: number;
+	actual_pages: number;
+	total_memory?: number;
+	free_memory?: number;
+	available_memory?: number;
+	disk_caches?: number;
+	swap_in?: number;
+	swap_out?: number;
+	major_faults?: number;
+	minor_faults?: number;
+}
+
 export interface VMMetrics {
 	cpu_usage: number;
 	memory_used: number;
@@ -216,6 +425,8 @@ export interface VMMetrics {
 	disk_write_bytes: number;
 	net_rx_bytes: number;
 	net_tx_bytes: number;
+	vcpu_exits: number;
+	device_events: number;
 	timestamp: string;
 }
 
@@ -225,15 +436,90 @@ export interface VMActionResponse {
 	vm_id: string;
 }
 
+export interface CloneVMRequest {
+	name?: string;
+	count?: number;
+	shared_drives?: string[];
+}
+
+export interface ShutdownVMResponse extends VMActionResponse {
+	method: 'graceful' | 'forced';
+	duration_ms: number;
+}
+
 export interface CreateVMRequest {
 	name: string;
 	config: VMConfig;
+	autostart?: boolean;
+	boot_order?: number;
+	labels?: Record<string, string>;
+}
+
+export type BulkVMAction = 'start' | 'stop' | 'shutdown' | 'delete';
+
+export interface BulkVMRequest {
+	selector: string;
+	concurrency?: number;
+	timeout_seconds?: number;
+}
+
+export interface BulkVMResponse {
+	matched: number;
+	succeeded: number;
+	failed: number;
+	results: {
+		vm_id: string;
+		name: string;
+		success: boolean;
+		error?: string;
+		method?: 'graceful' | 'forced';
+	}[];
+}
+
+export type ImageType = 'kernel' | 'initrd' | 'rootfs';
+
+export interface Image {
+	id: string;
+	name: string;
+	type: ImageType;
+	arch?: string;
+	path: string;
+	sha256: string;
+	size: number;
+	labels?: Record<string, string>;
+	description?: string;
+	created_at: string;
+	updated_at: string;
+}
+
+export interface RegisterImageRequest {
+	name: string;
+	type: ImageType;
+	arch?: string;
+	path: string;
+	sha256?: string;
+	labels?: Record<string, string>;
+	description?: string;
+}
+
+export interface BuildRootfsRequest {
+	name: string;
+	source: string;
+	reference?: string;
+	output?: string;
+	size_mib?: number;
+	init?: boolean;
+	init_commands?: string[];
+	labels?: Record<string, string>;
+	description?: string;
 }
 
 export interface ConfigTemplate {
 	id: string;
 	name: string;
 	description?: string;
+	owner_id?: string;
+	labels?: Record<string, string>;
 	config: VMConfig;
 	created_at: string;
 	updated_at: string;
@@ -242,6 +528,7 @@ export interface ConfigTemplate {
 export interface CreateConfigRequest {
 	name: string;
 	description?: string;
+	labels?: Record<string, string>;
 	config: VMConfig;
 }
 
@@ -261,4 +548,131 @@ export interface SystemInfo {
 	arch: string;
 	num_cpu: number;
 	total_memory: number;
+	resources?: HostResources;
+}
+
+export const VM_EVENT_TYPES = [
+	'created',
+	'starting',
+	'running',
+	'stopped',
+	'crashed',
+	'deleted',
+	'config-changed'
+] as const;
+
+export interface VMEvent {
+	sequence: number;
+	type: (typeof VM_EVENT_TYPES)[number];
+	vm_id: string;
+	vm_name: string;
+	owner_id?: string;
+	actor: string;
+	old_status?: VM['status'];
+	new_status?: VM['status'];
+	message?: string;
+	timestamp: string;
+}
+
+export interface Webhook {
+	id: string;
+	name: string;
+	url: string;
+	events?: VMEvent['type'][];
+	secret?: string; // Only returned on creation
+	enabled: boolean;
+	created_by?: string;
+	created_at: string;
+	updated_at: string;
+}
+
+export interface CreateWebhookRequest {
+	name: string;
+	url: string;
+	events?: VMEvent['type'][];
+	secret?: string;
+	enabled?: boolean;
+}
+
+export type UpdateWebhookRequest = Partial<CreateWebhookRequest>;
+
+export interface WebhookDelivery {
+	id: string;
+	webhook_id: string;
+	event: VMEvent;
+	status: 'pending' | 'succeeded' | 'failed';
+	attempts: number;
+	response_code?: number;
+	error?: string;
+	redelivery_of?: string;
+	next_attempt_at?: string;
+	created_at: string;
+	updated_at: string;
+}
+
+export interface AuditEntry {
+	sequence: number;
+	timestamp: string;
+	user_id?: string;
+	username?: string;
+	role?: User['role'];
+	action: string;
+	method?: string;
+	path?: string;
+	target_id?: string;
+	request_id?: string;
+	source_ip?: string;
+	result: 'success' | 'failure';
+	status?: number;
+	changes?: { field: string; old?: unknown; new?: unknown }[];
+}
+
+export interface AuditPage {
+	data: AuditEntry[];
+	next?: number;
+}
+
+export interface AuditParams {
+	since?: string;
+	until?: string;
+	user?: string;
+	action?: string;
+	before?: number;
+	page_size?: number;
+}
+
+export interface Paginated<T> {
+	data: T[];
+	total: number;
+	page: number;
+	page_size: number;
+	total_pages: number;
+}
+
+// Prefix a sort field with - to sort descending
+export interface ListParams {
+	page?: number;
+	page_size?: number;
+	sort?: string;
+	name?: string;
+}
+
+export interface VMListParams extends ListParams {
+	status?: VM['status'];
+	selector?: string;
+}
+
+export interface HostResources {
+	cpus: number;
+	memory_mb: number;
+	cpu_overcommit: number;
+	memory_overcommit: number;
+	reserved_memory_mb: number;
+	allocatable_cpus: number;
+	allocatable_memory_mb: number;
+	committed_cpus: number;
+	committed_memory_mb: number;
+	available_cpus: number;
+	available_memory_mb: number;
+	running_vms: number;
 }
@@ -1,37 +1,78 @@
 import { writable } from 'svelte/store';
 import { api, type VM } from '$lib/api/client';
 
+const PAGE_SIZE = 20;
+
+export interface VMCounts {
+	total: number;
+	running: number;
+	stopped: number;
+	error: number;
+}
+
+// Holds one page of VMs at a time, plus per-status counts across all of them
 interface VMState {
 	vms: VM[];
+	page: number;
+	totalPages: number;
+	total: number;
+	counts: VMCounts;
 	loading: boolean;
 	error: string | null;
 }
 
 function createVMStore() {
-	const { subscribe, set, update } = writable<VMState>({
+	const { subscribe, update } = writable<VMState>({
 		vms: [],
+		page: 1,
+		totalPages: 1,
+		total: 0,
+		counts: { total: 0, running: 0, stopped: 0, error: 0 },
 		loading: false,
 		error: null
 	});
+	let page = 1;
 
 	return {
 		subscribe,
 		async fetch() {
 			update((s) => ({ ...s, loading: true, error: null }));
 			try {
-				const vms = await api.listVMs();
-				set({ vms: vms || [], loading: false, error: null });
+				let result = await api.listVMs({ page, page_size: PAGE_SIZE });
+				if (page > 1 && page > result.total_pages) {
+					// The page emptied out underneath us, e.g. after a delete
+					page = Math.max(result.total_pages, 1);
+					result = await api.listVMs({ page, page_size: PAGE_SIZE });
+				}
+				const [running, stopped, error] = await Promise.all([
+					api.countVMs('running'),
+					api.countVMs('stopped'),
+					api.countVMs('error')
+				]);
+				update(() => ({
+					vms: result.data || [],
+					page: result.page,
+					totalPages: Math.max(result.total_pages, 1),
+					total: result.total,
+					counts: { total: result.total, running, stopped, error },
+					loading: false,
+					error: null
+				}));
 			} catch (e) {
 				let msg = (e as Error).message;
 				if (msg.includes('Failed to fetch')) msg = "The zoo is closed. (Network error)";
 				update((s) => ({ ...s, loading: false, error: msg }));
 			}
 		},
+		async setPage(target: number) {
+			page = target;
+			await this.fetch();
+		},
 		async create(name: string, config: VM['config']) {
 			update((s) => ({ ...s, loading: true, error: null }));
 			try {
 				const vm = await api.createVM({ name, config });
-				update((s) => ({ ...s, vms: [...s.vms, vm], loading: false }));
+				await this.fetch();
 				return vm;
 			} catch (e) {
 				let msg = (e as Error).message;
@@ -70,16 +111,53 @@ function createVMStore() {
 				return false;
 			}
 		},
+		async pause(id: string) {
+			try {
+				await api.pauseVM(id);
+				await this.fetch();
+				return true;
+			} catch (e) {
+				update((s) => ({ ...s, error: "It won't hold still. (" + (e as Error).message + ")" }));
+				return false;
+			}
+		},
+		async resume(id: string) {
+			try {
+				await api.resumeVM(id);
+				await this.fetch();
+				return true;
+			} catch (e) {
+				update((s) => ({ ...s, error: "It won't snap out of it. (" + (e as Error).message + ")" }));
+				return false;
+			}
+		},
 		async delete(id: string) {
 			try {
 				await api.deleteVM(id);
-				update((s) => ({ ...s, vms: s.vms.filter((vm) => vm.id !== id) }));
+				await this.fetch();
 				return true;
 			} catch (e) {
 				update((s) => ({ ...s, error: "Exorcism failed. (" + (e as Error).message + ")" }));
 				return false;
 			}
 		},
+		// Refresh whenever a VM changes, instead of polling. Returns a
+		// function that stops watching.
+		watch() {
+			let pending: ReturnType<typeof setTimeout> | null = null;
+			const close = api.subscribeEvents(() => {
+				// Coalesce bursts such as bulk actions into one refresh
+				if (pending) return;
+				pending = setTimeout(() => {
+					pending = null;
+					this.fetch();
+				}, 250);
+			});
+			return () => {
+				if (pending) clearTimeout(pending);
+				close();
+			};
+		},
 		clearError() {
 			update((s) => ({ ...s, error: null }));
 		}
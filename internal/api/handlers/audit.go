@@ -0,0 +1,138 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/audit"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// exportBatchSize is how many audit entries are read per transaction while
+// exporting, so a slow client doesn't hold one open
+const exportBatchSize = 500
+
+// AuditHandler handles audit log requests
+type AuditHandler struct {
+	log *audit.Log
+}
+
+// NewAuditHandler creates a new AuditHandler
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+	return &AuditHandler{log: log}
+}
+
+// List returns a page of audit entries, newest first
+func (h *AuditHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultPageSize
+	if v := query.Get("page_size"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxPageSize {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("page_size must be between 1 and %d", maxPageSize))
+			return
+		}
+	}
+	var before uint64
+	if v := query.Get("before"); v != "" {
+		if before, err = strconv.ParseUint(v, 10, 64); err != nil {
+			respondError(w, http.StatusBadRequest, "before must be a sequence number")
+			return
+		}
+	}
+
+	entries, err := h.log.Before(filter, before, limit)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Couldn't read the audit log. Nobody saw anything")
+		return
+	}
+
+	page := models.AuditPage{Data: entries}
+	if len(entries) == limit {
+		page.Next = entries[len(entries)-1].Sequence
+	}
+	respondJSON(w, http.StatusOK, page)
+}
+
+// Export streams every matching audit entry as newline-delimited JSON,
+// oldest first
+func (h *AuditHandler) Export(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Read the first batch before committing to a response
+	entries, err := h.log.After(filter, 0, exportBatchSize)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Couldn't read the audit log. Nobody saw anything")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.ndjson"`)
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	encoder := json.NewEncoder(w)
+	for len(entries) > 0 {
+		// A large log takes longer than the server's write timeout
+		_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return
+			}
+		}
+		if len(entries) < exportBatchSize {
+			return
+		}
+
+		// Entries are only ever appended, so this picks up where the batch ended
+		if entries, err = h.log.After(filter, entries[len(entries)-1].Sequence, exportBatchSize); err != nil {
+			return
+		}
+	}
+}
+
+// parseAuditFilter reads the since, until, user and action query
+// parameters. Times are RFC 3339.
+func parseAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	query := r.URL.Query()
+	filter := models.AuditFilter{
+		User:   query.Get("user"),
+		Action: query.Get("action"),
+	}
+
+	for name, dest := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return filter, fmt.Errorf("%s must be an RFC 3339 time, like 2006-01-02T15:04:05Z", name)
+			}
+			*dest = t
+		}
+	}
+	return filter, nil
+}
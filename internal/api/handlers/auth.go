@@ -15,10 +15,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/audit"
 	"github.com/anubhavg-icpl/agni/internal/auth"
 	"github.com/anubhavg-icpl/agni/pkg/models"
 )
@@ -26,11 +28,13 @@ import (
 // AuthHandler handles authentication requests
 type AuthHandler struct {
 	authService *auth.Service
+	auditLog    *audit.Log
 }
 
-// NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(authService *auth.Service) *AuthHandler {
-	return &AuthHandler{authService: authService}
+// NewAuthHandler creates a new AuthHandler. Logins and setup are recorded
+// in auditLog.
+func NewAuthHandler(authService *auth.Service, auditLog *audit.Log) *AuthHandler {
+	return &AuthHandler{authService: authService, auditLog: auditLog}
 }
 
 // Setup handles first-time setup
@@ -46,16 +50,29 @@ func (h *AuthHandler) Setup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entry := middleware.NewAuditEntry(r, models.AuditSetup)
+	entry.Username = req.Username
+
 	user, err := h.authService.Setup(req.Username, req.Password)
 	if err != nil {
 		if err == models.ErrSetupAlreadyDone {
+			entry.SetStatus(http.StatusConflict)
+			h.auditLog.Record(entry)
 			respondError(w, http.StatusConflict, "Someone already claimed the throne. You're too slow")
 			return
 		}
+		entry.SetStatus(http.StatusBadRequest)
+		h.auditLog.Record(entry)
 		respondError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
+	entry.UserID = user.ID
+	entry.Role = user.Role
+	entry.TargetID = user.ID
+	entry.SetStatus(http.StatusCreated)
+	h.auditLog.Record(entry)
+
 	safeUser := user.SafeUser()
 	respondJSON(w, http.StatusCreated, map[string]any{
 		"success": true,
@@ -77,9 +94,15 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Failed attempts are recorded with the username that was tried
+	entry := middleware.NewAuditEntry(r, models.AuditLogin)
+	entry.Username = req.Username
+
 	resp, err := h.authService.Login(req.Username, req.Password)
 	if err != nil {
 		if err == models.ErrInvalidCredentials {
+			entry.SetStatus(http.StatusUnauthorized)
+			h.auditLog.Record(entry)
 			respondError(w, http.StatusUnauthorized, "Wrong credentials. Did you forget already? Impressive")
 			return
 		}
@@ -87,6 +110,11 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	entry.UserID = resp.User.ID
+	entry.Role = resp.User.Role
+	entry.SetStatus(http.StatusOK)
+	h.auditLog.Record(entry)
+
 	// Return safe response without password hash
 	safeResp := resp.SafeLoginResponse()
 	respondJSON(w, http.StatusOK, safeResp)
@@ -149,3 +177,41 @@ func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 		"message": "Fine, leave. See if we care",
 	})
 }
+
+// ChangePassword changes the current user's password
+func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r.Context())
+	if user == nil {
+		respondError(w, http.StatusUnauthorized, "Who are you? No seriously, we have no idea")
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Your request is as malformed as your life choices")
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		respondError(w, http.StatusBadRequest, "Old password and new password. We need both")
+		return
+	}
+
+	if err := h.authService.ChangePassword(user.ID, req.CurrentPassword, req.NewPassword); err != nil {
+		var apiErr *models.APIError
+		switch {
+		case err == models.ErrInvalidCredentials:
+			respondError(w, http.StatusForbidden, "That's not your current password. Forgot it already?")
+		case errors.As(err, &apiErr):
+			respondError(w, apiErr.Code, apiErr.Message)
+		default:
+			respondError(w, http.StatusInternalServerError, "Something broke. Probably your fault somehow")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"message": "Password changed. Try to remember this one",
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// BalloonHandler handles memory balloon requests
+type BalloonHandler struct {
+	manager *vm.Manager
+}
+
+// NewBalloonHandler creates a new BalloonHandler
+func NewBalloonHandler(manager *vm.Manager) *BalloonHandler {
+	return &BalloonHandler{manager: manager}
+}
+
+// Update resizes a VM's balloon
+func (h *BalloonHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "VM ID is required. We're not mind readers here")
+		return
+	}
+
+	var req models.UpdateBalloonRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON. The balloon popped")
+		return
+	}
+
+	balloon, err := h.manager.UpdateBalloon(id, &req, requestActor(r))
+	if err != nil {
+		h.respondBalloonError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, balloon)
+}
+
+// Stats returns the guest memory statistics reported by a VM's balloon
+func (h *BalloonHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "VM ID is required. We're not mind readers here")
+		return
+	}
+
+	stats, err := h.manager.GetBalloonStats(id)
+	if err != nil {
+		h.respondBalloonError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, stats)
+}
+
+// respondBalloonError maps manager errors to responses
+func (h *BalloonHandler) respondBalloonError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrVMNotFound:
+		respondError(w, http.StatusNotFound, "VM not found. Either it never existed or it ghosted you")
+	case models.ErrVMNotRunning:
+		respondError(w, http.StatusConflict, "VM isn't running. Its memory is all yours already")
+	case models.ErrBalloonNotConfigured:
+		respondError(w, http.StatusNotFound, "This VM has no balloon. Add one to its config and restart it")
+	case models.ErrBalloonStatsDisabled:
+		respondError(w, http.StatusConflict, "Balloon statistics are off. Set stats_polling_interval_s before boot")
+	case models.ErrBalloonStatsToggle:
+		respondError(w, http.StatusConflict, "Balloon statistics can only be switched on or off before boot")
+	case models.ErrInvalidBalloon:
+		respondError(w, http.StatusBadRequest, "Balloon can't be bigger than the VM's memory. Physics still applies")
+	default:
+		respondError(w, http.StatusInternalServerError, "Balloon operation failed. Something deflated")
+	}
+}
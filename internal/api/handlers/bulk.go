@@ -0,0 +1,155 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+const (
+	// maxBulkConcurrency bounds how many VMs a bulk action works on at once
+	maxBulkConcurrency = 8
+
+	// bulkWriteTimeout bounds how long a bulk action may take
+	bulkWriteTimeout = 10 * time.Minute
+)
+
+// bulkAction acts on a single VM, returning how it was shut down if it was
+type bulkAction func(ctx context.Context, vm *models.VM) (models.ShutdownMethod, error)
+
+// BulkStart starts every VM matching a selector
+func (h *VMHandler) BulkStart(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, func(ctx context.Context, vm *models.VM) (models.ShutdownMethod, error) {
+		return "", h.manager.Start(vm.ID, requestActor(r))
+	})
+}
+
+// BulkStop force stops every VM matching a selector
+func (h *VMHandler) BulkStop(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, func(ctx context.Context, vm *models.VM) (models.ShutdownMethod, error) {
+		return "", h.manager.Stop(vm.ID, requestActor(r))
+	})
+}
+
+// BulkShutdown gracefully shuts down every VM matching a selector. The
+// grace period is shared: whatever is still up when it ends is forced off.
+func (h *VMHandler) BulkShutdown(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, func(ctx context.Context, vm *models.VM) (models.ShutdownMethod, error) {
+		return h.manager.ShutdownContext(ctx, vm.ID, requestActor(r))
+	})
+}
+
+// BulkDelete deletes every VM matching a selector. Running VMs are skipped
+// with an error, like single deletes.
+func (h *VMHandler) BulkDelete(w http.ResponseWriter, r *http.Request) {
+	h.bulk(w, r, func(ctx context.Context, vm *models.VM) (models.ShutdownMethod, error) {
+		return "", h.manager.Delete(vm.ID, requestActor(r))
+	})
+}
+
+// bulk runs an action on the caller's VMs matching the request's selector
+// and reports the outcome per VM
+func (h *VMHandler) bulk(w http.ResponseWriter, r *http.Request, action bulkAction) {
+	var req models.BulkVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+
+	// An empty selector matches everything, which is one typo away from disaster
+	selector, err := vm.ParseSelector(req.Selector)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if selector.Empty() {
+		respondError(w, http.StatusBadRequest, "Bulk actions need a selector. We're not touching every VM on a hunch")
+		return
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 || concurrency > maxBulkConcurrency {
+		concurrency = maxBulkConcurrency
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = vm.DefaultShutdownTimeout
+	}
+	if timeout < 0 || timeout > maxShutdownTimeout {
+		respondError(w, http.StatusBadRequest, "Timeout must be between 1 and 50 seconds. We can't wait forever, and neither can HTTP")
+		return
+	}
+
+	vms, err := h.selectVMs(r, selector)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list VMs. The database is being dramatic")
+		return
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(bulkWriteTimeout))
+
+	// Only shutdowns wait on the grace period
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	results := runBulk(ctx, vms, concurrency, action)
+
+	resp := models.BulkVMResponse{
+		Matched: len(vms),
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Success {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+	}
+	respondJSON(w, http.StatusOK, resp)
+}
+
+// runBulk runs an action on VMs with at most concurrency running at once.
+// Results are in the order of vms.
+func runBulk(ctx context.Context, vms []*models.VM, concurrency int, action bulkAction) []models.BulkVMResult {
+	results := make([]models.BulkVMResult, len(vms))
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for i, vm := range vms {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, vm *models.VM) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			result := models.BulkVMResult{VMID: vm.ID, Name: vm.Name}
+			method, err := action(ctx, vm)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Success = true
+				result.Method = method
+			}
+			results[i] = result
+		}(i, vm)
+	}
+	wg.Wait()
+	return results
+}
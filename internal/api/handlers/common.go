@@ -16,6 +16,8 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
 )
 
 // respondJSON sends a JSON response
@@ -31,3 +33,12 @@ func respondJSON(w http.ResponseWriter, status int, data any) {
 func respondError(w http.ResponseWriter, status int, message string) {
 	respondJSON(w, status, map[string]string{"error": message})
 }
+
+// requestActor returns the name of the user a request acts for, which VM
+// events are attributed to
+func requestActor(r *http.Request) string {
+	if user := middleware.GetUser(r.Context()); user != nil {
+		return user.Username
+	}
+	return ""
+}
@@ -17,7 +17,9 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
 	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/internal/vm"
 	"github.com/anubhavg-icpl/agni/pkg/models"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -33,14 +35,23 @@ func NewConfigHandler(store *storage.ConfigStore) *ConfigHandler {
 	return &ConfigHandler{store: store}
 }
 
-// List returns all configuration templates
+// List returns the caller's configuration templates, or all for admins
 func (h *ConfigHandler) List(w http.ResponseWriter, r *http.Request) {
-	configs, err := h.store.List()
+	query, err := parseListQuery(r, false, storage.SortName, storage.SortCreatedAt)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := middleware.GetUser(r.Context())
+	configs, total, err := h.store.ListPage(query.options(), func(config *models.ConfigTemplate) bool {
+		return middleware.CanAccess(user, config.OwnerID) && query.matchName(config.Name)
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	respondJSON(w, http.StatusOK, configs)
+	respondJSON(w, http.StatusOK, query.response(configs, total))
 }
 
 // Create creates a new configuration template
@@ -55,11 +66,23 @@ func (h *ConfigHandler) Create(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Name is required")
 		return
 	}
+	if err := vm.ValidateLabels(req.Labels); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	owner := middleware.GetUser(r.Context())
+	if owner == nil {
+		respondError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
 
 	config := &models.ConfigTemplate{
 		ID:          uuid.New().String(),
 		Name:        req.Name,
 		Description: req.Description,
+		OwnerID:     owner.ID,
+		Labels:      req.Labels,
 		Config:      req.Config,
 	}
 
@@ -67,6 +90,7 @@ func (h *ConfigHandler) Create(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	middleware.SetAuditTarget(r, config.ID)
 
 	respondJSON(w, http.StatusCreated, config)
 }
@@ -105,6 +129,10 @@ func (h *ConfigHandler) Update(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if err := vm.ValidateLabels(req.Labels); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
 	config, err := h.store.Get(id)
 	if err != nil {
@@ -116,6 +144,8 @@ func (h *ConfigHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *config
+
 	// Update fields
 	if req.Name != "" {
 		config.Name = req.Name
@@ -123,12 +153,16 @@ func (h *ConfigHandler) Update(w http.ResponseWriter, r *http.Request) {
 	if req.Description != "" {
 		config.Description = req.Description
 	}
+	if req.Labels != nil {
+		config.Labels = req.Labels
+	}
 	config.Config = req.Config
 
 	if err := h.store.Update(config); err != nil {
 		respondError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	middleware.SetAuditChanges(r, &before, config)
 
 	respondJSON(w, http.StatusOK, config)
 }
@@ -0,0 +1,211 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// eventHeartbeatInterval keeps idle streams open through proxies and
+	// notices clients that went away
+	eventHeartbeatInterval = 15 * time.Second
+
+	// eventWriteTimeout bounds a single write to an event stream
+	eventWriteTimeout = 10 * time.Second
+)
+
+// Events streams VM lifecycle events, over a WebSocket if the client asks
+// for an upgrade and as server-sent events otherwise. Clients resume after
+// the last sequence number they saw with the since query parameter, or the
+// Last-Event-ID header EventSource sends when it reconnects. Without either
+// only new events are sent. Users only see events of their own VMs.
+func (h *WebSocketHandler) Events(w http.ResponseWriter, r *http.Request) {
+	user := h.authenticate(w, r)
+	if user == nil {
+		return
+	}
+
+	cursor := r.URL.Query().Get("since")
+	if cursor == "" {
+		cursor = r.Header.Get("Last-Event-ID")
+	}
+
+	bus := h.vmManager.Events()
+	var sub *vm.EventSubscriber
+	var backlog []*models.Event
+	if cursor == "" {
+		sub = bus.Subscribe()
+	} else {
+		since, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			http.Error(w, "since must be a sequence number", http.StatusBadRequest)
+			return
+		}
+		if sub, backlog, err = bus.Resume(since); err != nil {
+			http.Error(w, "Failed to read events", http.StatusInternalServerError)
+			return
+		}
+	}
+	defer bus.Unsubscribe(sub)
+
+	visible := func(event *models.Event) bool {
+		return middleware.CanAccess(user, event.OwnerID)
+	}
+
+	if websocket.IsWebSocketUpgrade(r) {
+		streamEventsWebSocket(w, r, sub, backlog, visible)
+	} else {
+		streamEventsSSE(w, r, sub, backlog, visible)
+	}
+}
+
+// streamEventsWebSocket sends events as WebSocketMessage frames of type
+// event. A subscriber that fell behind is closed with 1013 (try again
+// later), so the client resumes.
+func streamEventsWebSocket(w http.ResponseWriter, r *http.Request, sub *vm.EventSubscriber, backlog []*models.Event, visible func(*models.Event) bool) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	send := func(event *models.Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(models.WebSocketMessage{Type: "event", Payload: event})
+	}
+
+	done := make(chan struct{})
+
+	// The client only sends pings; reading notices when it goes away
+	go func() {
+		defer close(done)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if string(msg) == "ping" {
+				_ = conn.WriteControl(websocket.PongMessage, nil, time.Now().Add(eventWriteTimeout))
+			}
+		}
+	}()
+
+	for _, event := range backlog {
+		if visible(event) {
+			if err := send(event); err != nil {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Channel:
+			if !ok {
+				_ = conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "fell behind, resume from the last sequence number"),
+					time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if visible(event) {
+				if err := send(event); err != nil {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// streamEventsSSE sends events as server-sent events, named after the event
+// type with the sequence number as ID. The stream ends when the subscriber
+// falls behind, and EventSource reconnects where it left off. It also ends
+// when the client goes away or the event bus closes on shutdown; the route
+// is exempt from the router's timeout.
+func streamEventsSSE(w http.ResponseWriter, r *http.Request, sub *vm.EventSubscriber, backlog []*models.Event, visible func(*models.Event) bool) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(format string, args ...any) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(event *models.Event) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return write("id: %d\nevent: %s\ndata: %s\n\n", event.Sequence, event.Type, data)
+	}
+
+	// Tell EventSource how soon to reconnect
+	if err := write("retry: 1000\n\n"); err != nil {
+		return
+	}
+	for _, event := range backlog {
+		if visible(event) {
+			if err := send(event); err != nil {
+				return
+			}
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Channel:
+			if !ok {
+				return
+			}
+			if visible(event) {
+				if err := send(event); err != nil {
+					return
+				}
+			}
+		case <-heartbeat.C:
+			if err := write(": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
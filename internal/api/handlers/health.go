@@ -81,6 +81,11 @@ func (h *HealthHandler) SystemInfo(w http.ResponseWriter, r *http.Request) {
 		TotalMemory:        memStats.Sys,
 	}
 
+	// Headroom for new VMs; the rest of the info does not depend on /proc
+	if resources, err := h.vmManager.Resources(); err == nil {
+		info.Resources = resources
+	}
+
 	respondJSON(w, http.StatusOK, info)
 }
 
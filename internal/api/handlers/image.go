@@ -0,0 +1,207 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/image"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	// imageWriteTimeout bounds how long checksumming a large image may take
+	imageWriteTimeout = 10 * time.Minute
+
+	// buildTimeout bounds building a root filesystem from a container image
+	buildTimeout = 30 * time.Minute
+)
+
+// ImageHandler handles image registry requests
+type ImageHandler struct {
+	registry *image.Registry
+}
+
+// NewImageHandler creates a new ImageHandler
+func NewImageHandler(registry *image.Registry) *ImageHandler {
+	return &ImageHandler{registry: registry}
+}
+
+// List returns the registered images, filtered by ?type= and ?arch=
+func (h *ImageHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	images, err := h.registry.List(models.ImageType(query.Get("type")), query.Get("arch"))
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Failed to list images. The library is closed")
+		return
+	}
+	respondJSON(w, http.StatusOK, images)
+}
+
+// Register adds an image file to the registry
+func (h *ImageHandler) Register(w http.ResponseWriter, r *http.Request) {
+	var req models.RegisterImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+
+	// Root filesystems can take a while to checksum
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(imageWriteTimeout))
+
+	img, err := h.registry.Register(req)
+	if err != nil {
+		h.respondImageError(w, err)
+		return
+	}
+	middleware.SetAuditTarget(r, img.ID)
+
+	respondJSON(w, http.StatusCreated, img)
+}
+
+// Build creates a root filesystem image from a container image tarball and
+// registers it
+func (h *ImageHandler) Build(w http.ResponseWriter, r *http.Request) {
+	var req models.BuildRootfsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+
+	// The router's timeout would cancel the request context long before
+	// a large image is done
+	ctx, cancel := context.WithTimeout(context.Background(), buildTimeout)
+	defer cancel()
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(buildTimeout))
+
+	img, err := h.registry.Build(ctx, req)
+	if err != nil {
+		switch {
+		case err == models.ErrInvalidImage:
+			respondError(w, http.StatusBadRequest, "A build needs a name and absolute source and output paths")
+		case err == models.ErrRootfsNoShell:
+			respondError(w, http.StatusBadRequest, "agni-init is a shell script, and this image has no /bin/sh")
+		case errors.Is(err, models.ErrInvalidImageArchive):
+			respondError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, fs.ErrNotExist):
+			respondError(w, http.StatusBadRequest, "Source tarball not found. Is it on this host?")
+		default:
+			respondError(w, http.StatusInternalServerError, "Build failed: "+err.Error())
+		}
+		return
+	}
+	middleware.SetAuditTarget(r, img.ID)
+
+	respondJSON(w, http.StatusCreated, img)
+}
+
+// Get returns a single image
+func (h *ImageHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Image ID is required. We're not mind readers here")
+		return
+	}
+
+	img, err := h.registry.Get(id)
+	if err != nil {
+		h.respondImageError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, img)
+}
+
+// Update changes an image's name, description or labels
+func (h *ImageHandler) Update(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Image ID is required. We're not mind readers here")
+		return
+	}
+
+	var req models.UpdateImageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+
+	img, err := h.registry.Update(id, req)
+	if err != nil {
+		h.respondImageError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, img)
+}
+
+// Delete removes an image from the registry; the file stays on disk
+func (h *ImageHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Image ID is required. We're not mind readers here")
+		return
+	}
+
+	if err := h.registry.Delete(id); err != nil {
+		h.respondImageError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]any{
+		"success": true,
+		"message": "Image unregistered. The file is still on disk, we're not monsters",
+	})
+}
+
+// Verify checks an image file against its recorded checksum
+func (h *ImageHandler) Verify(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Image ID is required. We're not mind readers here")
+		return
+	}
+
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(imageWriteTimeout))
+
+	img, err := h.registry.Verify(id)
+	if err != nil {
+		h.respondImageError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, img)
+}
+
+// respondImageError maps registry errors to responses
+func (h *ImageHandler) respondImageError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrImageNotFound:
+		respondError(w, http.StatusNotFound, "Image not found. Maybe it was never registered")
+	case models.ErrInvalidImage:
+		respondError(w, http.StatusBadRequest, "Images need a name, a type of kernel, initrd or rootfs, an arch of x86_64 or aarch64 and an absolute path to a regular file")
+	case models.ErrImageChecksumMismatch:
+		respondError(w, http.StatusConflict, "The file doesn't match its SHA-256. Someone has been tinkering")
+	case models.ErrImageInUse:
+		respondError(w, http.StatusConflict, "VMs still use this image. Delete them or point them elsewhere first")
+	default:
+		respondError(w, http.StatusInternalServerError, "Image operation failed. The bits are having a bad day")
+	}
+}
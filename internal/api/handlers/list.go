@@ -0,0 +1,110 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// listQuery holds the paging, sorting and filters of a list request
+type listQuery struct {
+	page     int
+	pageSize int
+	sort     string
+	desc     bool
+	name     string // Lowercased, matched as a substring
+	status   string
+}
+
+// parseListQuery reads the page, page_size, sort, name and status query
+// parameters. sorts are the accepted sort fields, the first is the default,
+// and a leading - sorts descending. status is only accepted with withStatus.
+func parseListQuery(r *http.Request, withStatus bool, sorts ...string) (*listQuery, error) {
+	query := r.URL.Query()
+	q := &listQuery{
+		page:     1,
+		pageSize: defaultPageSize,
+		sort:     sorts[0],
+		name:     strings.ToLower(query.Get("name")),
+		status:   query.Get("status"),
+	}
+
+	if v := query.Get("page"); v != "" {
+		page, err := strconv.Atoi(v)
+		if err != nil || page < 1 {
+			return nil, fmt.Errorf("page must be a positive number")
+		}
+		q.page = page
+	}
+	if v := query.Get("page_size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 1 || size > maxPageSize {
+			return nil, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+		q.pageSize = size
+	}
+	if v := query.Get("sort"); v != "" {
+		q.sort, q.desc = strings.CutPrefix(v, "-")
+		if !slices.Contains(sorts, q.sort) {
+			return nil, fmt.Errorf("sort must be one of %s", strings.Join(sorts, ", "))
+		}
+	}
+	if q.status != "" && !withStatus {
+		return nil, fmt.Errorf("status filter is not supported here")
+	}
+	return q, nil
+}
+
+// options returns the storage options for the requested page
+func (q *listQuery) options() storage.PageOptions {
+	return storage.PageOptions{
+		Sort:   q.sort,
+		Desc:   q.desc,
+		Offset: (q.page - 1) * q.pageSize,
+		Limit:  q.pageSize,
+	}
+}
+
+// matchName reports whether a name passes the name filter
+func (q *listQuery) matchName(name string) bool {
+	return q.name == "" || strings.Contains(strings.ToLower(name), q.name)
+}
+
+// matchStatus reports whether a status passes the status filter
+func (q *listQuery) matchStatus(status string) bool {
+	return q.status == "" || status == q.status
+}
+
+// response wraps a page of results
+func (q *listQuery) response(data any, total int) models.PaginatedResponse {
+	return models.PaginatedResponse{
+		Data:       data,
+		Total:      total,
+		Page:       q.page,
+		PageSize:   q.pageSize,
+		TotalPages: (total + q.pageSize - 1) / q.pageSize,
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// MetadataHandler handles VM MMDS metadata requests
+type MetadataHandler struct {
+	manager *vm.Manager
+}
+
+// NewMetadataHandler creates a new MetadataHandler
+func NewMetadataHandler(manager *vm.Manager) *MetadataHandler {
+	return &MetadataHandler{manager: manager}
+}
+
+// Get returns a VM's MMDS contents
+func (h *MetadataHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "VM ID is required. We're not mind readers here")
+		return
+	}
+
+	metadata, err := h.manager.GetMetadata(id)
+	if err != nil {
+		h.respondMetadataError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, metadata)
+}
+
+// Put replaces a VM's MMDS contents
+func (h *MetadataHandler) Put(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, false)
+}
+
+// Patch merges a JSON merge patch into a VM's MMDS contents
+func (h *MetadataHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	h.update(w, r, true)
+}
+
+// update decodes the request body and replaces or patches the metadata
+func (h *MetadataHandler) update(w http.ResponseWriter, r *http.Request, merge bool) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "VM ID is required. We're not mind readers here")
+		return
+	}
+
+	var data interface{}
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		respondError(w, http.StatusBadRequest, "Metadata must be valid JSON. Your guests deserve better")
+		return
+	}
+	if _, ok := data.(map[string]interface{}); merge && !ok {
+		respondError(w, http.StatusBadRequest, "A merge patch must be a JSON object. Can't merge into thin air")
+		return
+	}
+
+	var (
+		metadata interface{}
+		err      error
+	)
+	if merge {
+		metadata, err = h.manager.PatchMetadata(id, data, requestActor(r))
+	} else {
+		metadata, err = h.manager.SetMetadata(id, data, requestActor(r))
+	}
+	if err != nil {
+		h.respondMetadataError(w, err)
+		return
+	}
+
+	respondJSON(w, http.StatusOK, metadata)
+}
+
+// respondMetadataError maps manager errors to responses
+func (h *MetadataHandler) respondMetadataError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrVMNotFound:
+		respondError(w, http.StatusNotFound, "VM not found. Either it never existed or it ghosted you")
+	case models.ErrInvalidMetadata:
+		respondError(w, http.StatusBadRequest, "Stored metadata is not valid JSON. Someone's been editing the database")
+	default:
+		respondError(w, http.StatusInternalServerError, "Metadata service is having an existential crisis")
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// SnapshotHandler handles VM snapshot requests
+type SnapshotHandler struct {
+	manager *vm.Manager
+}
+
+// NewSnapshotHandler creates a new SnapshotHandler
+func NewSnapshotHandler(manager *vm.Manager) *SnapshotHandler {
+	return &SnapshotHandler{manager: manager}
+}
+
+// Create snapshots a running VM
+func (h *SnapshotHandler) Create(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Snapshot which VM? Say cheese to whom?")
+		return
+	}
+
+	var req models.CreateSnapshotRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+			return
+		}
+	}
+
+	snapshot, err := h.manager.CreateSnapshot(id, req.Type)
+	if err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "VM not found. Can't photograph a ghost")
+		case models.ErrVMNotRunning:
+			respondError(w, http.StatusConflict, "VM isn't running. Nothing in memory worth keeping")
+		case models.ErrSnapshotInProgress:
+			respondError(w, http.StatusConflict, "Already taking a snapshot. Hold that pose")
+		case models.ErrInvalidSnapshotType, models.ErrNoParentSnapshot, models.ErrDirtyPagesNotTracked, models.ErrSnapshotJailed:
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Snapshot failed. The moment is lost forever")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, snapshot)
+}
+
+// List returns all snapshots of a VM
+func (h *SnapshotHandler) List(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "VM ID is required. We're not mind readers here")
+		return
+	}
+
+	snapshots, err := h.manager.ListSnapshots(id)
+	if err != nil {
+		if err == models.ErrVMNotFound {
+			respondError(w, http.StatusNotFound, "VM not found. Either it never existed or it ghosted you")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to list snapshots. The album is stuck")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, snapshots)
+}
+
+// Restore boots a stopped VM from a snapshot
+func (h *SnapshotHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	sid := chi.URLParam(r, "sid")
+	if id == "" || sid == "" {
+		respondError(w, http.StatusBadRequest, "Restore needs both a VM and a snapshot. Pick one of each")
+		return
+	}
+
+	if err := h.manager.RestoreSnapshot(id, sid, requestActor(r)); err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "VM not found. Either it never existed or it ghosted you")
+		case models.ErrSnapshotNotFound:
+			respondError(w, http.StatusNotFound, "Snapshot not found. Memory is a fickle thing")
+		case models.ErrVMAlreadyRunning:
+			respondError(w, http.StatusConflict, "VM is running. Stop it before rewinding time")
+		case models.ErrSnapshotJailed:
+			respondError(w, http.StatusBadRequest, err.Error())
+		default:
+			if errors.Is(err, models.ErrSnapshotDriveChanged) {
+				respondError(w, http.StatusConflict, err.Error())
+				return
+			}
+			if errors.Is(err, models.ErrInsufficientResources) {
+				respondError(w, http.StatusConflict, err.Error())
+				return
+			}
+			if errors.Is(err, models.ErrQuotaExceeded) {
+				respondError(w, http.StatusForbidden, err.Error())
+				return
+			}
+			respondError(w, http.StatusInternalServerError, "Restore failed. Turns out you can't go home again")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.VMActionResponse{
+		Success: true,
+		Message: "VM restored from snapshot. Like nothing ever happened",
+		VMID:    id,
+	})
+}
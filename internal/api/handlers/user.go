@@ -0,0 +1,171 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/auth"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+// UserHandler handles user account and quota requests
+type UserHandler struct {
+	authService *auth.Service
+	vmManager   *vm.Manager
+}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler(authService *auth.Service, vmManager *vm.Manager) *UserHandler {
+	return &UserHandler{
+		authService: authService,
+		vmManager:   vmManager,
+	}
+}
+
+// List returns all users
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	query, err := parseListQuery(r, false, storage.SortName, storage.SortCreatedAt)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	users, total, err := h.authService.ListUsersPage(query.options(), func(user *models.User) bool {
+		return query.matchName(user.Username)
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Couldn't list users. They're hiding")
+		return
+	}
+
+	safeUsers := make([]models.User, 0, len(users))
+	for _, user := range users {
+		safeUsers = append(safeUsers, user.SafeUser())
+	}
+	respondJSON(w, http.StatusOK, query.response(safeUsers, total))
+}
+
+// Create creates a user account
+func (h *UserHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Your request is as malformed as your life choices")
+		return
+	}
+
+	if req.Username == "" || req.Password == "" {
+		respondError(w, http.StatusBadRequest, "Username and password. Both of them. It's not optional")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.UserRoleUser
+	}
+	if req.Role != models.UserRoleAdmin && req.Role != models.UserRoleUser {
+		respondError(w, http.StatusBadRequest, models.ErrInvalidRole.Error())
+		return
+	}
+	if err := auth.ValidateQuota(req.Quota); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.authService.CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		if err == models.ErrUserAlreadyExists {
+			respondError(w, http.StatusConflict, "That username is taken. Be more original")
+			return
+		}
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	middleware.SetAuditTarget(r, user.ID)
+
+	if req.Quota != nil {
+		if user, err = h.authService.SetQuota(user.ID, req.Quota); err != nil {
+			respondError(w, http.StatusInternalServerError, "User created, but their quota got lost on the way")
+			return
+		}
+	}
+
+	respondJSON(w, http.StatusCreated, user.SafeUser())
+}
+
+// Quota returns a user's quota and usage. Users may look at their own.
+func (h *UserHandler) Quota(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !middleware.CanAccess(middleware.GetUser(r.Context()), id) {
+		respondError(w, http.StatusForbidden, "Mind your own quota")
+		return
+	}
+
+	user, err := h.authService.GetUser(id)
+	if err != nil {
+		if err == models.ErrUserNotFound {
+			respondError(w, http.StatusNotFound, "No such user. Imaginary friends don't get quotas")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Something broke. Probably your fault somehow")
+		return
+	}
+
+	usage, err := h.vmManager.Usage(user.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Couldn't add up the usage. Math is hard")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.QuotaStatus{
+		UserID: user.ID,
+		Quota:  user.Quota,
+		Usage:  *usage,
+	})
+}
+
+// UpdateQuota replaces a user's quota. An empty body or null removes it.
+func (h *UserHandler) UpdateQuota(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var quota *models.UserQuota
+	if err := json.NewDecoder(r.Body).Decode(&quota); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "That's not a quota, that's a mess")
+		return
+	}
+
+	// Only needed to record the change, SetQuota reports a missing user
+	previous, _ := h.authService.GetUser(id)
+
+	user, err := h.authService.SetQuota(id, quota)
+	if err != nil {
+		switch err {
+		case models.ErrUserNotFound:
+			respondError(w, http.StatusNotFound, "No such user. Imaginary friends don't get quotas")
+		case models.ErrInvalidQuota:
+			respondError(w, http.StatusBadRequest, "Negative limits? Quotas don't work that way")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to save the quota. The database said no")
+		}
+		return
+	}
+	if previous != nil {
+		middleware.SetAuditChanges(r, previous.SafeUser(), user.SafeUser())
+	}
+
+	respondJSON(w, http.StatusOK, user.SafeUser())
+}
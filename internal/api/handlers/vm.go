@@ -15,13 +15,26 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"time"
 
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/storage"
 	"github.com/anubhavg-icpl/agni/internal/vm"
 	"github.com/anubhavg-icpl/agni/pkg/models"
 	"github.com/go-chi/chi/v5"
 )
 
+const (
+	// maxShutdownTimeout keeps a shutdown request within the router's 60s timeout
+	maxShutdownTimeout = 50 * time.Second
+
+	// cloneWriteTimeout bounds how long a clone may take to copy drives
+	cloneWriteTimeout = 30 * time.Minute
+)
+
 // VMHandler handles VM-related requests
 type VMHandler struct {
 	manager *vm.Manager
@@ -32,14 +45,47 @@ func NewVMHandler(manager *vm.Manager) *VMHandler {
 	return &VMHandler{manager: manager}
 }
 
-// List returns all VMs
+// List returns the caller's VMs, or all VMs for admins, optionally filtered
+// by a label ?selector=
 func (h *VMHandler) List(w http.ResponseWriter, r *http.Request) {
-	vms, err := h.manager.List()
+	query, err := parseListQuery(r, true, storage.SortName, storage.SortCreatedAt, storage.SortStatus)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	selector, err := vm.ParseSelector(r.URL.Query().Get("selector"))
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user := middleware.GetUser(r.Context())
+	vms, total, err := h.manager.ListPage(query.options(), func(vm *models.VM) bool {
+		return middleware.CanAccess(user, vm.OwnerID) && selector.Matches(vm.Labels) &&
+			query.matchName(vm.Name) && query.matchStatus(string(vm.Status))
+	})
 	if err != nil {
 		respondError(w, http.StatusInternalServerError, "Failed to list VMs. The database is being dramatic")
 		return
 	}
-	respondJSON(w, http.StatusOK, vms)
+	respondJSON(w, http.StatusOK, query.response(vms, total))
+}
+
+// selectVMs returns the VMs visible to the caller that match a selector
+func (h *VMHandler) selectVMs(r *http.Request, selector vm.Selector) ([]*models.VM, error) {
+	vms, err := h.manager.List()
+	if err != nil {
+		return nil, err
+	}
+
+	user := middleware.GetUser(r.Context())
+	selected := make([]*models.VM, 0, len(vms))
+	for _, vm := range vms {
+		if middleware.CanAccess(user, vm.OwnerID) && selector.Matches(vm.Labels) {
+			selected = append(selected, vm)
+		}
+	}
+	return selected, nil
 }
 
 // Create creates a new VM
@@ -55,12 +101,52 @@ func (h *VMHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	req.Config.Name = req.Name
-	vm, err := h.manager.Create(req.Config)
+	if err := vm.ValidateLabels(req.Labels); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	owner := middleware.GetUser(r.Context())
+	if owner == nil {
+		respondError(w, http.StatusUnauthorized, "Who are you? No seriously, we have no idea")
+		return
+	}
+
+	vm, err := h.manager.Create(req, owner.ID, owner.Username)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "VM creation failed. It's not you, it's... actually, it might be you")
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		switch err {
+		case models.ErrInvalidMetadata:
+			respondError(w, http.StatusBadRequest, "Metadata must be valid JSON. Your guests deserve better")
+		case models.ErrInvalidBalloon:
+			respondError(w, http.StatusBadRequest, "Balloon can't be bigger than the VM's memory. Physics still applies")
+		case models.ErrNetworkNotConfigured:
+			respondError(w, http.StatusBadRequest, "Managed NICs need managed networking, which is disabled on this host")
+		case models.ErrInvalidCNIConfig:
+			respondError(w, http.StatusBadRequest, "CNI needs a network name and has to be the VM's only NIC, without an ip= kernel argument")
+		case models.ErrManagedNICDevice:
+			respondError(w, http.StatusBadRequest, "Managed NICs get their tap from agni. Leave the device empty or turn off managed")
+		case models.ErrImageNotFound:
+			respondError(w, http.StatusBadRequest, "That image isn't registered. Check /api/images")
+		case models.ErrImageTypeMismatch:
+			respondError(w, http.StatusBadRequest, "Wrong kind of image. Kernels go in kernel_image_id, and so on")
+		case models.ErrImageChecksumMismatch:
+			respondError(w, http.StatusConflict, "The rootfs image changed since it was registered. Not copying that")
+		case models.ErrInvalidRestartPolicy:
+			respondError(w, http.StatusBadRequest, "Restart policy must be never, on-failure or always. 'sometimes' is not a policy")
+		case models.ErrInvalidJailerConfig:
+			respondError(w, http.StatusBadRequest, "Jailer IDs are letters, digits and dashes, and the jailer paths and users are the host's to choose")
+		case models.ErrJailerIDInUse:
+			respondError(w, http.StatusConflict, "Another VM already lives in that jail. Pick a different jailer ID")
+		default:
+			respondError(w, http.StatusInternalServerError, "VM creation failed. It's not you, it's... actually, it might be you")
+		}
 		return
 	}
+	middleware.SetAuditTarget(r, vm.ID)
 
 	respondJSON(w, http.StatusCreated, vm)
 }
@@ -94,19 +180,17 @@ func (h *VMHandler) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if VM is running
-	if h.manager.IsRunning(id) {
-		respondError(w, http.StatusConflict, "Can't update a running VM. Stop it first, genius")
-		return
-	}
-
 	var req models.UpdateVMRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
 		return
 	}
+	if err := vm.ValidateLabels(req.Labels); err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	vm, err := h.manager.Get(id)
+	current, err := h.manager.Get(id)
 	if err != nil {
 		if err == models.ErrVMNotFound {
 			respondError(w, http.StatusNotFound, "VM not found. Are you sure you created it?")
@@ -115,18 +199,56 @@ func (h *VMHandler) Update(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusInternalServerError, "Something went catastrophically wrong")
 		return
 	}
-
-	// Update fields
-	if req.Name != "" {
-		vm.Name = req.Name
-		vm.Config.Name = req.Name
+	transfer := req.OwnerID != "" && req.OwnerID != current.OwnerID
+	if transfer {
+		if user := middleware.GetUser(r.Context()); user == nil || !user.IsAdmin() {
+			respondError(w, http.StatusForbidden, "Only admins can give VMs away. Nice try")
+			return
+		}
+		if err := h.manager.ValidateOwner(req.OwnerID); err != nil {
+			respondError(w, http.StatusBadRequest, "The new owner doesn't exist. Can't give a VM to nobody")
+			return
+		}
 	}
 
 	// Actually persist the changes (unlike before...)
-	if err := h.manager.Update(vm); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to save. The database rejected your changes")
+	var before models.VM
+	vm, err := h.manager.Update(id, func(vm *models.VM) {
+		before = *vm
+		if req.Name != "" {
+			vm.Name = req.Name
+			vm.Config.Name = req.Name
+		}
+		if req.Autostart != nil {
+			vm.Autostart = *req.Autostart
+		}
+		if req.BootOrder != nil {
+			vm.BootOrder = *req.BootOrder
+		}
+		if req.Labels != nil {
+			vm.Labels = req.Labels
+			if len(vm.Labels) == 0 {
+				vm.Labels = nil
+			}
+		}
+		if transfer {
+			vm.OwnerID = req.OwnerID
+		}
+	}, requestActor(r))
+	if err != nil {
+		switch {
+		case err == models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "VM not found. Are you sure you created it?")
+		case err == models.ErrVMAlreadyRunning:
+			respondError(w, http.StatusConflict, "Can't update a running VM. Stop it first, genius")
+		case errors.Is(err, models.ErrQuotaExceeded):
+			respondError(w, http.StatusForbidden, err.Error())
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to save. The database rejected your changes")
+		}
 		return
 	}
+	middleware.SetAuditChanges(r, &before, vm)
 
 	respondJSON(w, http.StatusOK, vm)
 }
@@ -139,7 +261,7 @@ func (h *VMHandler) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.manager.Delete(id); err != nil {
+	if err := h.manager.Delete(id, requestActor(r)); err != nil {
 		if err == models.ErrVMNotFound {
 			respondError(w, http.StatusNotFound, "Can't delete what doesn't exist. Philosophy 101")
 			return
@@ -163,7 +285,7 @@ func (h *VMHandler) Start(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.manager.Start(id); err != nil {
+	if err := h.manager.Start(id, requestActor(r)); err != nil {
 		if err == models.ErrVMNotFound {
 			respondError(w, http.StatusNotFound, "That VM is as real as your productivity today")
 			return
@@ -172,6 +294,34 @@ func (h *VMHandler) Start(w http.ResponseWriter, r *http.Request) {
 			respondError(w, http.StatusConflict, "It's already running. What more do you want from it?")
 			return
 		}
+		if err == models.ErrAddressPoolExhausted {
+			respondError(w, http.StatusConflict, "Out of IP addresses. The subnet is full, delete some VMs")
+			return
+		}
+		if err == models.ErrNetworkNotConfigured {
+			respondError(w, http.StatusBadRequest, "Managed NICs need managed networking, which is disabled on this host")
+			return
+		}
+		if err == models.ErrImageChecksumMismatch {
+			respondError(w, http.StatusConflict, "An image file changed since it was registered. Not booting that")
+			return
+		}
+		if err == models.ErrImageArchMismatch {
+			respondError(w, http.StatusConflict, "The VM's images were built for another architecture")
+			return
+		}
+		if err == models.ErrImageNotFound {
+			respondError(w, http.StatusConflict, "The VM references an image that is no longer registered")
+			return
+		}
+		if errors.Is(err, models.ErrInsufficientResources) {
+			respondError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
 		respondError(w, http.StatusInternalServerError, "VM refused to start. Can't say we blame it")
 		return
 	}
@@ -191,7 +341,7 @@ func (h *VMHandler) Stop(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.manager.Stop(id); err != nil {
+	if err := h.manager.Stop(id, requestActor(r)); err != nil {
 		if err == models.ErrVMNotFound {
 			respondError(w, http.StatusNotFound, "Can't stop a VM that doesn't exist. Bold strategy")
 			return
@@ -219,7 +369,27 @@ func (h *VMHandler) Shutdown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.manager.Shutdown(id); err != nil {
+	// The body is optional, an empty one means the default grace period
+	var req models.ShutdownVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+	timeout := time.Duration(req.TimeoutSeconds) * time.Second
+	if timeout == 0 {
+		timeout = vm.DefaultShutdownTimeout
+	}
+	if timeout < 0 || timeout > maxShutdownTimeout {
+		respondError(w, http.StatusBadRequest, "Timeout must be between 1 and 50 seconds. We can't wait forever, and neither can HTTP")
+		return
+	}
+
+	// The server's write timeout is shorter than most grace periods
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second))
+
+	started := time.Now()
+	method, err := h.manager.Shutdown(id, timeout, requestActor(r))
+	if err != nil {
 		if err == models.ErrVMNotFound {
 			respondError(w, http.StatusNotFound, "That VM is already in a better place. Or it never existed")
 			return
@@ -232,10 +402,19 @@ func (h *VMHandler) Shutdown(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respondJSON(w, http.StatusOK, models.VMActionResponse{
-		Success: true,
-		Message: "VM is shutting down gracefully. Unlike your code reviews",
-		VMID:    id,
+	message := "VM shut down gracefully. Unlike your code reviews"
+	if method == models.ShutdownForced {
+		message = "The guest ignored us, so we pulled the plug"
+	}
+
+	respondJSON(w, http.StatusOK, models.ShutdownVMResponse{
+		VMActionResponse: models.VMActionResponse{
+			Success: true,
+			Message: message,
+			VMID:    id,
+		},
+		Method:     method,
+		DurationMs: time.Since(started).Milliseconds(),
 	})
 }
 
@@ -259,3 +438,143 @@ func (h *VMHandler) Metrics(w http.ResponseWriter, r *http.Request) {
 
 	respondJSON(w, http.StatusOK, metrics)
 }
+
+// UpdateRateLimiters changes drive and NIC rate limiters, live if the VM is running
+func (h *VMHandler) UpdateRateLimiters(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Throttle which VM? We can't slow down everything")
+		return
+	}
+
+	var req models.UpdateRateLimitersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid JSON. Even rate limiters have standards")
+		return
+	}
+
+	vm, err := h.manager.UpdateRateLimiters(id, &req, requestActor(r))
+	if err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "VM not found. Nothing to throttle")
+		case models.ErrDriveNotFound:
+			respondError(w, http.StatusNotFound, "That drive doesn't exist. Drive IDs start at 1 for the root drive")
+		case models.ErrNICNotFound:
+			respondError(w, http.StatusNotFound, "No network interface with that device name. Check your taps")
+		case models.ErrInvalidRateLimiter:
+			respondError(w, http.StatusBadRequest, "Negative rate limits? Time travel isn't supported yet")
+		default:
+			respondError(w, http.StatusInternalServerError, "Failed to update rate limiters. Firecracker is going full speed regardless")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, vm)
+}
+
+// Clone copies a stopped VM, drives included
+func (h *VMHandler) Clone(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Clone what? We need an original first")
+		return
+	}
+
+	// The body is optional, an empty one makes a single clone
+	var req models.CloneVMRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		respondError(w, http.StatusBadRequest, "Invalid request body. JSON is hard, we know")
+		return
+	}
+
+	// Copying disks without reflink support takes a while
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(cloneWriteTimeout))
+
+	owner := middleware.GetUser(r.Context())
+	if owner == nil {
+		respondError(w, http.StatusUnauthorized, "Who are you? No seriously, we have no idea")
+		return
+	}
+
+	clones, err := h.manager.Clone(id, owner.ID, owner.Username, req)
+	if err != nil {
+		if errors.Is(err, models.ErrQuotaExceeded) {
+			respondError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "VM not found. Can't clone thin air")
+		case models.ErrVMAlreadyRunning:
+			respondError(w, http.StatusConflict, "Can't clone a running VM. Stop it first, unless you like corrupted disks")
+		case models.ErrDriveNotFound:
+			respondError(w, http.StatusBadRequest, "Can't share a drive that doesn't exist. Drive IDs start at 1 for the root drive")
+		case models.ErrInvalidCloneCount:
+			respondError(w, http.StatusBadRequest, "Clone count must be between 1 and 32. This isn't a sheep farm")
+		default:
+			respondError(w, http.StatusInternalServerError, "Cloning failed. The original remains one of a kind")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusCreated, clones)
+}
+
+// Pause pauses a running VM
+func (h *VMHandler) Pause(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Pause what? Time itself? Give us a VM ID")
+		return
+	}
+
+	if err := h.manager.Pause(id, requestActor(r)); err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "Can't pause a VM that doesn't exist. Bold strategy")
+		case models.ErrVMNotRunning, models.ErrInvalidTransition:
+			respondError(w, http.StatusConflict, "Only running VMs can be paused. This one isn't")
+		case models.ErrSnapshotInProgress:
+			respondError(w, http.StatusConflict, "A snapshot is being taken. The VM is already paused for it")
+		default:
+			respondError(w, http.StatusInternalServerError, "Pause failed. The VM refuses to sit still")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.VMActionResponse{
+		Success: true,
+		Message: "VM paused. Frozen in time, like your side projects",
+		VMID:    id,
+	})
+}
+
+// Resume resumes a paused VM
+func (h *VMHandler) Resume(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if id == "" {
+		respondError(w, http.StatusBadRequest, "Resume which VM? We paused a few")
+		return
+	}
+
+	if err := h.manager.Resume(id, requestActor(r)); err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			respondError(w, http.StatusNotFound, "That VM is as real as your productivity today")
+		case models.ErrVMNotRunning, models.ErrInvalidTransition:
+			respondError(w, http.StatusConflict, "Only paused VMs can be resumed. This one isn't")
+		case models.ErrSnapshotInProgress:
+			respondError(w, http.StatusConflict, "A snapshot is being taken. It resumes on its own when done")
+		default:
+			respondError(w, http.StatusInternalServerError, "Resume failed. It's enjoying the break too much")
+		}
+		return
+	}
+
+	respondJSON(w, http.StatusOK, models.VMActionResponse{
+		Success: true,
+		Message: "VM resumed. Back to work",
+		VMID:    id,
+	})
+}
@@ -0,0 +1,167 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/webhook"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+)
+
+const defaultDeliveryLimit = 50
+
+// WebhookHandler handles webhook registration and delivery requests
+type WebhookHandler struct {
+	dispatcher *webhook.Dispatcher
+}
+
+// NewWebhookHandler creates a new WebhookHandler
+func NewWebhookHandler(dispatcher *webhook.Dispatcher) *WebhookHandler {
+	return &WebhookHandler{
+		dispatcher: dispatcher,
+	}
+}
+
+// List returns all webhooks, without their secrets
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.dispatcher.List()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, "Couldn't list webhooks. They're not picking up")
+		return
+	}
+
+	redacted := make([]models.Webhook, 0, len(webhooks))
+	for _, hook := range webhooks {
+		redacted = append(redacted, hook.Redacted())
+	}
+	respondJSON(w, http.StatusOK, redacted)
+}
+
+// Create registers a webhook. The response is the only time the secret is
+// shown.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Your request is as malformed as your life choices")
+		return
+	}
+
+	hook, err := h.dispatcher.Create(req, requestActor(r))
+	if err != nil {
+		if err == models.ErrInvalidWebhook {
+			respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(w, http.StatusInternalServerError, "Failed to register the webhook. Nobody's listening")
+		return
+	}
+	middleware.SetAuditTarget(r, hook.ID)
+
+	respondJSON(w, http.StatusCreated, hook)
+}
+
+// Get returns a webhook, without its secret
+func (h *WebhookHandler) Get(w http.ResponseWriter, r *http.Request) {
+	hook, err := h.dispatcher.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, hook.Redacted())
+}
+
+// Update changes a webhook. An empty secret keeps the current one.
+func (h *WebhookHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var req models.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Your request is as malformed as your life choices")
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	before, err := h.dispatcher.Get(id)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+
+	hook, err := h.dispatcher.Update(id, req)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	// Secrets stay out of the audit log
+	middleware.SetAuditChanges(r, before.Redacted(), hook.Redacted())
+	respondJSON(w, http.StatusOK, hook.Redacted())
+}
+
+// Delete removes a webhook and its delivery log
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.dispatcher.Delete(chi.URLParam(r, "id")); err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Webhook deleted. It won't be calling again"})
+}
+
+// Deliveries returns a webhook's most recent deliveries, newest first
+func (h *WebhookHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	limit := defaultDeliveryLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			respondError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.dispatcher.Deliveries(chi.URLParam(r, "id"), limit)
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusOK, deliveries)
+}
+
+// Redeliver sends a past delivery's event again. It is delivered in the
+// background, as a new delivery.
+func (h *WebhookHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	delivery, err := h.dispatcher.Redeliver(chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID"))
+	if err != nil {
+		respondWebhookError(w, err)
+		return
+	}
+	respondJSON(w, http.StatusAccepted, delivery)
+}
+
+// respondWebhookError maps webhook errors to responses
+func respondWebhookError(w http.ResponseWriter, err error) {
+	switch err {
+	case models.ErrWebhookNotFound:
+		respondError(w, http.StatusNotFound, "No such webhook. You're shouting into the void")
+	case models.ErrDeliveryNotFound:
+		respondError(w, http.StatusNotFound, "No such delivery. Check the log before asking for a repeat")
+	case models.ErrInvalidWebhook:
+		respondError(w, http.StatusBadRequest, err.Error())
+	default:
+		respondError(w, http.StatusInternalServerError, "Something broke. Probably your fault somehow")
+	}
+}
@@ -14,9 +14,12 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"strings"
 
+	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/audit"
 	"github.com/anubhavg-icpl/agni/internal/auth"
 	"github.com/anubhavg-icpl/agni/internal/vm"
 	"github.com/anubhavg-icpl/agni/pkg/models"
@@ -37,18 +40,32 @@ var upgrader = websocket.Upgrader{
 type WebSocketHandler struct {
 	vmManager   *vm.Manager
 	authService *auth.Service
+	auditLog    *audit.Log
 }
 
-// NewWebSocketHandler creates a new WebSocketHandler
-func NewWebSocketHandler(vmManager *vm.Manager, authService *auth.Service) *WebSocketHandler {
+// NewWebSocketHandler creates a new WebSocketHandler. Console sessions are
+// recorded in auditLog.
+func NewWebSocketHandler(vmManager *vm.Manager, authService *auth.Service, auditLog *audit.Log) *WebSocketHandler {
 	return &WebSocketHandler{
 		vmManager:   vmManager,
 		authService: authService,
+		auditLog:    auditLog,
 	}
 }
 
-// StreamLogs streams logs for a VM via WebSocket
-func (h *WebSocketHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+// recordConsole records a user attaching to or detaching from a console
+func (h *WebSocketHandler) recordConsole(r *http.Request, user *models.User, action string) {
+	entry := middleware.NewAuditEntry(r, action)
+	middleware.SetAuditUser(entry, user)
+	entry.TargetID = chi.URLParam(r, "id")
+	entry.SetStatus(http.StatusSwitchingProtocols)
+	h.auditLog.Record(entry)
+}
+
+// authenticate validates the token from the query param or Authorization
+// header and returns the caller, writing an error response if it is missing
+// or invalid
+func (h *WebSocketHandler) authenticate(w http.ResponseWriter, r *http.Request) *models.User {
 	// Authenticate via query param or header
 	token := r.URL.Query().Get("token")
 	if token == "" {
@@ -60,12 +77,37 @@ func (h *WebSocketHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
 
 	if token == "" {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
+		return nil
 	}
 
-	_, err := h.authService.ValidateToken(token)
+	claims, err := h.authService.ValidateToken(token)
 	if err != nil {
 		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil
+	}
+	user, err := h.authService.GetUser(claims.UserID)
+	if err != nil {
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
+		return nil
+	}
+	return user
+}
+
+// authorize checks that the caller may access a VM, writing an error
+// response if not. Other users' VMs are reported as missing.
+func (h *WebSocketHandler) authorize(w http.ResponseWriter, user *models.User, vmID string) bool {
+	vm, err := h.vmManager.Get(vmID)
+	if err != nil || !middleware.CanAccess(user, vm.OwnerID) {
+		http.Error(w, "VM not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// StreamLogs streams logs for a VM via WebSocket
+func (h *WebSocketHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	user := h.authenticate(w, r)
+	if user == nil {
 		return
 	}
 
@@ -76,10 +118,8 @@ func (h *WebSocketHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check VM exists
-	_, err = h.vmManager.Get(vmID)
-	if err != nil {
-		http.Error(w, "VM not found", http.StatusNotFound)
+	// Check VM exists and belongs to the caller
+	if !h.authorize(w, user, vmID) {
 		return
 	}
 
@@ -142,3 +182,108 @@ func (h *WebSocketHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 }
+
+// Console attaches to a VM's serial console via WebSocket. Output is sent as
+// binary frames; input arrives as binary frames or ConsoleMessage text frames.
+func (h *WebSocketHandler) Console(w http.ResponseWriter, r *http.Request) {
+	user := h.authenticate(w, r)
+	if user == nil {
+		return
+	}
+
+	// Get VM ID
+	vmID := chi.URLParam(r, "id")
+	if vmID == "" {
+		http.Error(w, "VM ID required", http.StatusBadRequest)
+		return
+	}
+	if !h.authorize(w, user, vmID) {
+		return
+	}
+
+	console, err := h.vmManager.Console(vmID)
+	if err != nil {
+		switch err {
+		case models.ErrVMNotFound:
+			http.Error(w, "VM not found", http.StatusNotFound)
+		case models.ErrVMNotRunning:
+			http.Error(w, "VM is not running", http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusConflict)
+		}
+		return
+	}
+
+	// Upgrade to WebSocket
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	clientID, output, scrollback := console.Attach()
+	h.recordConsole(r, user, models.AuditConsoleAttach)
+	defer func() {
+		console.Detach(clientID)
+		h.recordConsole(r, user, models.AuditConsoleDetach)
+	}()
+
+	if len(scrollback) > 0 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, scrollback); err != nil {
+			return
+		}
+	}
+
+	done := make(chan struct{})
+
+	// Forward keystrokes and resize requests to the console
+	go func() {
+		defer close(done)
+		for {
+			msgType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			if msgType == websocket.BinaryMessage {
+				if _, err := console.Write(msg); err != nil {
+					return
+				}
+				continue
+			}
+
+			var ctrl models.ConsoleMessage
+			if err := json.Unmarshal(msg, &ctrl); err != nil {
+				continue
+			}
+			switch ctrl.Type {
+			case "input":
+				if _, err := console.Write([]byte(ctrl.Data)); err != nil {
+					return
+				}
+			case "resize":
+				if ctrl.Cols > 0 && ctrl.Rows > 0 {
+					_ = console.Resize(ctrl.Cols, ctrl.Rows)
+				}
+			}
+		}
+	}()
+
+	// Send console output
+	for {
+		select {
+		case data, ok := <-output:
+			if !ok {
+				// Console closed, the VM has stopped
+				_ = conn.WriteMessage(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseNormalClosure, "console closed"))
+				return
+			}
+			if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/anubhavg-icpl/agni/internal/audit"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AuditContextKey holds the audit entry of the current request
+const AuditContextKey contextKey = "audit"
+
+// auditActions names the actions of mutating routes. Routes missing here
+// are recorded as their method and pattern.
+var auditActions = map[string]string{
+	"POST /api/auth/refresh":  "auth.refresh",
+	"POST /api/auth/logout":   "auth.logout",
+	"POST /api/auth/password": models.AuditPasswordChange,
+
+	"POST /api/vms":                              "vm.create",
+	"POST /api/vms:start":                        "vm.bulk-start",
+	"POST /api/vms:stop":                         "vm.bulk-stop",
+	"POST /api/vms:shutdown":                     "vm.bulk-shutdown",
+	"POST /api/vms:delete":                       "vm.bulk-delete",
+	"PUT /api/vms/{id}":                          "vm.update",
+	"DELETE /api/vms/{id}":                       "vm.delete",
+	"POST /api/vms/{id}/start":                   "vm.start",
+	"POST /api/vms/{id}/stop":                    "vm.stop",
+	"POST /api/vms/{id}/shutdown":                "vm.shutdown",
+	"POST /api/vms/{id}/pause":                   "vm.pause",
+	"POST /api/vms/{id}/resume":                  "vm.resume",
+	"PATCH /api/vms/{id}/rate-limiters":          "vm.rate-limiters",
+	"POST /api/vms/{id}/clone":                   "vm.clone",
+	"PUT /api/vms/{id}/metadata":                 "vm.metadata",
+	"PATCH /api/vms/{id}/metadata":               "vm.metadata",
+	"PATCH /api/vms/{id}/balloon":                "vm.balloon",
+	"POST /api/vms/{id}/snapshots":               "snapshot.create",
+	"POST /api/vms/{id}/snapshots/{sid}/restore": "snapshot.restore",
+
+	"POST /api/images":             "image.register",
+	"POST /api/images/build":       "image.build",
+	"PATCH /api/images/{id}":       "image.update",
+	"DELETE /api/images/{id}":      "image.delete",
+	"POST /api/images/{id}/verify": "image.verify",
+
+	"POST /api/configs":        "config.create",
+	"PUT /api/configs/{id}":    "config.update",
+	"DELETE /api/configs/{id}": "config.delete",
+
+	"POST /api/users":           "user.create",
+	"PUT /api/users/{id}/quota": "user.quota",
+
+	"POST /api/webhooks":                                        "webhook.create",
+	"PUT /api/webhooks/{id}":                                    "webhook.update",
+	"DELETE /api/webhooks/{id}":                                 "webhook.delete",
+	"POST /api/webhooks/{id}/deliveries/{deliveryID}/redeliver": "webhook.redeliver",
+}
+
+// Audit returns a middleware that records every mutating request in the
+// audit log. It runs before JWTAuth so requests rejected for a missing or
+// invalid token are recorded too, with AuditUnknownUser as the user.
+func Audit(log *audit.Log) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := NewAuditEntry(r, "")
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), AuditContextKey, entry)))
+
+			// The route is only known once chi has matched it
+			pattern := r.Method + " " + r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				pattern = r.Method + " " + rctx.RoutePattern()
+				if entry.TargetID == "" {
+					entry.TargetID = rctx.URLParam("id")
+				}
+			}
+			entry.Action = auditActions[pattern]
+			if entry.Action == "" {
+				entry.Action = pattern
+			}
+			if entry.UserID == "" {
+				entry.Username = models.AuditUnknownUser
+			}
+			entry.SetStatus(ww.Status())
+
+			log.Record(entry)
+		})
+	}
+}
+
+// NewAuditEntry starts an audit entry for an action taken by a request
+func NewAuditEntry(r *http.Request, action string) *models.AuditEntry {
+	entry := &models.AuditEntry{
+		Action:    action,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		RequestID: middleware.GetReqID(r.Context()),
+		SourceIP:  r.RemoteAddr,
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		entry.SourceIP = host
+	}
+	if user := GetUser(r.Context()); user != nil {
+		SetAuditUser(entry, user)
+	}
+	return entry
+}
+
+// SetAuditUser records the user who made a request
+func SetAuditUser(entry *models.AuditEntry, user *models.User) {
+	entry.UserID = user.ID
+	entry.Username = user.Username
+	entry.Role = user.Role
+}
+
+// SetAuditTarget records the ID of the resource a request acted on, for
+// requests that create one
+func SetAuditTarget(r *http.Request, id string) {
+	if entry, ok := r.Context().Value(AuditContextKey).(*models.AuditEntry); ok {
+		entry.TargetID = id
+	}
+}
+
+// SetAuditChanges records the changes a request made to a resource
+func SetAuditChanges(r *http.Request, from, to any) {
+	if entry, ok := r.Context().Value(AuditContextKey).(*models.AuditEntry); ok {
+		entry.Changes = audit.Diff(from, to)
+	}
+}
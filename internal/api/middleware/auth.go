@@ -64,6 +64,11 @@ func JWTAuth(authService *auth.Service) func(next http.Handler) http.Handler {
 				return
 			}
 
+			// Audit runs first, tell it who is asking
+			if entry, ok := r.Context().Value(AuditContextKey).(*models.AuditEntry); ok {
+				SetAuditUser(entry, user)
+			}
+
 			// Add claims and user to context
 			ctx := context.WithValue(r.Context(), ClaimsContextKey, claims)
 			ctx = context.WithValue(ctx, UserContextKey, user)
@@ -101,6 +106,31 @@ func RequireAdmin(next http.Handler) http.Handler {
 	})
 }
 
+// CanAccess reports whether a user may see and manage a resource owned by
+// ownerID. Admins may access everything, including unowned resources.
+func CanAccess(user *models.User, ownerID string) bool {
+	if user == nil {
+		return false
+	}
+	return user.IsAdmin() || (ownerID != "" && ownerID == user.ID)
+}
+
+// RequireOwner returns a middleware that hides resources of other users from
+// non-admins, as if they did not exist. owner looks up the owner of the
+// resource a request is for; lookup errors are left to the handler.
+func RequireOwner(owner func(r *http.Request) (string, error), notFound string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ownerID, err := owner(r)
+			if err == nil && !CanAccess(GetUser(r.Context()), ownerID) {
+				respondError(w, http.StatusNotFound, notFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // respondError sends a JSON error response
 func respondError(w http.ResponseWriter, status int, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -24,20 +24,26 @@ import (
 
 	"github.com/anubhavg-icpl/agni/internal/api/handlers"
 	"github.com/anubhavg-icpl/agni/internal/api/middleware"
+	"github.com/anubhavg-icpl/agni/internal/audit"
 	"github.com/anubhavg-icpl/agni/internal/auth"
 	"github.com/anubhavg-icpl/agni/internal/logging"
 	"github.com/anubhavg-icpl/agni/internal/storage"
 	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/internal/webhook"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 )
 
+// eventsPath streams lifecycle events for as long as clients stay connected
+const eventsPath = "/api/events"
+
 // ServerConfig holds configuration for the API server
 type ServerConfig struct {
 	Address    string
 	JWTSecret  string
 	VMManager  *vm.Manager
 	Store      *storage.Store
+	Webhooks   *webhook.Dispatcher
 	EnableCORS bool
 	RateLimit  int
 	Assets     *embed.FS // Embedded frontend assets (optional)
@@ -50,6 +56,7 @@ type Server struct {
 	config      ServerConfig
 	vmManager   *vm.Manager
 	authService *auth.Service
+	auditLog    *audit.Log
 	logger      *logging.Logger
 	startTime   time.Time
 }
@@ -64,6 +71,7 @@ func NewServer(cfg ServerConfig) *Server {
 		config:      cfg,
 		vmManager:   cfg.VMManager,
 		authService: authService,
+		auditLog:    audit.NewLog(cfg.Store),
 		logger:      logging.GetLogger().WithComponent("api-server"),
 		startTime:   time.Now(),
 	}
@@ -98,8 +106,18 @@ func (s *Server) setupMiddleware() {
 		s.router.Use(middleware.RateLimit(s.config.RateLimit))
 	}
 
-	// Timeout
-	s.router.Use(chimiddleware.Timeout(60 * time.Second))
+	// Timeout, except for the event stream, which would be cut off with it
+	timeout := chimiddleware.Timeout(60 * time.Second)
+	s.router.Use(func(next http.Handler) http.Handler {
+		limited := timeout(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == eventsPath {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(w, r)
+		})
+	})
 }
 
 // setupRoutes configures API routes
@@ -110,45 +128,133 @@ func (s *Server) setupRoutes() {
 	s.router.Get("/api/system/info", healthHandler.SystemInfo)
 
 	// Auth routes
-	authHandler := handlers.NewAuthHandler(s.authService)
+	authHandler := handlers.NewAuthHandler(s.authService, s.auditLog)
 	s.router.Post("/api/auth/setup", authHandler.Setup)
 	s.router.Post("/api/auth/login", authHandler.Login)
 	s.router.Get("/api/auth/status", authHandler.Status)
 
 	// Protected routes
 	s.router.Group(func(r chi.Router) {
+		r.Use(middleware.Audit(s.auditLog))
 		r.Use(middleware.JWTAuth(s.authService))
 
 		// Auth
 		r.Get("/api/auth/me", authHandler.Me)
 		r.Post("/api/auth/refresh", authHandler.Refresh)
 		r.Post("/api/auth/logout", authHandler.Logout)
+		r.Post("/api/auth/password", authHandler.ChangePassword)
 
 		// VMs
 		vmHandler := handlers.NewVMHandler(s.vmManager)
 		r.Get("/api/vms", vmHandler.List)
 		r.Post("/api/vms", vmHandler.Create)
-		r.Get("/api/vms/{id}", vmHandler.Get)
-		r.Put("/api/vms/{id}", vmHandler.Update)
-		r.Delete("/api/vms/{id}", vmHandler.Delete)
-		r.Post("/api/vms/{id}/start", vmHandler.Start)
-		r.Post("/api/vms/{id}/stop", vmHandler.Stop)
-		r.Post("/api/vms/{id}/shutdown", vmHandler.Shutdown)
-		r.Get("/api/vms/{id}/metrics", vmHandler.Metrics)
+
+		// Bulk actions on VMs matching a label selector
+		r.Post("/api/vms:start", vmHandler.BulkStart)
+		r.Post("/api/vms:stop", vmHandler.BulkStop)
+		r.Post("/api/vms:shutdown", vmHandler.BulkShutdown)
+		r.Post("/api/vms:delete", vmHandler.BulkDelete)
+
+		// A single VM is only visible to its owner and admins
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireOwner(s.vmOwner, "VM not found. Either it never existed or it ghosted you"))
+
+			r.Get("/api/vms/{id}", vmHandler.Get)
+			r.Put("/api/vms/{id}", vmHandler.Update)
+			r.Delete("/api/vms/{id}", vmHandler.Delete)
+			r.Post("/api/vms/{id}/start", vmHandler.Start)
+			r.Post("/api/vms/{id}/stop", vmHandler.Stop)
+			r.Post("/api/vms/{id}/shutdown", vmHandler.Shutdown)
+			r.Post("/api/vms/{id}/pause", vmHandler.Pause)
+			r.Post("/api/vms/{id}/resume", vmHandler.Resume)
+			r.Get("/api/vms/{id}/metrics", vmHandler.Metrics)
+			r.Patch("/api/vms/{id}/rate-limiters", vmHandler.UpdateRateLimiters)
+			r.Post("/api/vms/{id}/clone", vmHandler.Clone)
+
+			// Snapshots
+			snapshotHandler := handlers.NewSnapshotHandler(s.vmManager)
+			r.Get("/api/vms/{id}/snapshots", snapshotHandler.List)
+			r.Post("/api/vms/{id}/snapshots", snapshotHandler.Create)
+			r.Post("/api/vms/{id}/snapshots/{sid}/restore", snapshotHandler.Restore)
+
+			// MMDS metadata
+			metadataHandler := handlers.NewMetadataHandler(s.vmManager)
+			r.Get("/api/vms/{id}/metadata", metadataHandler.Get)
+			r.Put("/api/vms/{id}/metadata", metadataHandler.Put)
+			r.Patch("/api/vms/{id}/metadata", metadataHandler.Patch)
+
+			// Memory balloon
+			balloonHandler := handlers.NewBalloonHandler(s.vmManager)
+			r.Patch("/api/vms/{id}/balloon", balloonHandler.Update)
+			r.Get("/api/vms/{id}/balloon/stats", balloonHandler.Stats)
+		})
+
+		// Images; everyone may boot them, but registering and building reads
+		// and writes host files as root, so only admins manage them
+		imageHandler := handlers.NewImageHandler(s.vmManager.Images())
+		r.Get("/api/images", imageHandler.List)
+		r.Get("/api/images/{id}", imageHandler.Get)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireAdmin)
+
+			r.Post("/api/images", imageHandler.Register)
+			r.Post("/api/images/build", imageHandler.Build)
+			r.Patch("/api/images/{id}", imageHandler.Update)
+			r.Delete("/api/images/{id}", imageHandler.Delete)
+			r.Post("/api/images/{id}/verify", imageHandler.Verify)
+		})
 
 		// Configs
 		configStore := storage.NewConfigStore(s.config.Store)
 		configHandler := handlers.NewConfigHandler(configStore)
 		r.Get("/api/configs", configHandler.List)
 		r.Post("/api/configs", configHandler.Create)
-		r.Get("/api/configs/{id}", configHandler.Get)
-		r.Put("/api/configs/{id}", configHandler.Update)
-		r.Delete("/api/configs/{id}", configHandler.Delete)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireOwner(func(r *http.Request) (string, error) {
+				config, err := configStore.Get(chi.URLParam(r, "id"))
+				if err != nil {
+					return "", err
+				}
+				return config.OwnerID, nil
+			}, "Configuration not found"))
+
+			r.Get("/api/configs/{id}", configHandler.Get)
+			r.Put("/api/configs/{id}", configHandler.Update)
+			r.Delete("/api/configs/{id}", configHandler.Delete)
+		})
+
+		// Users; everyone may look at their own quota
+		userHandler := handlers.NewUserHandler(s.authService, s.vmManager)
+		r.Get("/api/users/{id}/quota", userHandler.Quota)
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.RequireAdmin)
+
+			r.Get("/api/users", userHandler.List)
+			r.Post("/api/users", userHandler.Create)
+			r.Put("/api/users/{id}/quota", userHandler.UpdateQuota)
+
+			webhookHandler := handlers.NewWebhookHandler(s.config.Webhooks)
+			r.Get("/api/webhooks", webhookHandler.List)
+			r.Post("/api/webhooks", webhookHandler.Create)
+			r.Get("/api/webhooks/{id}", webhookHandler.Get)
+			r.Put("/api/webhooks/{id}", webhookHandler.Update)
+			r.Delete("/api/webhooks/{id}", webhookHandler.Delete)
+			r.Get("/api/webhooks/{id}/deliveries", webhookHandler.Deliveries)
+			r.Post("/api/webhooks/{id}/deliveries/{deliveryID}/redeliver", webhookHandler.Redeliver)
+
+			auditHandler := handlers.NewAuditHandler(s.auditLog)
+			r.Get("/api/audit", auditHandler.List)
+			r.Get("/api/audit/export", auditHandler.Export)
+		})
 	})
 
 	// WebSocket routes (with auth check in handler)
-	wsHandler := handlers.NewWebSocketHandler(s.vmManager, s.authService)
+	wsHandler := handlers.NewWebSocketHandler(s.vmManager, s.authService, s.auditLog)
 	s.router.Get("/api/vms/{id}/logs", wsHandler.StreamLogs)
+	s.router.Get("/api/vms/{id}/console", wsHandler.Console)
+
+	// Lifecycle events as server-sent events or over a WebSocket
+	s.router.Get(eventsPath, wsHandler.Events)
 
 	// Serve embedded frontend assets if available
 	if s.config.Assets != nil {
@@ -156,6 +262,15 @@ func (s *Server) setupRoutes() {
 	}
 }
 
+// vmOwner returns the owner of the VM a request is for
+func (s *Server) vmOwner(r *http.Request) (string, error) {
+	vm, err := s.vmManager.Get(chi.URLParam(r, "id"))
+	if err != nil {
+		return "", err
+	}
+	return vm.OwnerID, nil
+}
+
 // serveStaticFiles serves the embedded frontend assets
 func (s *Server) serveStaticFiles() {
 	// Get the sub-filesystem for the dist directory
@@ -302,6 +417,15 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return nil
 }
 
+// Close closes the server's listener and connections without waiting for
+// requests to finish
+func (s *Server) Close() error {
+	if s.httpServer != nil {
+		return s.httpServer.Close()
+	}
+	return nil
+}
+
 // Router returns the chi router (for Wails integration)
 func (s *Server) Router() *chi.Mux {
 	return s.router
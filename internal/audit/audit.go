@@ -0,0 +1,141 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package audit keeps a persistent record of who changed what through the
+// API, and of every authentication attempt.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// Log records audit entries
+type Log struct {
+	store  *storage.AuditStore
+	logger *logging.Logger
+}
+
+// NewLog creates a new audit Log
+func NewLog(store *storage.Store) *Log {
+	return &Log{
+		store:  storage.NewAuditStore(store),
+		logger: logging.GetLogger().WithComponent("audit"),
+	}
+}
+
+// Record appends an entry to the log. Failing to record never fails the
+// action, the entry goes to the regular log instead.
+func (l *Log) Record(entry *models.AuditEntry) {
+	if err := l.store.Append(entry); err != nil {
+		l.logger.Error().Err(err).
+			Str("action", entry.Action).
+			Str("user", entry.Username).
+			Str("target_id", entry.TargetID).
+			Str("result", string(entry.Result)).
+			Msg("Failed to record audit entry")
+	}
+}
+
+// Before returns up to limit entries matching filter with a sequence number
+// below before, newest first. A before of 0 starts at the newest entry.
+func (l *Log) Before(filter models.AuditFilter, before uint64, limit int) ([]*models.AuditEntry, error) {
+	return l.store.Before(filter, before, limit)
+}
+
+// After returns up to limit entries matching filter with a sequence number
+// above after, oldest first
+func (l *Log) After(filter models.AuditFilter, after uint64, limit int) ([]*models.AuditEntry, error) {
+	return l.store.After(filter, after, limit)
+}
+
+// Diff returns the fields that differ between the JSON encodings of from
+// and to, sorted by name. Objects are compared field by field, anything else,
+// arrays included, as a whole. updated_at is left out, it changes every time.
+func Diff(from, to any) []models.AuditChange {
+	before, err := flatten(from)
+	if err != nil {
+		return nil
+	}
+	after, err := flatten(to)
+	if err != nil {
+		return nil
+	}
+
+	var changes []models.AuditChange
+	for field, value := range before {
+		if !bytes.Equal(value, after[field]) {
+			changes = append(changes, models.AuditChange{Field: field, Old: value, New: after[field]})
+		}
+	}
+	for field, value := range after {
+		if _, ok := before[field]; !ok {
+			changes = append(changes, models.AuditChange{Field: field, New: value})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// flatten encodes v as JSON and maps the path of every non-object value to
+// its compact encoding
+func flatten(v any) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var root any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	var walk func(prefix string, value any) error
+	walk = func(prefix string, value any) error {
+		if object, ok := value.(map[string]any); ok && len(object) > 0 {
+			for key, child := range object {
+				if prefix == "" && key == "updated_at" {
+					continue
+				}
+				path := key
+				if prefix != "" {
+					path = prefix + "." + key
+				}
+				if err := walk(path, child); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// Re-encoding sorts object keys, so equal values encode equally
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		fields[prefix] = encoded
+		return nil
+	}
+
+	if err := walk("", root); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestLog(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	log := NewLog(store)
+
+	start := time.Now()
+	for _, entry := range []*models.AuditEntry{
+		{Username: "alice", Action: models.AuditLogin, Result: models.AuditFailure},
+		{UserID: "u-1", Username: "alice", Action: models.AuditLogin, Result: models.AuditSuccess},
+		{UserID: "u-2", Username: "bob", Action: "vm.start", TargetID: "vm-1", Result: models.AuditSuccess},
+		{UserID: "u-1", Username: "alice", Action: "vm.delete", TargetID: "vm-1", Result: models.AuditSuccess},
+	} {
+		log.Record(entry)
+	}
+
+	// Newest first, paging with the last sequence number seen
+	page, err := log.Before(models.AuditFilter{}, 0, 3)
+	if err != nil || len(page) != 3 || page[0].Sequence != 4 || page[2].Sequence != 2 {
+		t.Fatalf("Before() = %+v, %v", page, err)
+	}
+	if rest, err := log.Before(models.AuditFilter{}, page[2].Sequence, 3); err != nil || len(rest) != 1 || rest[0].Sequence != 1 {
+		t.Errorf("Before() second page = %+v, %v", rest, err)
+	}
+
+	// Users match by name, which failed logins only have, or by ID
+	alice, err := log.After(models.AuditFilter{User: "alice"}, 0, 10)
+	if err != nil || len(alice) != 3 || alice[0].Result != models.AuditFailure {
+		t.Errorf("After() for alice = %+v, %v", alice, err)
+	}
+	if byID, _ := log.Before(models.AuditFilter{User: "u-2", Action: "vm.start"}, 0, 10); len(byID) != 1 || byID[0].Username != "bob" {
+		t.Errorf("Before() for u-2 = %+v", byID)
+	}
+
+	if since, _ := log.After(models.AuditFilter{Since: start}, 0, 10); len(since) != 4 {
+		t.Errorf("After() since the start = %d entries, want 4", len(since))
+	}
+	if until, _ := log.Before(models.AuditFilter{Until: start}, 0, 10); len(until) != 0 {
+		t.Errorf("Before() until the start = %d entries, want 0", len(until))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := models.ConfigTemplate{
+		Name:      "web",
+		Labels:    map[string]string{"tier": "web"},
+		Config:    models.VMConfig{CPUs: 1, MemoryMB: 512},
+		UpdatedAt: time.Unix(1, 0),
+	}
+	updated := old
+	updated.Labels = map[string]string{"tier": "db"}
+	updated.Config.CPUs = 2
+	updated.UpdatedAt = time.Unix(2, 0)
+
+	changes := Diff(old, updated)
+	if len(changes) != 2 {
+		t.Fatalf("Diff() = %+v, want 2 changes", changes)
+	}
+	if changes[0].Field != "config.cpus" || string(changes[0].Old) != "1" || string(changes[0].New) != "2" {
+		t.Errorf("Diff()[0] = %+v", changes[0])
+	}
+	if changes[1].Field != "labels.tier" || string(changes[1].Old) != `"web"` || string(changes[1].New) != `"db"` {
+		t.Errorf("Diff()[1] = %+v", changes[1])
+	}
+
+	if changes := Diff(old, old); len(changes) != 0 {
+		t.Errorf("Diff() of equal values = %+v", changes)
+	}
+}
@@ -143,6 +143,40 @@ func (s *Service) CreateUser(username, password string, role models.UserRole) (*
 	return user, nil
 }
 
+// ListUsersPage returns one sorted page of the users accepted by match and
+// the number of matches
+func (s *Service) ListUsersPage(opts storage.PageOptions, match func(*models.User) bool) ([]*models.User, int, error) {
+	return s.userStore.ListPage(opts, match)
+}
+
+// SetQuota replaces a user's quota, nil removes it
+func (s *Service) SetQuota(userID string, quota *models.UserQuota) (*models.User, error) {
+	if err := ValidateQuota(quota); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userStore.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Quota = quota
+	if err := s.userStore.Update(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ValidateQuota rejects negative quota limits
+func ValidateQuota(quota *models.UserQuota) error {
+	if quota == nil {
+		return nil
+	}
+	if quota.MaxVMs < 0 || quota.MaxCPUs < 0 || quota.MaxMemoryMB < 0 || quota.MaxDiskMB < 0 {
+		return models.ErrInvalidQuota
+	}
+	return nil
+}
+
 // ChangePassword changes a user's password
 func (s *Service) ChangePassword(userID, currentPassword, newPassword string) error {
 	user, err := s.userStore.Get(userID)
@@ -21,29 +21,52 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/anubhavg-icpl/agni/internal/api"
 	"github.com/anubhavg-icpl/agni/internal/auth"
 	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/network"
 	"github.com/anubhavg-icpl/agni/internal/storage"
 	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/internal/webhook"
 )
 
+// defaultAutostartDelay spaces out autostarted VMs so they don't all boot at once
+const defaultAutostartDelay = 2 * time.Second
+
+// apiShutdownTimeout bounds how long requests get to finish on shutdown
+const apiShutdownTimeout = 10 * time.Second
+
 // Config holds the GUI launcher configuration
 type Config struct {
-	Port    string
-	DataDir string
-	Logger  *logging.Logger
-	Assets  *embed.FS // Embedded frontend assets (optional)
+	Port           string
+	DataDir        string
+	Network        network.Config
+	AutostartDelay time.Duration // Pause between autostarted VMs
+	StopTimeout    time.Duration // How long VMs get to shut down with the daemon
+	Admission      vm.AdmissionConfig
+	Jailer         vm.JailerSettings // Jailer binary and chroot base for jailed VMs
+	Webhooks       webhook.Config    // Retry policy for webhook deliveries
+	Logger         *logging.Logger
+	Assets         *embed.FS // Embedded frontend assets (optional)
 }
 
 // DefaultConfig returns a default configuration
 func DefaultConfig() Config {
 	return Config{
-		Port:    "8080",
-		DataDir: GetDataDir(),
-		Logger:  nil,
+		Port:           "8080",
+		DataDir:        GetDataDir(),
+		Network:        GetNetworkConfig(),
+		AutostartDelay: GetAutostartDelay(),
+		StopTimeout:    GetStopTimeout(),
+		Admission:      GetAdmissionConfig(),
+		Jailer:         GetJailerSettings(),
+		Webhooks:       webhook.DefaultConfig(),
+		Logger:         nil,
 	}
 }
 
@@ -53,7 +76,10 @@ type Launcher struct {
 	logger    *logging.Logger
 	store     *storage.Store
 	vmManager *vm.Manager
+	webhooks  *webhook.Dispatcher
 	apiServer *api.Server
+
+	cancelAutostart context.CancelFunc
 }
 
 // NewLauncher creates a new GUI launcher
@@ -93,6 +119,27 @@ func (l *Launcher) Start() error {
 
 	// Initialize VM manager
 	l.vmManager = vm.NewManager(store)
+	l.vmManager.SetAdmission(l.config.Admission)
+	l.vmManager.SetJailer(l.config.Jailer)
+
+	// VMs with pre-created taps work without managed networking
+	netManager, err := network.NewManager(l.config.Network, store)
+	if err != nil {
+		l.logger.Warn().Err(err).Msg("Managed networking disabled")
+	} else {
+		l.vmManager.SetNetwork(netManager)
+	}
+
+	// Deliver lifecycle events to webhooks, including those from reconciling
+	l.webhooks = webhook.NewDispatcher(store, l.vmManager.Events(), l.config.Webhooks)
+	if err := l.webhooks.Start(); err != nil {
+		l.logger.Warn().Err(err).Msg("Failed to start webhook deliveries")
+	}
+
+	// Re-attach to VMs that survived a daemon restart
+	if err := l.vmManager.Reconcile(context.Background()); err != nil {
+		l.logger.Warn().Err(err).Msg("Failed to reconcile VM state")
+	}
 
 	// Initialize API server
 	l.apiServer = api.NewServer(api.ServerConfig{
@@ -100,6 +147,7 @@ func (l *Launcher) Start() error {
 		JWTSecret:  jwtSecret,
 		VMManager:  l.vmManager,
 		Store:      store,
+		Webhooks:   l.webhooks,
 		EnableCORS: true,
 		RateLimit:  100,
 		Assets:     l.config.Assets,
@@ -120,6 +168,15 @@ func (l *Launcher) Start() error {
 		l.logger.Info().Msg("Initial setup required. Create admin user at POST /api/auth/setup")
 	}
 
+	// Bring up autostart VMs in the background, the API is usable meanwhile
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancelAutostart = cancel
+	go func() {
+		if err := l.vmManager.Autostart(ctx, l.config.AutostartDelay); err != nil && err != context.Canceled {
+			l.logger.Error().Err(err).Msg("Failed to autostart VMs")
+		}
+	}()
+
 	return nil
 }
 
@@ -127,12 +184,36 @@ func (l *Launcher) Start() error {
 func (l *Launcher) Stop() {
 	l.logger.Info().Msg("Shutting down...")
 
+	if l.cancelAutostart != nil {
+		l.cancelAutostart()
+	}
+
+	// Guests get a chance to power off, whatever is left is stopped hard
 	if l.vmManager != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), l.config.StopTimeout)
+		l.vmManager.ShutdownAll(ctx)
+		cancel()
 		l.vmManager.StopAll()
 	}
 
+	// Event streams would hold the server's shutdown open
+	if l.vmManager != nil {
+		l.vmManager.Events().Close()
+	}
+
+	// No more redeliveries once webhooks stop
 	if l.apiServer != nil {
-		_ = l.apiServer.Shutdown(context.Background())
+		ctx, cancel := context.WithTimeout(context.Background(), apiShutdownTimeout)
+		if err := l.apiServer.Shutdown(ctx); err != nil {
+			l.logger.Warn().Err(err).Msg("API server did not shut down in time, closing connections")
+			_ = l.apiServer.Close()
+		}
+		cancel()
+	}
+
+	// Deliveries still waiting for a retry resume on the next start
+	if l.webhooks != nil {
+		l.webhooks.Stop()
 	}
 
 	if l.store != nil {
@@ -202,6 +283,92 @@ func GetDataDir() string {
 	return filepath.Join(home, ".local", "share", "agni")
 }
 
+// GetNetworkConfig returns the managed networking configuration, taken from
+// AGNI_BRIDGE and AGNI_SUBNET if set
+func GetNetworkConfig() network.Config {
+	cfg := network.DefaultConfig()
+	if bridge := os.Getenv("AGNI_BRIDGE"); bridge != "" {
+		cfg.Bridge = bridge
+	}
+	if subnet := os.Getenv("AGNI_SUBNET"); subnet != "" {
+		cfg.Subnet = subnet
+	}
+	return cfg
+}
+
+// GetAutostartDelay returns the pause between autostarted VMs, taken from
+// AGNI_AUTOSTART_DELAY if set
+func GetAutostartDelay() time.Duration {
+	if value := os.Getenv("AGNI_AUTOSTART_DELAY"); value != "" {
+		if delay, err := time.ParseDuration(value); err == nil && delay >= 0 {
+			return delay
+		}
+	}
+	return defaultAutostartDelay
+}
+
+// GetStopTimeout returns how long running VMs get to shut down with the
+// daemon, taken from AGNI_STOP_TIMEOUT if set
+func GetStopTimeout() time.Duration {
+	if value := os.Getenv("AGNI_STOP_TIMEOUT"); value != "" {
+		if timeout, err := time.ParseDuration(value); err == nil && timeout >= 0 {
+			return timeout
+		}
+	}
+	return vm.DefaultShutdownTimeout
+}
+
+// GetAdmissionConfig returns the limits on resources committed to running
+// VMs, taken from AGNI_CPU_OVERCOMMIT, AGNI_MEMORY_OVERCOMMIT and
+// AGNI_RESERVED_MEMORY_MB if set
+func GetAdmissionConfig() vm.AdmissionConfig {
+	cfg := vm.DefaultAdmissionConfig()
+	if value := os.Getenv("AGNI_CPU_OVERCOMMIT"); value != "" {
+		if ratio, err := strconv.ParseFloat(value, 64); err == nil && ratio >= 0 {
+			cfg.CPUOvercommit = ratio
+		}
+	}
+	if value := os.Getenv("AGNI_MEMORY_OVERCOMMIT"); value != "" {
+		if ratio, err := strconv.ParseFloat(value, 64); err == nil && ratio >= 0 {
+			cfg.MemoryOvercommit = ratio
+		}
+	}
+	if value := os.Getenv("AGNI_RESERVED_MEMORY_MB"); value != "" {
+		if reserved, err := strconv.ParseInt(value, 10, 64); err == nil && reserved >= 0 {
+			cfg.ReservedMemoryMB = reserved
+		}
+	}
+	return cfg
+}
+
+// GetJailerSettings returns the jailer paths and users for jailed VMs, taken
+// from AGNI_JAILER_BINARY, AGNI_CHROOT_BASE_DIR, AGNI_JAILER_UIDS and
+// AGNI_JAILER_GIDS if set
+func GetJailerSettings() vm.JailerSettings {
+	cfg := vm.DefaultJailerSettings()
+	if binary := os.Getenv("AGNI_JAILER_BINARY"); binary != "" {
+		cfg.Binary = binary
+	}
+	if base := os.Getenv("AGNI_CHROOT_BASE_DIR"); base != "" && filepath.IsAbs(base) {
+		cfg.ChrootBaseDir = filepath.Clean(base)
+	}
+	cfg.UIDs = parseIDs(os.Getenv("AGNI_JAILER_UIDS"))
+	cfg.GIDs = parseIDs(os.Getenv("AGNI_JAILER_GIDS"))
+	return cfg
+}
+
+// parseIDs parses a comma-separated list of user or group IDs, skipping
+// anything that is not one
+func parseIDs(value string) []int {
+	var ids []int
+	for _, field := range strings.Split(value, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && id >= 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 // PrintHelp prints help for GUI mode
 func PrintHelp() {
 	fmt.Print(`
@@ -215,6 +382,29 @@ Options:
   --port PORT      API server port (default: 8080)
   --data-dir DIR   Data directory (default: ~/.local/share/agni)
 
+Environment:
+  AGNI_BRIDGE      Bridge for managed NICs (default: agni0)
+  AGNI_SUBNET      Guest address pool for managed NICs (default: 172.30.0.0/24)
+  AGNI_AUTOSTART_DELAY
+                   Pause between autostarted VMs (default: 2s)
+  AGNI_STOP_TIMEOUT
+                   How long VMs get to shut down with agni (default: 30s)
+  AGNI_CPU_OVERCOMMIT
+                   vCPUs running VMs may have per host CPU, 0 for no limit
+                   (default: 4)
+  AGNI_MEMORY_OVERCOMMIT
+                   Guest memory per MiB of host memory, 0 for no limit
+                   (default: 1)
+  AGNI_RESERVED_MEMORY_MB
+                   Host memory never given to VMs (default: 512)
+  AGNI_JAILER_BINARY
+                   Jailer binary for jailed VMs (default: jailer)
+  AGNI_CHROOT_BASE_DIR
+                   Where jailed VMs get their chroots (default: /srv/jailer)
+  AGNI_JAILER_UIDS, AGNI_JAILER_GIDS
+                   Comma-separated users and groups jailed VMs may run as
+                   (default: none, jailed VMs are refused)
+
 The GUI provides a web-based interface for managing Firecracker VMs.
 Access the interface at http://localhost:8080 after starting.
 `)
@@ -0,0 +1,337 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package image
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// OCI media types of nested indexes, such as multi-platform images
+const (
+	mediaTypeOCIIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeDockerIndex = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+	annotationRefName       = "org.opencontainers.image.ref.name"
+	annotationContainerdRef = "io.containerd.image.name"
+)
+
+// containerImage is an image found in a docker save or OCI layout archive
+type containerImage struct {
+	layers []string // Layer files, bottom layer first
+	config imageConfig
+}
+
+// imageConfig holds the parts of an image config that matter for a rootfs
+type imageConfig struct {
+	Architecture string `json:"architecture"`
+	Config       struct {
+		Env        []string `json:"Env"`
+		Entrypoint []string `json:"Entrypoint"`
+		Cmd        []string `json:"Cmd"`
+		WorkingDir string   `json:"WorkingDir"`
+	} `json:"config"`
+}
+
+// ociDescriptor points at a blob in an OCI layout
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *struct {
+		Architecture string `json:"architecture"`
+	} `json:"platform,omitempty"`
+}
+
+// ociIndex is an OCI image index, or a Docker manifest list
+type ociIndex struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+// ociManifest is an OCI image manifest
+type ociManifest struct {
+	Config ociDescriptor   `json:"config"`
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// dockerManifest is an entry of a docker save manifest.json
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// extractArchive unpacks an image archive into dir. Only regular files,
+// directories and symlinks that stay within dir are extracted; docker save
+// links duplicate layers. Entries are never written through a symlink.
+func extractArchive(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidImageArchive, err)
+		}
+
+		name, err := cleanEntry(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		parent := path.Dir(name)
+		if parent == "." {
+			parent = ""
+		}
+		if err := ensureParents(dir, parent); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, name)
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.Mkdir(target, 0750); err != nil && !os.IsExist(err) {
+				return err
+			}
+			if fi, err := os.Lstat(target); err != nil || !fi.IsDir() {
+				return fmt.Errorf("%w: %s is not a directory", models.ErrInvalidImageArchive, hdr.Name)
+			}
+		case tar.TypeReg:
+			if err := removeEntry(target); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0640)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(out, tr)
+			if closeErr := out.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			resolved := filepath.Join(filepath.Dir(name), hdr.Linkname)
+			if filepath.IsAbs(hdr.Linkname) || resolved == ".." || strings.HasPrefix(resolved, "../") {
+				return fmt.Errorf("%w: %s links outside the archive", models.ErrInvalidImageArchive, hdr.Name)
+			}
+			if err := removeEntry(target); err != nil {
+				return err
+			}
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// removeEntry removes a file or symlink an earlier archive entry left at
+// target, so it can be replaced without following it
+func removeEntry(target string) error {
+	fi, err := os.Lstat(target)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return fmt.Errorf("%w: %s is a directory", models.ErrInvalidImageArchive, filepath.Base(target))
+	}
+	return os.Remove(target)
+}
+
+// loadImage finds an image in an extracted docker save or OCI layout
+// archive. ref selects an image by tag or OCI ref name; an empty ref picks
+// the first image.
+func loadImage(dir, ref string) (*containerImage, error) {
+	if _, err := os.Stat(filepath.Join(dir, "manifest.json")); err == nil {
+		return loadDockerImage(dir, ref)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err == nil {
+		return loadOCIImage(dir, ref)
+	}
+	return nil, fmt.Errorf("%w: neither manifest.json nor index.json found", models.ErrInvalidImageArchive)
+}
+
+// loadDockerImage reads an image from a docker save archive
+func loadDockerImage(dir, ref string) (*containerImage, error) {
+	var manifests []dockerManifest
+	if err := readJSON(dir, "manifest.json", &manifests); err != nil {
+		return nil, err
+	}
+
+	for _, m := range manifests {
+		if ref != "" && !containsString(m.RepoTags, ref) {
+			continue
+		}
+
+		image := &containerImage{}
+		if err := readJSON(dir, m.Config, &image.config); err != nil {
+			return nil, err
+		}
+		for _, layer := range m.Layers {
+			path, err := archivePath(dir, layer)
+			if err != nil {
+				return nil, err
+			}
+			image.layers = append(image.layers, path)
+		}
+		return image, nil
+	}
+	return nil, fmt.Errorf("%w: image %q not found", models.ErrInvalidImageArchive, ref)
+}
+
+// loadOCIImage reads an image from an OCI layout, descending into
+// multi-platform indexes to the manifest for the host architecture
+func loadOCIImage(dir, ref string) (*containerImage, error) {
+	var index ociIndex
+	if err := readJSON(dir, "index.json", &index); err != nil {
+		return nil, err
+	}
+
+	var desc *ociDescriptor
+	for i, d := range index.Manifests {
+		if ref == "" || d.Annotations[annotationRefName] == ref || d.Annotations[annotationContainerdRef] == ref {
+			desc = &index.Manifests[i]
+			break
+		}
+	}
+	if desc == nil {
+		return nil, fmt.Errorf("%w: image %q not found", models.ErrInvalidImageArchive, ref)
+	}
+
+	for desc.MediaType == mediaTypeOCIIndex || desc.MediaType == mediaTypeDockerIndex {
+		var nested ociIndex
+		if err := readJSON(dir, blobPath(desc.Digest), &nested); err != nil {
+			return nil, err
+		}
+		desc = platformManifest(nested.Manifests)
+		if desc == nil {
+			return nil, fmt.Errorf("%w: no manifest for %s", models.ErrInvalidImageArchive, HostArch())
+		}
+	}
+
+	var manifest ociManifest
+	if err := readJSON(dir, blobPath(desc.Digest), &manifest); err != nil {
+		return nil, err
+	}
+
+	image := &containerImage{}
+	if err := readJSON(dir, blobPath(manifest.Config.Digest), &image.config); err != nil {
+		return nil, err
+	}
+	for _, layer := range manifest.Layers {
+		path, err := archivePath(dir, blobPath(layer.Digest))
+		if err != nil {
+			return nil, err
+		}
+		image.layers = append(image.layers, path)
+	}
+	return image, nil
+}
+
+// platformManifest picks the manifest for the host architecture
+func platformManifest(manifests []ociDescriptor) *ociDescriptor {
+	for i, m := range manifests {
+		if m.Platform != nil && ociArch(m.Platform.Architecture) == HostArch() {
+			return &manifests[i]
+		}
+	}
+	return nil
+}
+
+// ociArch converts an OCI architecture to Firecracker's naming
+func ociArch(arch string) string {
+	switch arch {
+	case "amd64":
+		return ArchX86_64
+	case "arm64":
+		return ArchAarch64
+	}
+	return arch
+}
+
+// blobPath returns where an OCI layout keeps a blob
+func blobPath(digest string) string {
+	return filepath.Join("blobs", strings.Replace(digest, ":", "/", 1))
+}
+
+// archivePath joins a path from an archive's metadata to dir, refusing
+// paths outside of it. Symlinks are resolved, since a chain of links that
+// each look local can still lead out of dir.
+func archivePath(dir, name string) (string, error) {
+	clean, err := cleanEntry(name)
+	if err != nil || clean == "" {
+		return "", fmt.Errorf("%w: invalid path %q", models.ErrInvalidImageArchive, name)
+	}
+
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, clean))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", models.ErrInvalidImageArchive, err)
+	}
+	if !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %q resolves outside the archive", models.ErrInvalidImageArchive, name)
+	}
+	return resolved, nil
+}
+
+// readJSON decodes a JSON file of an extracted archive
+func readJSON(dir, name string, v any) error {
+	path, err := archivePath(dir, name)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrInvalidImageArchive, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %s: %v", models.ErrInvalidImageArchive, name, err)
+	}
+	return nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,285 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package image
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = ".wh..wh..opq" // Hides everything lower layers put in the directory
+
+	xattrPAXPrefix = "SCHILY.xattr."
+)
+
+// applyLayerFile applies a layer blob, which may be gzip compressed, to root
+func applyLayerFile(root, layer string) error {
+	f, err := os.Open(layer)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidImageArchive, err)
+		}
+		defer gz.Close()
+		return applyLayer(root, gz)
+	case len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		return fmt.Errorf("%w: zstd compressed layers are not supported", models.ErrInvalidImageArchive)
+	}
+	return applyLayer(root, br)
+}
+
+// applyLayer extracts a layer tar on top of the lower layers already in
+// root, applying whiteouts. Paths are never resolved through symlinks, so a
+// layer cannot write outside root. Owners, device nodes and extended
+// attributes need root privileges and are skipped without them.
+func applyLayer(root string, r io.Reader) error {
+	// Entries of this layer survive an opaque whiteout of their directory
+	added := make(map[string]bool)
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", models.ErrInvalidImageArchive, err)
+		}
+
+		name, err := cleanEntry(hdr.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+		dir, base := path.Split(name)
+		dir = strings.TrimSuffix(dir, "/")
+
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			// Nothing to hide if lower layers don't have the directory
+			if err := checkParents(root, dir); err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+			if base == whiteoutOpaque {
+				err = clearDir(root, dir, added)
+			} else {
+				err = os.RemoveAll(filepath.Join(root, dir, strings.TrimPrefix(base, whiteoutPrefix)))
+			}
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := ensureParents(root, dir); err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, name)
+		if err := extractEntry(root, target, hdr, tr); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+		added[name] = true
+	}
+}
+
+// extractEntry creates a single layer entry, replacing what lower layers
+// had at its path. Directories are merged instead.
+func extractEntry(root, target string, hdr *tar.Header, r io.Reader) error {
+	if fi, err := os.Lstat(target); err == nil {
+		if !(fi.IsDir() && hdr.Typeflag == tar.TypeDir) {
+			if err := os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	mode := hdr.FileInfo().Mode()
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(target, 0755); err != nil && !os.IsExist(err) {
+			return err
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		return setOwner(target, hdr, os.Symlink(hdr.Linkname, target))
+	case tar.TypeLink:
+		source, err := cleanEntry(hdr.Linkname)
+		if err != nil || source == "" {
+			return fmt.Errorf("%w: invalid hard link %q", models.ErrInvalidImageArchive, hdr.Linkname)
+		}
+		if err := checkParents(root, path.Dir(source)); err != nil {
+			return err
+		}
+		// The link shares the source's metadata
+		return os.Link(filepath.Join(root, source), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		kind := uint32(unix.S_IFIFO)
+		if hdr.Typeflag == tar.TypeChar {
+			kind = unix.S_IFCHR
+		} else if hdr.Typeflag == tar.TypeBlock {
+			kind = unix.S_IFBLK
+		}
+		dev := unix.Mkdev(uint32(hdr.Devmajor), uint32(hdr.Devminor))
+		if err := unix.Mknod(target, kind|uint32(mode.Perm()), int(dev)); err != nil {
+			if errors.Is(err, unix.EPERM) {
+				return nil
+			}
+			return err
+		}
+	default:
+		// Nothing else belongs in a root filesystem
+		return nil
+	}
+
+	if err := setOwner(target, hdr, nil); err != nil {
+		return err
+	}
+	// After chown, which clears setuid and setgid
+	if err := os.Chmod(target, mode&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky)); err != nil {
+		return err
+	}
+	for key, value := range hdr.PAXRecords {
+		if strings.HasPrefix(key, xattrPAXPrefix) {
+			_ = unix.Lsetxattr(target, strings.TrimPrefix(key, xattrPAXPrefix), []byte(value), 0)
+		}
+	}
+	return os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+}
+
+// setOwner gives an extracted entry the owner recorded in the layer, unless
+// creating it failed. Lacking the privileges to chown is not an error.
+func setOwner(target string, hdr *tar.Header, createErr error) error {
+	if createErr != nil {
+		return createErr
+	}
+	if err := os.Lchown(target, hdr.Uid, hdr.Gid); err != nil && !errors.Is(err, unix.EPERM) {
+		return err
+	}
+	return nil
+}
+
+// ensureParents creates the directories leading to dir below root. Each
+// existing component must be a real directory, not a symlink.
+func ensureParents(root, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	current := root
+	for _, part := range strings.Split(dir, "/") {
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			if err := os.Mkdir(current, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%w: %s is not a directory", models.ErrInvalidImageArchive, strings.TrimPrefix(current, root))
+		}
+	}
+	return nil
+}
+
+// checkParents makes sure dir below root can be used without following symlinks
+func checkParents(root, dir string) error {
+	current := root
+	for _, part := range strings.Split(dir, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = filepath.Join(current, part)
+		fi, err := os.Lstat(current)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%w: %s is not a directory", models.ErrInvalidImageArchive, strings.TrimPrefix(current, root))
+		}
+	}
+	return nil
+}
+
+// clearDir removes the contents of a directory that came from lower layers
+func clearDir(root, dir string, added map[string]bool) error {
+	entries, err := os.ReadDir(filepath.Join(root, dir))
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.Name())
+		if added[name] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanEntry normalizes a tar entry name to a relative slash separated path,
+// "" for the root itself. Names escaping the root are rejected.
+func cleanEntry(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if strings.Contains(name, "..") {
+		// Clean resolved any .. against the root; reject rather than guess
+		for _, part := range strings.Split(name, "/") {
+			if part == ".." {
+				return "", fmt.Errorf("%w: %q escapes the root", models.ErrInvalidImageArchive, name)
+			}
+		}
+	}
+	return strings.TrimPrefix(clean, "/"), nil
+}
@@ -0,0 +1,324 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+// Package image keeps a registry of kernels, initrds and root filesystems.
+// VM configs reference registered images by ID; before a VM boots the
+// registry fills in the image paths and verifies their checksums. Writable
+// root filesystems are copied per VM and only verified when copied.
+package image
+
+import (
+	"crypto/sha256"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Architectures as Firecracker names them
+const (
+	ArchX86_64  = "x86_64"
+	ArchAarch64 = "aarch64"
+)
+
+// Registry manages registered images
+type Registry struct {
+	dir    string // Where built images are kept
+	images *storage.ImageStore
+	vms    *storage.VMStore
+	logger *logging.Logger
+}
+
+// NewRegistry creates a new image Registry
+func NewRegistry(store *storage.Store) *Registry {
+	return &Registry{
+		dir:    filepath.Join(filepath.Dir(store.Path()), "images"),
+		images: storage.NewImageStore(store),
+		vms:    storage.NewVMStore(store),
+		logger: logging.GetLogger().WithComponent("images"),
+	}
+}
+
+// Register records an image file with its size and SHA-256 checksum. The
+// architecture of ELF kernels is detected when not given.
+func (r *Registry) Register(req models.RegisterImageRequest) (*models.Image, error) {
+	switch req.Type {
+	case models.ImageTypeKernel, models.ImageTypeInitrd, models.ImageTypeRootfs:
+	default:
+		return nil, models.ErrInvalidImage
+	}
+	if req.Name == "" || !filepath.IsAbs(req.Path) {
+		return nil, models.ErrInvalidImage
+	}
+
+	info, err := os.Stat(req.Path)
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, models.ErrInvalidImage
+	}
+
+	arch := req.Arch
+	if arch == "" && req.Type == models.ImageTypeKernel {
+		arch = elfArch(req.Path)
+	}
+	if arch != "" && arch != ArchX86_64 && arch != ArchAarch64 {
+		return nil, models.ErrInvalidImage
+	}
+
+	sum, err := hashFile(req.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum image: %w", err)
+	}
+	if req.SHA256 != "" && !strings.EqualFold(req.SHA256, sum) {
+		return nil, models.ErrImageChecksumMismatch
+	}
+
+	image := &models.Image{
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Type:        req.Type,
+		Arch:        arch,
+		Path:        filepath.Clean(req.Path),
+		SHA256:      sum,
+		Size:        info.Size(),
+		Labels:      req.Labels,
+		Description: req.Description,
+	}
+	if err := r.images.Create(image); err != nil {
+		return nil, err
+	}
+
+	r.logger.Info().Str("image_id", image.ID).Str("name", image.Name).Str("type", string(image.Type)).Msg("Image registered")
+	return image, nil
+}
+
+// Get returns an image by ID
+func (r *Registry) Get(id string) (*models.Image, error) {
+	return r.images.Get(id)
+}
+
+// List returns the registered images, optionally only those of one type and
+// architecture
+func (r *Registry) List(imageType models.ImageType, arch string) ([]*models.Image, error) {
+	images, err := r.images.List()
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := make([]*models.Image, 0, len(images))
+	for _, image := range images {
+		if (imageType == "" || image.Type == imageType) && (arch == "" || image.Arch == arch) {
+			filtered = append(filtered, image)
+		}
+	}
+	return filtered, nil
+}
+
+// Update changes an image's name, description or labels. The file itself
+// cannot change; register a new image instead.
+func (r *Registry) Update(id string, req models.UpdateImageRequest) (*models.Image, error) {
+	image, err := r.images.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != "" {
+		image.Name = req.Name
+	}
+	if req.Description != "" {
+		image.Description = req.Description
+	}
+	if req.Labels != nil {
+		image.Labels = req.Labels
+	}
+
+	if err := r.images.Update(image); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// Delete removes an image from the registry, leaving the file alone. Images
+// still referenced by a VM cannot be deleted.
+func (r *Registry) Delete(id string) error {
+	if _, err := r.images.Get(id); err != nil {
+		return err
+	}
+
+	users, err := r.Users(id)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		return models.ErrImageInUse
+	}
+
+	if err := r.images.Delete(id); err != nil {
+		return err
+	}
+	r.logger.Info().Str("image_id", id).Msg("Image deleted")
+	return nil
+}
+
+// Users returns the IDs of the VMs referencing an image
+func (r *Registry) Users(id string) ([]string, error) {
+	vms, err := r.vms.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, vm := range vms {
+		cfg := &vm.Config
+		if cfg.KernelImageID == id || cfg.InitrdImageID == id || cfg.RootfsImageID == id {
+			users = append(users, vm.ID)
+		}
+	}
+	return users, nil
+}
+
+// Verify checks an image file against its recorded checksum
+func (r *Registry) Verify(id string) (*models.Image, error) {
+	image, err := r.images.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return image, verify(image)
+}
+
+// Resolve fills in the paths of the images a VM config references, after
+// checking they exist and have the right type. Checksums are not verified,
+// that is left to Prepare right before boot.
+func (r *Registry) Resolve(cfg *models.VMConfig) error {
+	_, err := r.resolve(cfg)
+	return err
+}
+
+// Prepare resolves the images a VM config references and verifies that
+// they match the host architecture and their checksums
+func (r *Registry) Prepare(cfg *models.VMConfig) error {
+	images, err := r.resolve(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		if image.Arch != "" && image.Arch != HostArch() {
+			return models.ErrImageArchMismatch
+		}
+		if err := verify(image); err != nil {
+			r.logger.Error().Err(err).Str("image_id", image.ID).Str("path", image.Path).Msg("Image failed verification")
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve looks up the images referenced by a VM config and fills in their paths
+func (r *Registry) resolve(cfg *models.VMConfig) ([]*models.Image, error) {
+	refs := []struct {
+		id        string
+		imageType models.ImageType
+		path      *string
+	}{
+		{cfg.KernelImageID, models.ImageTypeKernel, &cfg.KernelPath},
+		{cfg.InitrdImageID, models.ImageTypeInitrd, &cfg.InitrdPath},
+		{cfg.RootfsImageID, models.ImageTypeRootfs, &cfg.RootDrive.Path},
+	}
+
+	var images []*models.Image
+	for _, ref := range refs {
+		if ref.id == "" {
+			continue
+		}
+		image, err := r.images.Get(ref.id)
+		if err != nil {
+			return nil, err
+		}
+		if image.Type != ref.imageType {
+			return nil, models.ErrImageTypeMismatch
+		}
+		*ref.path = image.Path
+		images = append(images, image)
+	}
+	return images, nil
+}
+
+// verify checks that an image file still has its recorded checksum
+func verify(image *models.Image) error {
+	return VerifyFile(image, image.Path)
+}
+
+// VerifyFile checks that path, such as a copy of an image, has the image's
+// recorded checksum
+func VerifyFile(image *models.Image, path string) error {
+	sum, err := hashFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to checksum image %s: %w", image.Name, err)
+	}
+	if sum != image.SHA256 {
+		return models.ErrImageChecksumMismatch
+	}
+	return nil
+}
+
+// hashFile returns the hex encoded SHA-256 of a file
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// elfArch returns the architecture of an uncompressed ELF kernel, or "" if
+// the file is not one
+func elfArch(path string) string {
+	f, err := elf.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	switch f.Machine {
+	case elf.EM_X86_64:
+		return ArchX86_64
+	case elf.EM_AARCH64:
+		return ArchAarch64
+	}
+	return ""
+}
+
+// HostArch returns the architecture of the host in Firecracker's naming
+func HostArch() string {
+	switch runtime.GOARCH {
+	case "amd64":
+		return ArchX86_64
+	case "arm64":
+		return ArchAarch64
+	}
+	return runtime.GOARCH
+}
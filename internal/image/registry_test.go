@@ -0,0 +1,73 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package image
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	r := NewRegistry(store)
+
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(rootfs, []byte("not really ext4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Register(models.RegisterImageRequest{Name: "rootfs", Type: models.ImageTypeRootfs, Path: rootfs, SHA256: "00"}); err != models.ErrImageChecksumMismatch {
+		t.Fatalf("Register() with a wrong checksum error = %v, want %v", err, models.ErrImageChecksumMismatch)
+	}
+
+	img, err := r.Register(models.RegisterImageRequest{Name: "rootfs", Type: models.ImageTypeRootfs, Path: rootfs})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if img.Size != 15 || len(img.SHA256) != 64 {
+		t.Errorf("Register() = %+v", img)
+	}
+
+	cfg := models.VMConfig{KernelImageID: img.ID}
+	if err := r.Resolve(&cfg); err != models.ErrImageTypeMismatch {
+		t.Errorf("Resolve() of a rootfs as kernel error = %v, want %v", err, models.ErrImageTypeMismatch)
+	}
+
+	cfg = models.VMConfig{RootfsImageID: img.ID}
+	if err := r.Prepare(&cfg); err != nil || cfg.RootDrive.Path != rootfs {
+		t.Fatalf("Prepare() = %q, %v, want %q", cfg.RootDrive.Path, err, rootfs)
+	}
+
+	if err := storage.NewVMStore(store).Create(&models.VM{ID: "vm-1", Config: cfg}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Delete(img.ID); err != models.ErrImageInUse {
+		t.Errorf("Delete() of a used image error = %v, want %v", err, models.ErrImageInUse)
+	}
+
+	if err := os.WriteFile(rootfs, []byte("tampered with..."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Prepare(&cfg); err != models.ErrImageChecksumMismatch {
+		t.Errorf("Prepare() of a changed image error = %v, want %v", err, models.ErrImageChecksumMismatch)
+	}
+}
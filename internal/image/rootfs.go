@@ -0,0 +1,305 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package image
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/google/uuid"
+)
+
+const (
+	// InitPath is where the generated init is installed; boot with init=InitPath
+	InitPath = "/sbin/agni-init"
+
+	// Automatic sizing leaves room for the guest to write
+	minRootfsSizeMiB  = 64
+	rootfsHeadroomMiB = 64
+	inodeOverhead     = 4096
+
+	mkfsBinary = "mkfs.ext4"
+)
+
+// BuildOptions configure building a root filesystem from a container image
+type BuildOptions struct {
+	Source       string   // docker save or OCI layout tarball
+	Reference    string   // Image in the tarball; the first one if empty
+	Output       string   // ext4 image to create, must not exist
+	SizeMiB      int64    // 0 sizes the filesystem to its contents plus headroom
+	Init         bool     // Install InitPath, running the image's entrypoint
+	InitCommands []string // Shell commands InitPath runs before the entrypoint
+}
+
+// BuildResult describes a built root filesystem
+type BuildResult struct {
+	Path    string
+	SizeMiB int64
+	Arch    string // Architecture of the container image, if it says
+}
+
+// BuildRootfs flattens the layers of a container image and writes them to
+// a new ext4 image. Run as root so that file owners and device nodes are
+// preserved.
+func BuildRootfs(ctx context.Context, opts BuildOptions) (*BuildResult, error) {
+	if opts.Source == "" || opts.Output == "" || opts.SizeMiB < 0 {
+		return nil, models.ErrInvalidImage
+	}
+	if _, err := exec.LookPath(mkfsBinary); err != nil {
+		return nil, fmt.Errorf("%s is required to build root filesystems: %w", mkfsBinary, err)
+	}
+
+	work, err := os.MkdirTemp(filepath.Dir(opts.Output), ".agni-rootfs-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	archive := filepath.Join(work, "archive")
+	root := filepath.Join(work, "rootfs")
+	for _, dir := range []string{archive, root} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := extractArchive(opts.Source, archive); err != nil {
+		return nil, err
+	}
+	image, err := loadImage(archive, opts.Reference)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range image.layers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := applyLayerFile(root, layer); err != nil {
+			return nil, err
+		}
+	}
+	// The layers are no longer needed, free the space before mkfs
+	_ = os.RemoveAll(archive)
+
+	// Mount points the kernel and init expect
+	for _, dir := range []string{"dev", "proc", "sys", "run", "tmp"} {
+		if err := ensureParents(root, dir); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Init {
+		if err := installInit(root, &image.config, opts.InitCommands); err != nil {
+			return nil, err
+		}
+	}
+
+	size := opts.SizeMiB
+	if size == 0 {
+		if size, err = rootfsSize(root); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := makeExt4(ctx, root, opts.Output, size); err != nil {
+		return nil, err
+	}
+
+	return &BuildResult{
+		Path:    opts.Output,
+		SizeMiB: size,
+		Arch:    ociArch(image.config.Architecture),
+	}, nil
+}
+
+// Build builds a root filesystem from a container image tarball and
+// registers it. Without an output path the image is kept in the registry's
+// data directory.
+func (r *Registry) Build(ctx context.Context, req models.BuildRootfsRequest) (*models.Image, error) {
+	// The daemon's working directory is no place to resolve paths against
+	if req.Name == "" || !filepath.IsAbs(req.Source) || (req.Output != "" && !filepath.IsAbs(req.Output)) {
+		return nil, models.ErrInvalidImage
+	}
+
+	output := req.Output
+	if output == "" {
+		if err := os.MkdirAll(r.dir, 0750); err != nil {
+			return nil, err
+		}
+		output = filepath.Join(r.dir, uuid.New().String()+".ext4")
+	}
+
+	result, err := BuildRootfs(ctx, BuildOptions{
+		Source:       req.Source,
+		Reference:    req.Reference,
+		Output:       output,
+		SizeMiB:      req.SizeMiB,
+		Init:         req.Init,
+		InitCommands: req.InitCommands,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{"source": filepath.Base(req.Source)}
+	if req.Reference != "" {
+		labels["reference"] = req.Reference
+	}
+	if req.Init {
+		labels["init"] = InitPath
+	}
+	for k, v := range req.Labels {
+		labels[k] = v
+	}
+
+	image, err := r.Register(models.RegisterImageRequest{
+		Name:        req.Name,
+		Type:        models.ImageTypeRootfs,
+		Arch:        result.Arch,
+		Path:        result.Path,
+		Labels:      labels,
+		Description: req.Description,
+	})
+	if err != nil {
+		_ = os.Remove(result.Path)
+		return nil, err
+	}
+	return image, nil
+}
+
+// rootfsSize returns a filesystem size in MiB that fits the tree at root
+// with headroom
+func rootfsSize(root string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		total += inodeOverhead
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			total += (info.Size() + inodeOverhead - 1) / inodeOverhead * inodeOverhead
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	size := total*5/4/(1<<20) + rootfsHeadroomMiB
+	if size < minRootfsSizeMiB {
+		size = minRootfsSizeMiB
+	}
+	return size, nil
+}
+
+// makeExt4 creates an ext4 image of sizeMiB populated from root
+func makeExt4(ctx context.Context, root, output string, sizeMiB int64) error {
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(sizeMiB << 20)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, mkfsBinary, "-q", "-F", "-L", "rootfs", "-d", root, output)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(output)
+		return fmt.Errorf("%s failed: %w: %s", mkfsBinary, err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// envName matches variable names a shell can export
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// installInit writes an init script that prepares the pseudo filesystems a
+// container runtime would provide and execs the image's entrypoint
+func installInit(root string, cfg *imageConfig, commands []string) error {
+	if _, err := os.Lstat(filepath.Join(root, "bin", "sh")); err != nil {
+		return models.ErrRootfsNoShell
+	}
+	if err := ensureParents(root, "sbin"); err != nil {
+		return err
+	}
+
+	target := filepath.Join(root, strings.TrimPrefix(InitPath, "/"))
+	if err := os.RemoveAll(target); err != nil {
+		return err
+	}
+	return os.WriteFile(target, []byte(initScript(cfg, commands)), 0755)
+}
+
+// initScript renders the init script for an image config
+func initScript(cfg *imageConfig, commands []string) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# Generated by agni: runs the container image's entrypoint as PID 1\n")
+	b.WriteString("mount -t proc proc /proc 2>/dev/null\n")
+	b.WriteString("mount -t sysfs sysfs /sys 2>/dev/null\n")
+	b.WriteString("mount -t devtmpfs devtmpfs /dev 2>/dev/null\n")
+	b.WriteString("mkdir -p /dev/pts && mount -t devpts devpts /dev/pts 2>/dev/null\n")
+	b.WriteString("mount -t tmpfs tmpfs /run 2>/dev/null\n")
+	b.WriteString("mount -t tmpfs tmpfs /tmp 2>/dev/null\n")
+
+	for _, env := range cfg.Config.Env {
+		name, value, ok := strings.Cut(env, "=")
+		if ok && envName.MatchString(name) {
+			fmt.Fprintf(&b, "export %s=%s\n", name, shellQuote(value))
+		}
+	}
+	if cfg.Config.WorkingDir != "" {
+		fmt.Fprintf(&b, "cd %s\n", shellQuote(cfg.Config.WorkingDir))
+	}
+
+	for _, command := range commands {
+		b.WriteString(command + "\n")
+	}
+
+	args := append(append([]string{}, cfg.Config.Entrypoint...), cfg.Config.Cmd...)
+	if len(args) == 0 {
+		args = []string{"/bin/sh"}
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	fmt.Fprintf(&b, "exec %s\n", strings.Join(quoted, " "))
+	return b.String()
+}
+
+// shellQuote quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,198 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// tarEntry is a file in a test layer, a directory if the name ends in /,
+// or a symlink if link is set
+type tarEntry struct {
+	name, body, link string
+}
+
+func makeTar(t *testing.T, entries ...tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.body))}
+		if strings.HasSuffix(e.name, "/") {
+			hdr = &tar.Header{Name: e.name, Mode: 0755, Typeflag: tar.TypeDir}
+		} else if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Mode: 0777, Typeflag: tar.TypeSymlink, Linkname: e.link}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractArchiveSymlinkEscape(t *testing.T) {
+	base := t.TempDir()
+	dir := filepath.Join(base, "extract")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each link looks local on its own, but l/x resolves to base
+	archive := filepath.Join(base, "image.tar")
+	if err := os.WriteFile(archive, makeTar(t,
+		tarEntry{name: "l", link: "."},
+		tarEntry{name: "l/x", link: ".."},
+		tarEntry{name: "l/x/escaped.txt", body: "pwned"},
+	), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractArchive(archive, dir); !errors.Is(err, models.ErrInvalidImageArchive) {
+		t.Errorf("extractArchive() error = %v, want %v", err, models.ErrInvalidImageArchive)
+	}
+	if _, err := os.Lstat(filepath.Join(base, "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("escaped.txt was written outside the extraction dir: %v", err)
+	}
+
+	// Reading through a link chain is refused as well
+	if err := os.Symlink("l/..", filepath.Join(dir, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := archivePath(dir, "up/image.tar"); !errors.Is(err, models.ErrInvalidImageArchive) {
+		t.Errorf("archivePath() through a link chain error = %v, want %v", err, models.ErrInvalidImageArchive)
+	}
+}
+
+func TestApplyLayerWhiteouts(t *testing.T) {
+	root := t.TempDir()
+
+	lower := makeTar(t,
+		tarEntry{name: "etc/"},
+		tarEntry{name: "etc/hostname", body: "lower"},
+		tarEntry{name: "etc/motd", body: "hello"},
+		tarEntry{name: "var/cache/"},
+		tarEntry{name: "var/cache/a", body: "a"},
+	)
+	upper := makeTar(t,
+		tarEntry{name: "etc/.wh.motd"},
+		tarEntry{name: "var/cache/"},
+		tarEntry{name: "var/cache/.wh..wh..opq"},
+		tarEntry{name: "var/cache/b", body: "b"},
+		tarEntry{name: "missing/.wh.file"},
+	)
+	for _, layer := range [][]byte{lower, upper} {
+		if err := applyLayer(root, bytes.NewReader(layer)); err != nil {
+			t.Fatalf("applyLayer() error = %v", err)
+		}
+	}
+
+	if data, err := os.ReadFile(filepath.Join(root, "etc/hostname")); err != nil || string(data) != "lower" {
+		t.Errorf("etc/hostname = %q, %v, want lower", data, err)
+	}
+	for _, gone := range []string{"etc/motd", "var/cache/a", "missing"} {
+		if _, err := os.Lstat(filepath.Join(root, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s exists after whiteout, error = %v", gone, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "var/cache/b")); err != nil {
+		t.Errorf("opaque directory lost the layer's own file: %v", err)
+	}
+
+	escape := makeTar(t, tarEntry{name: "../outside", body: "x"})
+	if err := applyLayer(root, bytes.NewReader(escape)); err == nil {
+		t.Errorf("applyLayer() accepted an entry outside the root")
+	}
+}
+
+func TestInitScript(t *testing.T) {
+	cfg := &imageConfig{}
+	cfg.Config.Env = []string{"GREETING=it's here"}
+	cfg.Config.Entrypoint = []string{"/bin/echo"}
+	cfg.Config.Cmd = []string{"hello world"}
+	cfg.Config.WorkingDir = "/srv"
+
+	script := initScript(cfg, []string{"hostname guest"})
+	for _, want := range []string{
+		`export GREETING='it'\''s here'`,
+		"cd '/srv'",
+		"hostname guest\n",
+		"exec '/bin/echo' 'hello world'",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("initScript() is missing %q:\n%s", want, script)
+		}
+	}
+
+	if script := initScript(&imageConfig{}, nil); !strings.Contains(script, "exec '/bin/sh'") {
+		t.Errorf("initScript() without an entrypoint does not start a shell:\n%s", script)
+	}
+}
+
+// TestBuildRootfs builds an ext4 image from a docker save style archive
+func TestBuildRootfs(t *testing.T) {
+	if _, err := exec.LookPath(mkfsBinary); err != nil {
+		t.Skipf("%s not available", mkfsBinary)
+	}
+	dir := t.TempDir()
+
+	manifest, _ := json.Marshal([]dockerManifest{{
+		Config:   "config.json",
+		RepoTags: []string{"test:latest"},
+		Layers:   []string{"layer.tar"},
+	}})
+	archive := makeTar(t,
+		tarEntry{name: "manifest.json", body: string(manifest)},
+		tarEntry{name: "config.json", body: `{"architecture":"amd64","config":{"Cmd":["/bin/sh"]}}`},
+		tarEntry{name: "layer.tar", body: string(makeTar(t,
+			tarEntry{name: "bin/"},
+			tarEntry{name: "bin/sh", body: "#!/bin/true"},
+		))},
+	)
+	source := filepath.Join(dir, "image.tar")
+	if err := os.WriteFile(source, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "rootfs.ext4")
+	result, err := BuildRootfs(context.Background(), BuildOptions{Source: source, Reference: "test:latest", Output: output, Init: true})
+	if err != nil {
+		t.Fatalf("BuildRootfs() error = %v", err)
+	}
+	if result.Arch != ArchX86_64 || result.SizeMiB != rootfsHeadroomMiB {
+		t.Errorf("BuildRootfs() = %+v", result)
+	}
+	if info, err := os.Stat(output); err != nil || info.Size() != result.SizeMiB<<20 {
+		t.Errorf("output size = %v, %v, want %d MiB", info, err, result.SizeMiB)
+	}
+
+	if _, err := BuildRootfs(context.Background(), BuildOptions{Source: source, Reference: "other:latest", Output: filepath.Join(dir, "other.ext4")}); err == nil {
+		t.Errorf("BuildRootfs() of a missing reference succeeded")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package network creates the host side of managed VM networking: a TAP
+// device per NIC, attached to a Linux bridge, with guest addresses allocated
+// from a subnet.
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	DefaultBridge = "agni0"
+	DefaultSubnet = "172.30.0.0/24"
+
+	// Interface names are limited to 15 characters: agni + 8 ID characters
+	// + -N leaves room for 100 NICs per VM
+	tapPrefix   = "agni"
+	tapIDLength = 8
+)
+
+// Config holds the managed networking configuration
+type Config struct {
+	Bridge      string
+	Subnet      string   // Guest pool; the first host address goes to the bridge
+	MTU         int      // 0 keeps the kernel default
+	Nameservers []string // Passed to guests in the ip= kernel argument, at most 2
+}
+
+// DefaultConfig returns a default configuration
+func DefaultConfig() Config {
+	return Config{
+		Bridge: DefaultBridge,
+		Subnet: DefaultSubnet,
+	}
+}
+
+// Manager creates TAP devices and hands out guest addresses
+type Manager struct {
+	config  Config
+	subnet  *net.IPNet
+	gateway net.IP
+	ips     *storage.IPStore
+	logger  *logging.Logger
+	mu      sync.Mutex // Serializes link changes
+}
+
+// NewManager creates a new network Manager. Nothing is changed on the host
+// until the first NIC is attached.
+func NewManager(cfg Config, store *storage.Store) (*Manager, error) {
+	if cfg.Bridge == "" {
+		cfg.Bridge = DefaultBridge
+	}
+	if cfg.Subnet == "" {
+		cfg.Subnet = DefaultSubnet
+	}
+	if len(cfg.Nameservers) > 2 {
+		return nil, fmt.Errorf("at most 2 nameservers are supported, got %d", len(cfg.Nameservers))
+	}
+
+	_, subnet, err := net.ParseCIDR(cfg.Subnet)
+	if err != nil || subnet.IP.To4() == nil {
+		return nil, models.ErrInvalidSubnet
+	}
+	// A /30 holds the network, the gateway, one guest and the broadcast address
+	if ones, _ := subnet.Mask.Size(); ones > 30 {
+		return nil, models.ErrInvalidSubnet
+	}
+
+	return &Manager{
+		config:  cfg,
+		subnet:  subnet,
+		gateway: addToIP(subnet.IP.To4(), 1),
+		ips:     storage.NewIPStore(store),
+		logger:  logging.GetLogger().WithComponent("network"),
+	}, nil
+}
+
+// Attach prepares the host side of a VM's managed NICs: it names their
+// devices after the VM, fills in missing MAC addresses, allocates guest addresses and creates the
+// TAP devices. Unmanaged NICs are returned unchanged. Attach is idempotent,
+// a VM keeps its devices and addresses until Release. Taps are owned by uid
+// so a jailed Firecracker can open them.
+func (m *Manager) Attach(vmID string, nics []models.NIC, uid int) ([]models.NIC, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attached := make([]models.NIC, len(nics))
+	copy(attached, nics)
+
+	// Never take over a tap that belongs to another VM or to the host
+	for i, nic := range attached {
+		if nic.Managed && nic.Device != "" && nic.Device != tapName(vmID, i) {
+			return nil, models.ErrManagedNICDevice
+		}
+	}
+
+	var bridge netlink.Link
+	for i := range attached {
+		nic := &attached[i]
+		if !nic.Managed {
+			continue
+		}
+
+		if bridge == nil {
+			var err error
+			if bridge, err = m.ensureBridge(); err != nil {
+				return nil, err
+			}
+		}
+
+		if nic.Device == "" {
+			nic.Device = tapName(vmID, i)
+		}
+		if nic.MacAddress == "" {
+			mac, err := RandomMAC()
+			if err != nil {
+				return nil, err
+			}
+			nic.MacAddress = mac
+		}
+
+		allocation, err := m.ips.Allocate(vmID, nic.Device, func(used map[string]bool) (string, error) {
+			ip, err := nextFreeIP(m.subnet, used)
+			if err != nil {
+				return "", err
+			}
+			return ip.String(), nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		ones, _ := m.subnet.Mask.Size()
+		nic.IPAddress = fmt.Sprintf("%s/%d", allocation.IP, ones)
+		nic.Gateway = m.gateway.String()
+
+		if err := m.ensureTap(nic.Device, bridge, uid); err != nil {
+			return nil, fmt.Errorf("failed to set up tap %s: %w", nic.Device, err)
+		}
+		m.logger.Debug().Str("vm_id", vmID).Str("device", nic.Device).Str("ip", nic.IPAddress).Msg("Managed NIC attached")
+	}
+
+	return attached, nil
+}
+
+// Release deletes the TAP devices of a VM's managed NICs and frees its
+// addresses. Devices not named after the VM are left alone.
+func (m *Manager) Release(vmID string, nics []models.NIC) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, nic := range nics {
+		// Only taps Attach named for this VM are deleted
+		if !nic.Managed || nic.Device != tapName(vmID, i) {
+			continue
+		}
+		link, err := netlink.LinkByName(nic.Device)
+		if err != nil {
+			continue
+		}
+		if err := netlink.LinkDel(link); err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vmID).Str("device", nic.Device).Msg("Failed to delete tap")
+		}
+	}
+
+	return m.ips.ReleaseByVM(vmID)
+}
+
+// KernelArgs adds an ip= argument for the first managed NIC with an address,
+// unless the kernel arguments already configure one. The kernel only applies
+// a single ip= argument, later NICs have to be configured by the guest.
+func (m *Manager) KernelArgs(opts string, nics []models.NIC) string {
+	for _, field := range strings.Fields(opts) {
+		if strings.HasPrefix(field, "ip=") {
+			return opts
+		}
+	}
+
+	for i, nic := range nics {
+		if !nic.Managed || nic.IPAddress == "" {
+			continue
+		}
+		arg, err := ipBootArg(nic, fmt.Sprintf("eth%d", i), m.config.Nameservers)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("device", nic.Device).Msg("Not passing guest address to kernel")
+			return opts
+		}
+		return strings.TrimSpace(opts + " " + arg)
+	}
+	return opts
+}
+
+// ensureBridge creates the bridge if needed, gives it the gateway address
+// and brings it up
+func (m *Manager) ensureBridge() (netlink.Link, error) {
+	bridge, err := netlink.LinkByName(m.config.Bridge)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if !errors.As(err, &notFound) {
+			return nil, fmt.Errorf("failed to look up bridge %s: %w", m.config.Bridge, err)
+		}
+
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = m.config.Bridge
+		attrs.MTU = m.config.MTU
+		if err := netlink.LinkAdd(&netlink.Bridge{LinkAttrs: attrs}); err != nil {
+			return nil, fmt.Errorf("failed to create bridge %s: %w", m.config.Bridge, err)
+		}
+		if bridge, err = netlink.LinkByName(m.config.Bridge); err != nil {
+			return nil, err
+		}
+		m.logger.Info().Str("bridge", m.config.Bridge).Msg("Bridge created")
+	} else if _, ok := bridge.(*netlink.Bridge); !ok {
+		return nil, fmt.Errorf("%s exists and is not a bridge", m.config.Bridge)
+	}
+
+	ones, bits := m.subnet.Mask.Size()
+	addr := &netlink.Addr{IPNet: &net.IPNet{IP: m.gateway, Mask: net.CIDRMask(ones, bits)}}
+	if err := netlink.AddrReplace(bridge, addr); err != nil {
+		return nil, fmt.Errorf("failed to assign %s to bridge %s: %w", addr.IPNet, m.config.Bridge, err)
+	}
+
+	if err := netlink.LinkSetUp(bridge); err != nil {
+		return nil, fmt.Errorf("failed to bring up bridge %s: %w", m.config.Bridge, err)
+	}
+	return bridge, nil
+}
+
+// ensureTap creates a persistent TAP device if needed, attaches it to the
+// bridge and brings it up
+func (m *Manager) ensureTap(name string, bridge netlink.Link, uid int) error {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if !errors.As(err, &notFound) {
+			return err
+		}
+
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		attrs.MTU = m.config.MTU
+		tap := &netlink.Tuntap{
+			LinkAttrs: attrs,
+			Mode:      netlink.TUNTAP_MODE_TAP,
+			Flags:     netlink.TUNTAP_NO_PI | netlink.TUNTAP_VNET_HDR,
+			Owner:     uint32(uid),
+		}
+		if err := netlink.LinkAdd(tap); err != nil {
+			return err
+		}
+		if link, err = netlink.LinkByName(name); err != nil {
+			return err
+		}
+	} else if _, ok := link.(*netlink.Tuntap); !ok {
+		return fmt.Errorf("%s exists and is not a tap device", name)
+	}
+
+	if err := netlink.LinkSetMaster(link, bridge); err != nil {
+		return err
+	}
+	return netlink.LinkSetUp(link)
+}
+
+// nextFreeIP returns the lowest guest address in subnet that is not in used.
+// The network address, the gateway and the broadcast address are skipped.
+func nextFreeIP(subnet *net.IPNet, used map[string]bool) (net.IP, error) {
+	ones, bits := subnet.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+
+	base := subnet.IP.To4()
+	for offset := uint32(2); offset < size-1; offset++ {
+		ip := addToIP(base, offset)
+		if !used[ip.String()] {
+			return ip, nil
+		}
+	}
+	return nil, models.ErrAddressPoolExhausted
+}
+
+// addToIP returns the IPv4 address offset addresses after ip
+func addToIP(ip net.IP, offset uint32) net.IP {
+	out := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(out, binary.BigEndian.Uint32(ip.To4())+offset)
+	return out
+}
+
+// tapName returns the TAP device name for a VM's NIC
+func tapName(vmID string, index int) string {
+	id := strings.ReplaceAll(vmID, "-", "")
+	if len(id) > tapIDLength {
+		id = id[:tapIDLength]
+	}
+	return fmt.Sprintf("%s%s-%d", tapPrefix, id, index)
+}
+
+// RandomMAC returns a random locally administered unicast MAC address
+func RandomMAC() (string, error) {
+	mac := make(net.HardwareAddr, 6)
+	if _, err := rand.Read(mac); err != nil {
+		return "", fmt.Errorf("failed to generate MAC address: %w", err)
+	}
+	mac[0] = (mac[0] | 0x02) &^ 0x01
+	return mac.String(), nil
+}
+
+// ipBootArg formats a NIC's address for the kernel's ip= argument:
+// ip=<client>:<server>:<gateway>:<netmask>:<hostname>:<device>:<autoconf>:<dns0>:<dns1>
+func ipBootArg(nic models.NIC, device string, nameservers []string) (string, error) {
+	ip, ipNet, err := net.ParseCIDR(nic.IPAddress)
+	if err != nil {
+		return "", err
+	}
+
+	fields := []string{
+		ip.String(),
+		"",
+		nic.Gateway,
+		net.IP(ipNet.Mask).String(),
+		"",
+		device,
+		"off",
+	}
+	fields = append(fields, nameservers...)
+	return "ip=" + strings.Join(fields, ":"), nil
+}
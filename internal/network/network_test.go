@@ -0,0 +1,190 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+func TestNextFreeIP(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/29")
+
+	ip, err := nextFreeIP(subnet, map[string]bool{})
+	if err != nil || ip.String() != "10.0.0.2" {
+		t.Fatalf("nextFreeIP() = %v, %v, want 10.0.0.2", ip, err)
+	}
+
+	ip, err = nextFreeIP(subnet, map[string]bool{"10.0.0.2": true, "10.0.0.4": true})
+	if err != nil || ip.String() != "10.0.0.3" {
+		t.Fatalf("nextFreeIP() = %v, %v, want 10.0.0.3", ip, err)
+	}
+
+	full := map[string]bool{}
+	for _, s := range []string{"10.0.0.2", "10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"} {
+		full[s] = true
+	}
+	if _, err := nextFreeIP(subnet, full); err != models.ErrAddressPoolExhausted {
+		t.Fatalf("nextFreeIP() on a full pool error = %v, want %v", err, models.ErrAddressPoolExhausted)
+	}
+}
+
+func TestTapName(t *testing.T) {
+	name := tapName("1a2b3c4d-5e6f-7a8b-9c0d-1e2f3a4b5c6d", 99)
+	if name != "agni1a2b3c4d-99" {
+		t.Errorf("tapName() = %q, want agni1a2b3c4d-99", name)
+	}
+	if len(name) > 15 {
+		t.Errorf("tapName() = %q is longer than IFNAMSIZ allows", name)
+	}
+}
+
+func TestAttachForeignDevice(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	m, err := NewManager(Config{}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checked before anything on the host is touched
+	for _, device := range []string{"eth0", tapName("vm-two", 0), tapName("vm-one", 1)} {
+		if _, err := m.Attach("vm-one", []models.NIC{{Managed: true, Device: device}}, 0); err != models.ErrManagedNICDevice {
+			t.Errorf("Attach() with device %s error = %v, want %v", device, err, models.ErrManagedNICDevice)
+		}
+	}
+}
+
+func TestKernelArgs(t *testing.T) {
+	m := &Manager{config: Config{Nameservers: []string{"1.1.1.1"}}}
+	nics := []models.NIC{
+		{Device: "tap0"},
+		{Device: "agni1234-1", Managed: true, IPAddress: "172.30.0.5/24", Gateway: "172.30.0.1"},
+	}
+
+	got := m.KernelArgs("console=ttyS0", nics)
+	want := "console=ttyS0 ip=172.30.0.5::172.30.0.1:255.255.255.0::eth1:off:1.1.1.1"
+	if got != want {
+		t.Errorf("KernelArgs() = %q, want %q", got, want)
+	}
+
+	// An explicit ip= wins
+	if got := m.KernelArgs("ip=dhcp", nics); got != "ip=dhcp" {
+		t.Errorf("KernelArgs() = %q, want ip=dhcp", got)
+	}
+}
+
+// TestAttachRelease creates a bridge and taps inside a private network
+// namespace, leaving the host untouched
+func TestAttachRelease(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("creating network namespaces requires root")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origin, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+
+	ns, err := netns.New()
+	if err != nil {
+		t.Skipf("cannot create network namespace: %v", err)
+	}
+	defer func() {
+		_ = netns.Set(origin)
+		ns.Close()
+	}()
+
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	m, err := NewManager(Config{Bridge: "agnitest0", Subnet: "10.10.0.0/24"}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nics := []models.NIC{{Managed: true}, {Managed: true}}
+	attached, err := m.Attach("vm-one", nics, 0)
+	if err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+	if attached[0].IPAddress != "10.10.0.2/24" || attached[1].IPAddress != "10.10.0.3/24" {
+		t.Errorf("Attach() addresses = %s, %s", attached[0].IPAddress, attached[1].IPAddress)
+	}
+	if attached[0].MacAddress == "" || attached[0].Gateway != "10.10.0.1" {
+		t.Errorf("Attach() NIC = %+v", attached[0])
+	}
+
+	bridge, err := netlink.LinkByName("agnitest0")
+	if err != nil {
+		t.Fatalf("bridge not created: %v", err)
+	}
+	tap, err := netlink.LinkByName(attached[0].Device)
+	if err != nil {
+		t.Fatalf("tap not created: %v", err)
+	}
+	if tap.Attrs().MasterIndex != bridge.Attrs().Index {
+		t.Errorf("tap is not attached to the bridge")
+	}
+
+	// Attaching again keeps the same addresses
+	again, err := m.Attach("vm-one", attached, 0)
+	if err != nil || again[0].IPAddress != attached[0].IPAddress {
+		t.Errorf("second Attach() = %+v, %v", again, err)
+	}
+
+	other, err := m.Attach("vm-two", []models.NIC{{Managed: true}}, 0)
+	if err != nil || other[0].IPAddress != "10.10.0.4/24" {
+		t.Errorf("Attach() for another VM = %+v, %v", other, err)
+	}
+
+	// Another VM's record naming the tap does not get it deleted
+	if err := m.Release("vm-two", attached[:1]); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := netlink.LinkByName(attached[0].Device); err != nil {
+		t.Errorf("Release() deleted another VM's tap")
+	}
+
+	if err := m.Release("vm-one", attached); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := netlink.LinkByName(attached[0].Device); err == nil {
+		t.Errorf("tap still exists after Release()")
+	}
+
+	reused, err := m.Attach("vm-three", []models.NIC{{Managed: true}}, 0)
+	if err != nil || reused[0].IPAddress != "10.10.0.2/24" {
+		t.Errorf("Attach() after Release() = %+v, %v", reused, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// AuditStore keeps the audit log, keyed by sequence number. It is append
+// only: entries cannot be changed or deleted through it.
+type AuditStore struct {
+	store *Store
+}
+
+// NewAuditStore creates a new AuditStore
+func NewAuditStore(store *Store) *AuditStore {
+	return &AuditStore{store: store}
+}
+
+// Append assigns the next sequence number to an entry and stores it. The
+// timestamp is set here, so it never goes backwards between entries.
+func (as *AuditStore) Append(entry *models.AuditEntry) error {
+	return as.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketAudit)
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		entry.Sequence = seq
+		entry.Timestamp = time.Now().UTC()
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		return b.Put(sequenceKey(seq), data)
+	})
+}
+
+// Before returns up to limit entries matching filter with a sequence number
+// below before, newest first. A before of 0 starts at the newest entry.
+func (as *AuditStore) Before(filter models.AuditFilter, before uint64, limit int) ([]*models.AuditEntry, error) {
+	entries := make([]*models.AuditEntry, 0)
+
+	err := as.store.ViewTransaction(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BucketAudit).Cursor()
+
+		k, v := c.Last()
+		if before > 0 {
+			// Seek lands on before itself, or after it when it is gone
+			if k, v = c.Seek(sequenceKey(before)); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		}
+
+		for ; k != nil && len(entries) < limit; k, v = c.Prev() {
+			var entry models.AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			// Timestamps follow sequence numbers, nothing older can match
+			if !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since) {
+				break
+			}
+			if filter.Matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		return nil
+	})
+
+	return entries, err
+}
+
+// After returns up to limit entries matching filter with a sequence number
+// above after, oldest first
+func (as *AuditStore) After(filter models.AuditFilter, after uint64, limit int) ([]*models.AuditEntry, error) {
+	entries := make([]*models.AuditEntry, 0)
+
+	err := as.store.ViewTransaction(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BucketAudit).Cursor()
+		for k, v := c.Seek(sequenceKey(after + 1)); k != nil && len(entries) < limit; k, v = c.Next() {
+			var entry models.AuditEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if !filter.Until.IsZero() && entry.Timestamp.After(filter.Until) {
+				break
+			}
+			if filter.Matches(&entry) {
+				entries = append(entries, &entry)
+			}
+		}
+		return nil
+	})
+
+	return entries, err
+}
@@ -139,6 +139,12 @@ func (cs *ConfigStore) GetByName(name string) (*models.ConfigTemplate, error) {
 	return found, nil
 }
 
+// ListPage returns one page of the configuration templates accepted by match, in sort
+// order, and how many there are in total
+func (cs *ConfigStore) ListPage(opts PageOptions, match func(*models.ConfigTemplate) bool) ([]*models.ConfigTemplate, int, error) {
+	return page(cs.store, BucketConfigs, opts, match)
+}
+
 // Count returns the total number of configuration templates
 func (cs *ConfigStore) Count() (int, error) {
 	return cs.store.Count(BucketConfigs)
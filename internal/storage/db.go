@@ -25,11 +25,19 @@ import (
 
 // Bucket names
 var (
-	BucketVMs      = []byte("vms")
-	BucketConfigs  = []byte("configs")
-	BucketUsers    = []byte("users")
-	BucketSessions = []byte("sessions")
-	BucketSettings = []byte("settings")
+	BucketVMs       = []byte("vms")
+	BucketSnapshots = []byte("snapshots")
+	BucketConfigs   = []byte("configs")
+	BucketUsers     = []byte("users")
+	BucketSessions  = []byte("sessions")
+	BucketSettings  = []byte("settings")
+	BucketIPs       = []byte("ip_allocations")
+	BucketImages    = []byte("images")
+	BucketEvents    = []byte("events")
+	BucketWebhooks  = []byte("webhooks")
+	BucketAudit     = []byte("audit")
+
+	BucketWebhookDeliveries = []byte("webhook_deliveries")
 )
 
 // Store wraps a BoltDB database
@@ -74,10 +82,17 @@ func (s *Store) initBuckets() error {
 	return s.db.Update(func(tx *bolt.Tx) error {
 		buckets := [][]byte{
 			BucketVMs,
+			BucketSnapshots,
 			BucketConfigs,
 			BucketUsers,
 			BucketSessions,
 			BucketSettings,
+			BucketIPs,
+			BucketImages,
+			BucketEvents,
+			BucketWebhooks,
+			BucketWebhookDeliveries,
+			BucketAudit,
 		}
 
 		for _, bucket := range buckets {
@@ -85,7 +100,7 @@ func (s *Store) initBuckets() error {
 				return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
 			}
 		}
-		return nil
+		return initIndexes(tx)
 	})
 }
 
@@ -115,6 +130,9 @@ func (s *Store) Put(bucket []byte, key string, value any) error {
 			return fmt.Errorf("failed to marshal value: %w", err)
 		}
 
+		if err := updateIndexes(tx, bucket, []byte(key), b.Get([]byte(key)), data); err != nil {
+			return err
+		}
 		return b.Put([]byte(key), data)
 	})
 }
@@ -143,6 +161,11 @@ func (s *Store) Delete(bucket []byte, key string) error {
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
+		if old := b.Get([]byte(key)); old != nil {
+			if err := updateIndexes(tx, bucket, []byte(key), old, nil); err != nil {
+				return err
+			}
+		}
 		return b.Delete([]byte(key))
 	})
 }
@@ -0,0 +1,139 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DeliveryStore keeps the webhook delivery log. Deliveries are keyed by
+// their time-ordered UUIDv7 IDs, so the bucket is in creation order.
+type DeliveryStore struct {
+	store *Store
+}
+
+// NewDeliveryStore creates a new DeliveryStore
+func NewDeliveryStore(store *Store) *DeliveryStore {
+	return &DeliveryStore{store: store}
+}
+
+// Put creates or updates a delivery
+func (ds *DeliveryStore) Put(delivery *models.WebhookDelivery) error {
+	delivery.UpdatedAt = time.Now()
+	if delivery.CreatedAt.IsZero() {
+		delivery.CreatedAt = delivery.UpdatedAt
+	}
+	return ds.store.Put(BucketWebhookDeliveries, delivery.ID, delivery)
+}
+
+// Get retrieves a delivery by ID
+func (ds *DeliveryStore) Get(id string) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := ds.store.Get(BucketWebhookDeliveries, id, &delivery); err != nil {
+		return nil, models.ErrDeliveryNotFound
+	}
+	return &delivery, nil
+}
+
+// ListByWebhook returns up to limit of a webhook's deliveries, newest first.
+// A limit of 0 returns all of them.
+func (ds *DeliveryStore) ListByWebhook(webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0)
+
+	err := ds.store.ViewTransaction(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BucketWebhookDeliveries).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.WebhookID != webhookID {
+				continue
+			}
+			deliveries = append(deliveries, &delivery)
+			if limit > 0 && len(deliveries) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ListPending returns the deliveries that still have attempts to make,
+// oldest first
+func (ds *DeliveryStore) ListPending() ([]*models.WebhookDelivery, error) {
+	deliveries := make([]*models.WebhookDelivery, 0)
+
+	err := ds.store.ViewTransaction(func(tx *bolt.Tx) error {
+		return tx.Bucket(BucketWebhookDeliveries).ForEach(func(k, v []byte) error {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.Status == models.DeliveryPending {
+				deliveries = append(deliveries, &delivery)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// Prune removes finished deliveries created before a cutoff and returns how
+// many were removed
+func (ds *DeliveryStore) Prune(before time.Time) (int, error) {
+	removed := 0
+
+	err := ds.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketWebhookDeliveries)
+
+		var stale [][]byte
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if !delivery.CreatedAt.Before(before) {
+				break
+			}
+			if delivery.Status != models.DeliveryPending {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+		}
+
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+
+	return removed, err
+}
@@ -0,0 +1,97 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultEventRetention is how many events are kept for clients to resume from
+const DefaultEventRetention = 10000
+
+// EventStore keeps the most recent VM lifecycle events, keyed by sequence
+// number
+type EventStore struct {
+	store     *Store
+	retention uint64
+}
+
+// NewEventStore creates a new EventStore
+func NewEventStore(store *Store) *EventStore {
+	return &EventStore{store: store, retention: DefaultEventRetention}
+}
+
+// sequenceKey encodes a sequence number so keys sort numerically
+func sequenceKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+// Append assigns the next sequence number to an event and stores it,
+// dropping the oldest event once more than the retention are kept
+func (es *EventStore) Append(event *models.Event) error {
+	return es.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketEvents)
+
+		seq, err := b.NextSequence()
+		if err != nil {
+			return err
+		}
+		event.Sequence = seq
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(sequenceKey(seq), data); err != nil {
+			return err
+		}
+
+		if seq > es.retention {
+			return b.Delete(sequenceKey(seq - es.retention))
+		}
+		return nil
+	})
+}
+
+// Since returns up to limit events with a sequence number after seq, oldest
+// first. A limit of 0 returns all of them.
+func (es *EventStore) Since(seq uint64, limit int) ([]*models.Event, error) {
+	events := make([]*models.Event, 0)
+
+	err := es.store.ViewTransaction(func(tx *bolt.Tx) error {
+		c := tx.Bucket(BucketEvents).Cursor()
+		for k, v := c.Seek(sequenceKey(seq + 1)); k != nil; k, v = c.Next() {
+			var event models.Event
+			if err := json.Unmarshal(v, &event); err != nil {
+				return err
+			}
+			events = append(events, &event)
+			if limit > 0 && len(events) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
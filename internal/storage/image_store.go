@@ -0,0 +1,106 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ImageStore provides image registry storage operations
+type ImageStore struct {
+	store *Store
+}
+
+// NewImageStore creates a new ImageStore
+func NewImageStore(store *Store) *ImageStore {
+	return &ImageStore{store: store}
+}
+
+// Create stores a new image record
+func (is *ImageStore) Create(image *models.Image) error {
+	exists, err := is.store.Exists(BucketImages, image.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("image already exists")
+	}
+	image.CreatedAt = time.Now()
+	image.UpdatedAt = image.CreatedAt
+	return is.store.Put(BucketImages, image.ID, image)
+}
+
+// Get retrieves an image by ID
+func (is *ImageStore) Get(id string) (*models.Image, error) {
+	var image models.Image
+	if err := is.store.Get(BucketImages, id, &image); err != nil {
+		return nil, models.ErrImageNotFound
+	}
+	return &image, nil
+}
+
+// Update updates an existing image record
+func (is *ImageStore) Update(image *models.Image) error {
+	exists, err := is.store.Exists(BucketImages, image.ID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrImageNotFound
+	}
+	image.UpdatedAt = time.Now()
+	return is.store.Put(BucketImages, image.ID, image)
+}
+
+// Delete removes an image record
+func (is *ImageStore) Delete(id string) error {
+	exists, err := is.store.Exists(BucketImages, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrImageNotFound
+	}
+	return is.store.Delete(BucketImages, id)
+}
+
+// List returns all images, ordered by name
+func (is *ImageStore) List() ([]*models.Image, error) {
+	images := make([]*models.Image, 0)
+
+	err := is.store.ViewTransaction(func(tx *bolt.Tx) error {
+		return tx.Bucket(BucketImages).ForEach(func(k, v []byte) error {
+			var image models.Image
+			if err := json.Unmarshal(v, &image); err != nil {
+				return err
+			}
+			images = append(images, &image)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(images, func(i, j int) bool {
+		return images[i].Name < images[j].Name
+	})
+	return images, nil
+}
@@ -0,0 +1,242 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Sort fields
+const (
+	SortName      = "name"
+	SortCreatedAt = "created_at"
+	SortStatus    = "status"
+)
+
+// index orders a bucket by a key derived from its values. Entries live in a
+// bucket of their own, keyed by the sort key and the record key so ties keep
+// a stable order, and are kept in step with the data by Put and Delete.
+type index struct {
+	field string
+	key   func(value []byte) ([]byte, error)
+}
+
+// indexes lists the sort indexes of each bucket
+var indexes = map[string][]index{
+	string(BucketVMs): {
+		indexOn(SortName, func(vm *models.VM) []byte { return nameKey(vm.Name) }),
+		indexOn(SortCreatedAt, func(vm *models.VM) []byte { return timeKey(vm.CreatedAt) }),
+		// Equal statuses are ordered by name
+		indexOn(SortStatus, func(vm *models.VM) []byte {
+			return append([]byte(string(vm.Status)+"\x00"), nameKey(vm.Name)...)
+		}),
+	},
+	string(BucketConfigs): {
+		indexOn(SortName, func(config *models.ConfigTemplate) []byte { return nameKey(config.Name) }),
+		indexOn(SortCreatedAt, func(config *models.ConfigTemplate) []byte { return timeKey(config.CreatedAt) }),
+	},
+	string(BucketUsers): {
+		indexOn(SortName, func(user *models.User) []byte { return nameKey(user.Username) }),
+		indexOn(SortCreatedAt, func(user *models.User) []byte { return timeKey(user.CreatedAt) }),
+	},
+}
+
+// indexOn builds an index from the decoded value
+func indexOn[T any](field string, key func(*T) []byte) index {
+	return index{
+		field: field,
+		key: func(value []byte) ([]byte, error) {
+			var item T
+			if err := json.Unmarshal(value, &item); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal item: %w", err)
+			}
+			return key(&item), nil
+		},
+	}
+}
+
+// nameKey sorts names case-insensitively
+func nameKey(name string) []byte {
+	return []byte(strings.ToLower(name))
+}
+
+// timeKey sorts timestamps chronologically. UnixNano is undefined outside
+// 1678-2262, and records from older versions may lack a timestamp, so times
+// before the epoch sort first and times past the range sort last.
+func timeKey(t time.Time) []byte {
+	var nanos uint64
+	switch {
+	case t.Before(time.Unix(0, 0)):
+	case t.After(time.Unix(0, math.MaxInt64)):
+		nanos = math.MaxInt64
+	default:
+		nanos = uint64(t.UnixNano())
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, nanos)
+	return key
+}
+
+// indexBucket returns the name of the bucket holding an index
+func indexBucket(bucket []byte, field string) []byte {
+	return []byte(string(bucket) + "_by_" + field)
+}
+
+// indexEntry returns the key of a record in an index
+func indexEntry(sortKey []byte, key []byte) []byte {
+	entry := make([]byte, 0, len(sortKey)+1+len(key))
+	entry = append(entry, sortKey...)
+	entry = append(entry, 0)
+	return append(entry, key...)
+}
+
+// initIndexes creates missing index buckets and fills them from existing data
+func initIndexes(tx *bolt.Tx) error {
+	for bucket, list := range indexes {
+		b := tx.Bucket([]byte(bucket))
+		for _, idx := range list {
+			name := indexBucket([]byte(bucket), idx.field)
+			if tx.Bucket(name) != nil {
+				continue
+			}
+			ib, err := tx.CreateBucket(name)
+			if err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				sortKey, err := idx.key(v)
+				if err != nil {
+					return err
+				}
+				return ib.Put(indexEntry(sortKey, k), k)
+			}); err != nil {
+				return fmt.Errorf("failed to build index %s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// updateIndexes replaces the index entries of a record, old or value may be
+// nil when the record is created or deleted
+func updateIndexes(tx *bolt.Tx, bucket []byte, key, old, value []byte) error {
+	for _, idx := range indexes[string(bucket)] {
+		ib := tx.Bucket(indexBucket(bucket, idx.field))
+		if ib == nil {
+			return fmt.Errorf("bucket %s not found", indexBucket(bucket, idx.field))
+		}
+
+		var oldEntry, newEntry []byte
+		if old != nil {
+			sortKey, err := idx.key(old)
+			if err != nil {
+				return err
+			}
+			oldEntry = indexEntry(sortKey, key)
+		}
+		if value != nil {
+			sortKey, err := idx.key(value)
+			if err != nil {
+				return err
+			}
+			newEntry = indexEntry(sortKey, key)
+		}
+		if bytes.Equal(oldEntry, newEntry) {
+			continue
+		}
+
+		if oldEntry != nil {
+			if err := ib.Delete(oldEntry); err != nil {
+				return err
+			}
+		}
+		if newEntry != nil {
+			if err := ib.Put(newEntry, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PageOptions selects one page of a sorted listing
+type PageOptions struct {
+	Sort   string // Sort field, one of the bucket's indexes
+	Desc   bool
+	Offset int
+	Limit  int // 0 returns every match
+}
+
+// page walks a bucket in index order and decodes the matches on the
+// requested page. Every value is still read to apply match, but only one
+// page is kept in memory. A nil match accepts everything without decoding.
+// It returns the page and the total number of matches.
+func page[T any](s *Store, bucket []byte, opts PageOptions, match func(*T) bool) ([]*T, int, error) {
+	items := make([]*T, 0)
+	total := 0
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket)
+		ib := tx.Bucket(indexBucket(bucket, opts.Sort))
+		if b == nil || ib == nil {
+			return models.ErrInvalidSort
+		}
+
+		c := ib.Cursor()
+		first, next := c.First, c.Next
+		if opts.Desc {
+			first, next = c.Last, c.Prev
+		}
+
+		for _, key := first(); key != nil; _, key = next() {
+			value := b.Get(key)
+			if value == nil {
+				continue
+			}
+
+			inPage := total >= opts.Offset && (opts.Limit == 0 || total < opts.Offset+opts.Limit)
+			if match == nil && !inPage {
+				total++
+				continue
+			}
+
+			var item T
+			if err := json.Unmarshal(value, &item); err != nil {
+				return fmt.Errorf("failed to unmarshal item: %w", err)
+			}
+			if match != nil && !match(&item) {
+				continue
+			}
+			if inPage {
+				items = append(items, &item)
+			}
+			total++
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
@@ -0,0 +1,126 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+func vmNames(vms []*models.VM) []string {
+	names := make([]string, len(vms))
+	for i, vm := range vms {
+		names[i] = vm.Name
+	}
+	return names
+}
+
+func TestListPage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agni.db")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vms := NewVMStore(store)
+
+	base := time.Now()
+	for i, vm := range []*models.VM{
+		{ID: "1", Name: "charlie", Status: models.VMStatusRunning},
+		{ID: "2", Name: "Alpha", Status: models.VMStatusStopped},
+		{ID: "3", Name: "delta", Status: models.VMStatusRunning},
+		{ID: "4", Name: "bravo", Status: models.VMStatusPaused},
+	} {
+		vm.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := vms.Create(vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, total, err := vms.ListPage(PageOptions{Sort: SortName, Limit: 2}, nil)
+	if err != nil || total != 4 || !slices.Equal(vmNames(page), []string{"Alpha", "bravo"}) {
+		t.Errorf("ListPage(name) = %v, %d, %v", vmNames(page), total, err)
+	}
+
+	page, total, err = vms.ListPage(PageOptions{Sort: SortCreatedAt, Desc: true, Offset: 1, Limit: 2}, nil)
+	if err != nil || total != 4 || !slices.Equal(vmNames(page), []string{"delta", "Alpha"}) {
+		t.Errorf("ListPage(-created_at) = %v, %d, %v", vmNames(page), total, err)
+	}
+
+	running := func(vm *models.VM) bool { return vm.Status == models.VMStatusRunning }
+	page, total, err = vms.ListPage(PageOptions{Sort: SortStatus, Offset: 1, Limit: 5}, running)
+	if err != nil || total != 2 || !slices.Equal(vmNames(page), []string{"delta"}) {
+		t.Errorf("ListPage(status, running) = %v, %d, %v", vmNames(page), total, err)
+	}
+
+	if _, _, err := NewConfigStore(store).ListPage(PageOptions{Sort: SortStatus}, nil); err != models.ErrInvalidSort {
+		t.Errorf("ListPage() on configs by status error = %v, want %v", err, models.ErrInvalidSort)
+	}
+
+	// Renames move the index entry, deletes drop it
+	vm, _ := vms.Get("1")
+	vm.Name = "echo"
+	if err := vms.Update(vm); err != nil {
+		t.Fatal(err)
+	}
+	if err := vms.Delete("2"); err != nil {
+		t.Fatal(err)
+	}
+	page, total, err = vms.ListPage(PageOptions{Sort: SortName}, nil)
+	if err != nil || total != 3 || !slices.Equal(vmNames(page), []string{"bravo", "delta", "echo"}) {
+		t.Errorf("ListPage(name) after changes = %v, %d, %v", vmNames(page), total, err)
+	}
+
+	// Indexes missing from an older database are built on open
+	if err := store.Transaction(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(indexBucket(BucketVMs, SortName))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	store, err = NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	page, total, err = NewVMStore(store).ListPage(PageOptions{Sort: SortName, Desc: true}, nil)
+	if err != nil || total != 3 || !slices.Equal(vmNames(page), []string{"echo", "delta", "bravo"}) {
+		t.Errorf("ListPage(-name) after reopening = %v, %d, %v", vmNames(page), total, err)
+	}
+}
+
+func TestTimeKey(t *testing.T) {
+	times := []time.Time{
+		{},
+		time.Unix(-1, 0),
+		time.Unix(0, 0),
+		time.Unix(1, 0),
+		time.Now(),
+		time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for i := 1; i < len(times); i++ {
+		if bytes.Compare(timeKey(times[i-1]), timeKey(times[i])) > 0 {
+			t.Errorf("timeKey(%v) sorts after timeKey(%v)", times[i-1], times[i])
+		}
+	}
+	if !bytes.Equal(timeKey(time.Time{}), timeKey(time.Unix(0, 0))) {
+		t.Error("timeKey() of a zero time should sort with the epoch")
+	}
+}
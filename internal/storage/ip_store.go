@@ -0,0 +1,134 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// IPStore provides guest IP allocation storage operations. Allocations are
+// keyed by address, so an address can only ever be handed out once.
+type IPStore struct {
+	store *Store
+}
+
+// NewIPStore creates a new IPStore
+func NewIPStore(store *Store) *IPStore {
+	return &IPStore{store: store}
+}
+
+// Allocate returns the address held by a VM's device, or records a new one
+// chosen by pick from the addresses not yet in use. Both happen in a single
+// transaction so concurrent starts cannot pick the same address.
+func (is *IPStore) Allocate(vmID, device string, pick func(used map[string]bool) (string, error)) (*models.IPAllocation, error) {
+	var allocation *models.IPAllocation
+
+	err := is.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketIPs)
+
+		used := make(map[string]bool)
+		err := b.ForEach(func(k, v []byte) error {
+			var existing models.IPAllocation
+			if err := json.Unmarshal(v, &existing); err != nil {
+				return err
+			}
+			if existing.VMID == vmID && existing.Device == device {
+				allocation = &existing
+			}
+			used[string(k)] = true
+			return nil
+		})
+		if err != nil || allocation != nil {
+			return err
+		}
+
+		ip, err := pick(used)
+		if err != nil {
+			return err
+		}
+
+		allocation = &models.IPAllocation{
+			IP:        ip,
+			VMID:      vmID,
+			Device:    device,
+			CreatedAt: time.Now(),
+		}
+		data, err := json.Marshal(allocation)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(ip), data)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return allocation, nil
+}
+
+// ListByVM returns all addresses held by a VM
+func (is *IPStore) ListByVM(vmID string) ([]*models.IPAllocation, error) {
+	allocations := make([]*models.IPAllocation, 0)
+
+	err := is.store.ViewTransaction(func(tx *bolt.Tx) error {
+		return tx.Bucket(BucketIPs).ForEach(func(k, v []byte) error {
+			var allocation models.IPAllocation
+			if err := json.Unmarshal(v, &allocation); err != nil {
+				return err
+			}
+			if allocation.VMID == vmID {
+				allocations = append(allocations, &allocation)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// ReleaseByVM frees all addresses held by a VM
+func (is *IPStore) ReleaseByVM(vmID string) error {
+	return is.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketIPs)
+
+		var keys [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var allocation models.IPAllocation
+			if err := json.Unmarshal(v, &allocation); err != nil {
+				return err
+			}
+			if allocation.VMID == vmID {
+				keys = append(keys, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
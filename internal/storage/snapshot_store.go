@@ -0,0 +1,99 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// SnapshotStore provides snapshot metadata storage operations
+type SnapshotStore struct {
+	store *Store
+}
+
+// NewSnapshotStore creates a new SnapshotStore
+func NewSnapshotStore(store *Store) *SnapshotStore {
+	return &SnapshotStore{store: store}
+}
+
+// Create stores a new snapshot record
+func (ss *SnapshotStore) Create(snapshot *models.Snapshot) error {
+	exists, err := ss.store.Exists(BucketSnapshots, snapshot.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("snapshot already exists")
+	}
+	return ss.store.Put(BucketSnapshots, snapshot.ID, snapshot)
+}
+
+// Get retrieves a snapshot by ID
+func (ss *SnapshotStore) Get(id string) (*models.Snapshot, error) {
+	var snapshot models.Snapshot
+	if err := ss.store.Get(BucketSnapshots, id, &snapshot); err != nil {
+		return nil, models.ErrSnapshotNotFound
+	}
+	return &snapshot, nil
+}
+
+// Delete removes a snapshot record
+func (ss *SnapshotStore) Delete(id string) error {
+	exists, err := ss.store.Exists(BucketSnapshots, id)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrSnapshotNotFound
+	}
+	return ss.store.Delete(BucketSnapshots, id)
+}
+
+// ListByVM returns all snapshots of a VM, oldest first
+func (ss *SnapshotStore) ListByVM(vmID string) ([]*models.Snapshot, error) {
+	snapshots := make([]*models.Snapshot, 0)
+
+	err := ss.store.ViewTransaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketSnapshots)
+		if b == nil {
+			// Bucket doesn't exist yet, return empty list
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			var snapshot models.Snapshot
+			if err := json.Unmarshal(v, &snapshot); err != nil {
+				return err
+			}
+			if snapshot.VMID == vmID {
+				snapshots = append(snapshots, &snapshot)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt)
+	})
+	return snapshots, nil
+}
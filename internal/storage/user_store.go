@@ -136,6 +136,12 @@ func (us *UserStore) List() ([]*models.User, error) {
 	return users, nil
 }
 
+// ListPage returns one page of the users accepted by match, in sort
+// order, and how many there are in total
+func (us *UserStore) ListPage(opts PageOptions, match func(*models.User) bool) ([]*models.User, int, error) {
+	return page(us.store, BucketUsers, opts, match)
+}
+
 // Count returns the total number of users
 func (us *UserStore) Count() (int, error) {
 	return us.store.Count(BucketUsers)
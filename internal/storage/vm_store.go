@@ -134,6 +134,12 @@ func (vs *VMStore) GetByName(name string) (*models.VM, error) {
 	return found, nil
 }
 
+// ListPage returns one page of the VMs accepted by match, in sort
+// order, and how many there are in total
+func (vs *VMStore) ListPage(opts PageOptions, match func(*models.VM) bool) ([]*models.VM, int, error) {
+	return page(vs.store, BucketVMs, opts, match)
+}
+
 // Count returns the total number of VMs
 func (vs *VMStore) Count() (int, error) {
 	return vs.store.Count(BucketVMs)
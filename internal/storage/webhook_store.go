@@ -0,0 +1,129 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// WebhookStore provides webhook storage operations
+type WebhookStore struct {
+	store *Store
+}
+
+// NewWebhookStore creates a new WebhookStore
+func NewWebhookStore(store *Store) *WebhookStore {
+	return &WebhookStore{store: store}
+}
+
+// Create stores a new webhook
+func (ws *WebhookStore) Create(webhook *models.Webhook) error {
+	exists, err := ws.store.Exists(BucketWebhooks, webhook.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("webhook already exists")
+	}
+	webhook.CreatedAt = time.Now()
+	webhook.UpdatedAt = webhook.CreatedAt
+	return ws.store.Put(BucketWebhooks, webhook.ID, webhook)
+}
+
+// Get retrieves a webhook by ID
+func (ws *WebhookStore) Get(id string) (*models.Webhook, error) {
+	var webhook models.Webhook
+	if err := ws.store.Get(BucketWebhooks, id, &webhook); err != nil {
+		return nil, models.ErrWebhookNotFound
+	}
+	return &webhook, nil
+}
+
+// Update updates an existing webhook
+func (ws *WebhookStore) Update(webhook *models.Webhook) error {
+	exists, err := ws.store.Exists(BucketWebhooks, webhook.ID)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return models.ErrWebhookNotFound
+	}
+	webhook.UpdatedAt = time.Now()
+	return ws.store.Put(BucketWebhooks, webhook.ID, webhook)
+}
+
+// Delete removes a webhook and its delivery log
+func (ws *WebhookStore) Delete(id string) error {
+	return ws.store.Transaction(func(tx *bolt.Tx) error {
+		b := tx.Bucket(BucketWebhooks)
+		if b.Get([]byte(id)) == nil {
+			return models.ErrWebhookNotFound
+		}
+		if err := b.Delete([]byte(id)); err != nil {
+			return err
+		}
+
+		deliveries := tx.Bucket(BucketWebhookDeliveries)
+		var stale [][]byte
+		err := deliveries.ForEach(func(k, v []byte) error {
+			var delivery models.WebhookDelivery
+			if err := json.Unmarshal(v, &delivery); err != nil {
+				return err
+			}
+			if delivery.WebhookID == id {
+				stale = append(stale, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := deliveries.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// List returns all webhooks, oldest first
+func (ws *WebhookStore) List() ([]*models.Webhook, error) {
+	webhooks := make([]*models.Webhook, 0)
+
+	err := ws.store.ViewTransaction(func(tx *bolt.Tx) error {
+		return tx.Bucket(BucketWebhooks).ForEach(func(k, v []byte) error {
+			var webhook models.Webhook
+			if err := json.Unmarshal(v, &webhook); err != nil {
+				return err
+			}
+			webhooks = append(webhooks, &webhook)
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks, nil
+}
@@ -0,0 +1,186 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// Defaults leave the host room to breathe: idle vCPUs are cheap, but guest
+// memory Firecracker touches is not given back
+const (
+	DefaultCPUOvercommit    = 4.0
+	DefaultMemoryOvercommit = 1.0
+	DefaultReservedMemoryMB = 512
+)
+
+// procRoot is where host capacity is read from
+var procRoot = "/proc"
+
+// AdmissionConfig limits how much of the host running VMs may commit
+type AdmissionConfig struct {
+	CPUOvercommit    float64 // vCPUs per host CPU; 0 disables the CPU check
+	MemoryOvercommit float64 // Guest MiB per host MiB; 0 disables the memory check
+	ReservedMemoryMB int64   // Kept for the host before overcommit is applied
+}
+
+// DefaultAdmissionConfig returns the default admission limits
+func DefaultAdmissionConfig() AdmissionConfig {
+	return AdmissionConfig{
+		CPUOvercommit:    DefaultCPUOvercommit,
+		MemoryOvercommit: DefaultMemoryOvercommit,
+		ReservedMemoryMB: DefaultReservedMemoryMB,
+	}
+}
+
+// SetAdmission changes the limits applied to VM starts
+func (m *Manager) SetAdmission(cfg AdmissionConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.admission = cfg
+}
+
+// Resources reports the host's capacity for VMs and how much of it running
+// VMs have committed
+func (m *Manager) Resources() (*models.HostResources, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.resources()
+}
+
+// resources is Resources for callers holding mu
+func (m *Manager) resources() (*models.HostResources, error) {
+	cpus, memoryMB, err := hostCapacity(procRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &models.HostResources{
+		CPUs:                cpus,
+		MemoryMB:            memoryMB,
+		CPUOvercommit:       m.admission.CPUOvercommit,
+		MemoryOvercommit:    m.admission.MemoryOvercommit,
+		ReservedMemoryMB:    m.admission.ReservedMemoryMB,
+		AllocatableCPUs:     int64(float64(cpus) * m.admission.CPUOvercommit),
+		AllocatableMemoryMB: int64(float64(memoryMB-m.admission.ReservedMemoryMB) * m.admission.MemoryOvercommit),
+		RunningVMs:          len(m.runningVMs),
+	}
+	if res.AllocatableMemoryMB < 0 {
+		res.AllocatableMemoryMB = 0
+	}
+	for _, running := range m.runningVMs {
+		res.CommittedCPUs += running.cpus
+		res.CommittedMemoryMB += running.memoryMB
+	}
+	res.AvailableCPUs = max(res.AllocatableCPUs-res.CommittedCPUs, 0)
+	res.AvailableMemoryMB = max(res.AllocatableMemoryMB-res.CommittedMemoryMB, 0)
+	return res, nil
+}
+
+// admit checks that a VM fits next to the running ones. Callers hold mu, so
+// concurrent starts cannot both take the last of the capacity.
+func (m *Manager) admit(cfg *models.VMConfig) error {
+	if m.admission.CPUOvercommit == 0 && m.admission.MemoryOvercommit == 0 {
+		return nil
+	}
+	res, err := m.resources()
+	if err != nil {
+		// Not knowing the host is no reason to refuse every start
+		m.logger.Warn().Err(err).Msg("Failed to read host capacity, skipping admission control")
+		return nil
+	}
+	return checkAdmission(res, cfg.CPUs, cfg.MemoryMB)
+}
+
+// checkAdmission rejects a VM that does not fit into the available resources
+func checkAdmission(res *models.HostResources, cpus, memoryMB int64) error {
+	cpuShort := res.CPUOvercommit != 0 && cpus > res.AvailableCPUs
+	memoryShort := res.MemoryOvercommit != 0 && memoryMB > res.AvailableMemoryMB
+	if !cpuShort && !memoryShort {
+		return nil
+	}
+	return fmt.Errorf("%w: the VM needs %d vCPUs and %d MiB, %d vCPUs and %d MiB are available (%d vCPUs and %d MiB committed to %d running VMs)",
+		models.ErrInsufficientResources, cpus, memoryMB, res.AvailableCPUs, res.AvailableMemoryMB,
+		res.CommittedCPUs, res.CommittedMemoryMB, res.RunningVMs)
+}
+
+// hostCapacity reads the number of CPUs and the memory in MiB of the host
+func hostCapacity(proc string) (int, int64, error) {
+	cpuinfo, err := os.Open(filepath.Join(proc, "cpuinfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cpuinfo.Close()
+	cpus, err := parseCPUCount(cpuinfo)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	meminfo, err := os.Open(filepath.Join(proc, "meminfo"))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer meminfo.Close()
+	memoryMB, err := parseMemTotal(meminfo)
+	if err != nil {
+		return 0, 0, err
+	}
+	return cpus, memoryMB, nil
+}
+
+// parseCPUCount counts the processor entries of /proc/cpuinfo
+func parseCPUCount(r io.Reader) (int, error) {
+	cpus := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, _, ok := strings.Cut(scanner.Text(), ":")
+		if ok && strings.TrimSpace(key) == "processor" {
+			cpus++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	if cpus == 0 {
+		return 0, fmt.Errorf("no processors listed in cpuinfo")
+	}
+	return cpus, nil
+}
+
+// parseMemTotal returns MemTotal from /proc/meminfo in MiB
+func parseMemTotal(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "MemTotal:" {
+			continue
+		}
+		kb, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid MemTotal: %w", err)
+		}
+		return kb / 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemTotal in meminfo")
+}
@@ -0,0 +1,81 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestParseHostCapacity(t *testing.T) {
+	cpuinfo := "processor\t: 0\nmodel name\t: Test CPU\n\nprocessor\t: 1\nmodel name\t: Test CPU\n"
+	if cpus, err := parseCPUCount(strings.NewReader(cpuinfo)); err != nil || cpus != 2 {
+		t.Errorf("parseCPUCount() = %d, %v, want 2", cpus, err)
+	}
+
+	meminfo := "MemTotal:        8167848 kB\nMemFree:          123456 kB\n"
+	if mb, err := parseMemTotal(strings.NewReader(meminfo)); err != nil || mb != 7976 {
+		t.Errorf("parseMemTotal() = %d, %v, want 7976", mb, err)
+	}
+	if _, err := parseMemTotal(strings.NewReader("MemFree: 1 kB\n")); err == nil {
+		t.Errorf("parseMemTotal() without MemTotal succeeded")
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	proc := t.TempDir()
+	if err := os.WriteFile(filepath.Join(proc, "cpuinfo"), []byte("processor : 0\nprocessor : 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(proc, "meminfo"), []byte("MemTotal: 4194304 kB\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(orig string) { procRoot = orig }(procRoot)
+	procRoot = proc
+
+	m := &Manager{
+		runningVMs: map[string]*RunningVM{"a": {cpus: 4, memoryMB: 2048}},
+		admission:  AdmissionConfig{CPUOvercommit: 3, MemoryOvercommit: 1, ReservedMemoryMB: 1024},
+		logger:     logging.GetLogger(),
+	}
+
+	res, err := m.Resources()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.AllocatableCPUs != 6 || res.AvailableCPUs != 2 || res.AllocatableMemoryMB != 3072 || res.AvailableMemoryMB != 1024 {
+		t.Errorf("Resources() = %+v", res)
+	}
+
+	if err := m.admit(&models.VMConfig{CPUs: 2, MemoryMB: 1024}); err != nil {
+		t.Errorf("admit() of a fitting VM error = %v", err)
+	}
+	if err := m.admit(&models.VMConfig{CPUs: 1, MemoryMB: 2048}); !errors.Is(err, models.ErrInsufficientResources) {
+		t.Errorf("admit() of too much memory error = %v, want %v", err, models.ErrInsufficientResources)
+	}
+	if err := m.admit(&models.VMConfig{CPUs: 3, MemoryMB: 128}); !errors.Is(err, models.ErrInsufficientResources) {
+		t.Errorf("admit() of too many vCPUs error = %v, want %v", err, models.ErrInsufficientResources)
+	}
+
+	// A zero ratio switches its check off
+	m.admission.CPUOvercommit = 0
+	if err := m.admit(&models.VMConfig{CPUs: 64, MemoryMB: 128}); err != nil {
+		t.Errorf("admit() without a CPU limit error = %v", err)
+	}
+}
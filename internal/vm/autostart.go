@@ -0,0 +1,94 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// Autostart starts the VMs flagged for autostart in boot order, waiting delay
+// between starts. VMs that are already running, such as those re-attached by
+// Reconcile, are skipped. A failed start is recorded on the VM and does not
+// hold up the others. Autostart returns early when ctx is cancelled.
+func (m *Manager) Autostart(ctx context.Context, delay time.Duration) error {
+	vms, err := m.store.List()
+	if err != nil {
+		return err
+	}
+
+	started := 0
+	for _, vm := range autostartOrder(vms) {
+		if m.IsRunning(vm.ID) {
+			continue
+		}
+
+		if started > 0 && delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		started++
+
+		m.logger.Info().Str("vm_id", vm.ID).Str("name", vm.Name).Int("boot_order", vm.BootOrder).Msg("Autostarting VM")
+		if err := m.Start(vm.ID, models.ActorSystem); err != nil {
+			m.logger.Error().Err(err).Str("vm_id", vm.ID).Msg("Autostart failed")
+			m.recordAutostartFailure(vm.ID, err)
+		}
+	}
+	return nil
+}
+
+// autostartOrder returns the VMs flagged for autostart, ordered by boot order
+// and then by name
+func autostartOrder(vms []*models.VM) []*models.VM {
+	var queue []*models.VM
+	for _, vm := range vms {
+		if vm.Autostart {
+			queue = append(queue, vm)
+		}
+	}
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].BootOrder != queue[j].BootOrder {
+			return queue[i].BootOrder < queue[j].BootOrder
+		}
+		return queue[i].Name < queue[j].Name
+	})
+	return queue
+}
+
+// recordAutostartFailure marks a VM that failed to autostart
+func (m *Manager) recordAutostartFailure(id string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm, getErr := m.store.Get(id)
+	if _, running := m.runningVMs[id]; getErr != nil || running {
+		return
+	}
+	vm.Status = models.VMStatusError
+	vm.Error = fmt.Sprintf("autostart failed: %v", err)
+	if err := m.store.Update(vm); err != nil {
+		m.logger.Error().Err(err).Msg("Failed to update VM state")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestAutostartOrder(t *testing.T) {
+	vms := []*models.VM{
+		{Name: "db", Autostart: true, BootOrder: 1},
+		{Name: "scratch"},
+		{Name: "web", Autostart: true, BootOrder: 2},
+		{Name: "cache", Autostart: true, BootOrder: 1},
+		{Name: "dns", Autostart: true},
+	}
+
+	var names []string
+	for _, vm := range autostartOrder(vms) {
+		names = append(names, vm.Name)
+	}
+
+	want := []string{"dns", "cache", "db", "web"}
+	if len(names) != len(want) {
+		t.Fatalf("autostartOrder() = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("autostartOrder() = %v, want %v", names, want)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// Balloon statistics are read on the metrics path, so keep it snappy
+const balloonStatsTimeout = 2 * time.Second
+
+// validateBalloon checks a balloon against the VM's memory size
+func validateBalloon(cfg *models.VMConfig) error {
+	b := cfg.Balloon
+	if b == nil {
+		return nil
+	}
+	if b.AmountMib < 0 || b.AmountMib > cfg.MemoryMB || b.StatsPollingIntervalS < 0 {
+		return models.ErrInvalidBalloon
+	}
+	return nil
+}
+
+// balloonHandler returns an FcInit handler that adds the balloon before boot
+func balloonHandler(b *models.Balloon) firecracker.Handler {
+	return firecracker.NewCreateBalloonHandler(b.AmountMib, b.DeflateOnOOM, b.StatsPollingIntervalS)
+}
+
+// UpdateBalloon resizes a VM's balloon or changes its statistics interval,
+// live if the VM is running, and persists the result
+func (m *Manager) UpdateBalloon(id string, req *models.UpdateBalloonRequest, actor string) (*models.Balloon, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if vm.Config.Balloon == nil {
+		return nil, models.ErrBalloonNotConfigured
+	}
+
+	current := *vm.Config.Balloon
+	updated := current
+	if req.AmountMib != nil {
+		updated.AmountMib = *req.AmountMib
+	}
+	if req.StatsPollingIntervalS != nil {
+		updated.StatsPollingIntervalS = *req.StatsPollingIntervalS
+	}
+
+	cfg := vm.Config
+	cfg.Balloon = &updated
+	if err := validateBalloon(&cfg); err != nil {
+		return nil, err
+	}
+
+	if running, exists := m.runningVMs[id]; exists {
+		// Firecracker only collects statistics if asked to at boot
+		if (current.StatsPollingIntervalS == 0) != (updated.StatsPollingIntervalS == 0) {
+			return nil, models.ErrBalloonStatsToggle
+		}
+
+		ctx := context.Background()
+		if updated.AmountMib != current.AmountMib {
+			if err := running.Machine.UpdateBalloon(ctx, updated.AmountMib); err != nil {
+				return nil, fmt.Errorf("failed to resize balloon: %w", err)
+			}
+		}
+		if updated.StatsPollingIntervalS != current.StatsPollingIntervalS {
+			if err := running.Machine.UpdateBalloonStats(ctx, updated.StatsPollingIntervalS); err != nil {
+				return nil, fmt.Errorf("failed to update balloon statistics interval: %w", err)
+			}
+		}
+	}
+
+	vm.Config.Balloon = &updated
+	if err := m.store.Update(vm); err != nil {
+		return nil, err
+	}
+
+	m.logger.Info().Str("vm_id", id).Int64("amount_mib", updated.AmountMib).Msg("VM balloon updated")
+	m.emit(models.EventConfigChanged, vm, vm.Status, vm.Status, actor)
+	return &updated, nil
+}
+
+// GetBalloonStats returns the guest memory statistics of a running VM
+func (m *Manager) GetBalloonStats(id string) (*models.BalloonStats, error) {
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	running, exists := m.runningVMs[id]
+	m.mu.RUnlock()
+
+	if !exists {
+		return nil, models.ErrVMNotRunning
+	}
+	return balloonStats(running, vm.Config.Balloon)
+}
+
+// balloonStats asks Firecracker for balloon statistics
+func balloonStats(running *RunningVM, b *models.Balloon) (*models.BalloonStats, error) {
+	if b == nil {
+		return nil, models.ErrBalloonNotConfigured
+	}
+	if b.StatsPollingIntervalS == 0 {
+		return nil, models.ErrBalloonStatsDisabled
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), balloonStatsTimeout)
+	defer cancel()
+
+	stats, err := running.Machine.GetBalloonStats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get balloon statistics: %w", err)
+	}
+	return fromFCBalloonStats(&stats), nil
+}
+
+// fromFCBalloonStats converts Firecracker's balloon statistics
+func fromFCBalloonStats(stats *fcmodels.BalloonStats) *models.BalloonStats {
+	return &models.BalloonStats{
+		TargetMib:       firecracker.Int64Value(stats.TargetMib),
+		ActualMib:       firecracker.Int64Value(stats.ActualMib),
+		TargetPages:     firecracker.Int64Value(stats.TargetPages),
+		ActualPages:     firecracker.Int64Value(stats.ActualPages),
+		TotalMemory:     stats.TotalMemory,
+		FreeMemory:      stats.FreeMemory,
+		AvailableMemory: stats.AvailableMemory,
+		DiskCaches:      stats.DiskCaches,
+		SwapIn:          stats.SwapIn,
+		SwapOut:         stats.SwapOut,
+		MajorFaults:     stats.MajorFaults,
+		MinorFaults:     stats.MinorFaults,
+	}
+}
+
+// memoryUsed derives the memory the guest is using from balloon statistics.
+// Available memory counts reclaimable caches as free; older guests only
+// report free memory.
+func memoryUsed(stats *models.BalloonStats) int64 {
+	if stats.TotalMemory == 0 {
+		return 0
+	}
+	free := stats.AvailableMemory
+	if free == 0 {
+		free = stats.FreeMemory
+	}
+	return stats.TotalMemory - free
+}
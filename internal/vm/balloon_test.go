@@ -0,0 +1,60 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestValidateBalloon(t *testing.T) {
+	cases := []struct {
+		name    string
+		balloon *models.Balloon
+		wantErr bool
+	}{
+		{"none", nil, false},
+		{"valid", &models.Balloon{AmountMib: 128, StatsPollingIntervalS: 1}, false},
+		{"whole memory", &models.Balloon{AmountMib: 512}, false},
+		{"too large", &models.Balloon{AmountMib: 513}, true},
+		{"negative", &models.Balloon{AmountMib: -1}, true},
+		{"negative interval", &models.Balloon{StatsPollingIntervalS: -1}, true},
+	}
+
+	for _, c := range cases {
+		cfg := models.VMConfig{MemoryMB: 512, Balloon: c.balloon}
+		if err := validateBalloon(&cfg); (err != nil) != c.wantErr {
+			t.Errorf("%s: validateBalloon() error = %v, wantErr %v", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestMemoryUsed(t *testing.T) {
+	cases := []struct {
+		name  string
+		stats models.BalloonStats
+		want  int64
+	}{
+		{"available", models.BalloonStats{TotalMemory: 1000, FreeMemory: 100, AvailableMemory: 600}, 400},
+		{"free only", models.BalloonStats{TotalMemory: 1000, FreeMemory: 100}, 900},
+		{"no stats yet", models.BalloonStats{}, 0},
+	}
+
+	for _, c := range cases {
+		if got := memoryUsed(&c.stats); got != c.want {
+			t.Errorf("%s: memoryUsed() = %d, want %d", c.name, got, c.want)
+		}
+	}
+}
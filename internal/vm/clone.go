@@ -0,0 +1,332 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/image"
+	"github.com/anubhavg-icpl/agni/internal/network"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	maxClones = 32
+
+	// Zero runs of this size are left as holes when a copy cannot be reflinked
+	sparseBlockSize = 64 * 1024
+)
+
+// Clone creates copies of a stopped VM. Each clone gets a fresh ID and MAC
+// addresses and its own copy of every drive not listed as shared; shared
+// drives are attached read-only. Copies are reflinked where the filesystem
+// supports it. Unmanaged NICs keep their tap device, so a clone and its
+// source cannot run at the same time until one of them gets another tap.
+// The clones keep the source's labels, belong to ownerID and count against
+// their quota.
+func (m *Manager) Clone(id, ownerID, actor string, req models.CloneVMRequest) ([]*models.VM, error) {
+	count := req.Count
+	if count == 0 {
+		count = 1
+	}
+	if count < 0 || count > maxClones {
+		return nil, models.ErrInvalidCloneCount
+	}
+
+	source, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if m.IsRunning(id) {
+		return nil, models.ErrVMAlreadyRunning
+	}
+
+	shared := make(map[string]bool, len(req.SharedDrives))
+	for _, driveID := range req.SharedDrives {
+		if driveIndex(source, driveID) < 0 {
+			return nil, models.ErrDriveNotFound
+		}
+		shared[driveID] = true
+	}
+
+	copied := make(map[string]bool)
+	if !shared["1"] {
+		copied[source.Config.RootDrive.Path] = true
+	}
+	for i, drive := range source.Config.AdditionalDrives {
+		if !shared[strconv.Itoa(i+2)] {
+			copied[drive.Path] = true
+		}
+	}
+
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	m.mu.RLock()
+	err = m.checkCreateQuota(ownerID, count, &source.Config, copied)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var clones []*models.VM
+	for n := 1; n <= count; n++ {
+		clone, err := m.cloneVM(source, ownerID, cloneName(req.Name, source.Name, n, count), shared)
+		if err != nil {
+			// All or nothing
+			for _, vm := range clones {
+				_ = m.store.Delete(vm.ID)
+				_ = os.RemoveAll(m.diskDir(vm.ID))
+			}
+			return nil, err
+		}
+		clones = append(clones, clone)
+	}
+
+	for _, clone := range clones {
+		m.emit(models.EventCreated, clone, "", clone.Status, actor)
+	}
+	return clones, nil
+}
+
+// cloneVM creates a single clone of source
+func (m *Manager) cloneVM(source *models.VM, ownerID, name string, shared map[string]bool) (*models.VM, error) {
+	config, err := copyConfig(&source.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	vm := &models.VM{
+		ID:        uuid.New().String(),
+		Name:      name,
+		OwnerID:   ownerID,
+		Labels:    maps.Clone(source.Labels),
+		Status:    models.VMStatusStopped,
+		Config:    *config,
+		CreatedAt: time.Now(),
+	}
+	vm.Config.Name = name
+
+	reflinked := 0
+	copyDrive := func(driveID string, drive *models.Drive) error {
+		if shared[driveID] {
+			drive.ReadOnly = true
+			return nil
+		}
+		dst := filepath.Join(m.diskDir(vm.ID), driveID+"-"+filepath.Base(drive.Path))
+		cloned, err := copyDisk(drive.Path, dst)
+		if err != nil {
+			return fmt.Errorf("failed to copy drive %s: %w", driveID, err)
+		}
+		if cloned {
+			reflinked++
+		}
+		drive.Path = dst
+		return nil
+	}
+
+	if err := copyDrive("1", &vm.Config.RootDrive); err != nil {
+		_ = os.RemoveAll(m.diskDir(vm.ID))
+		return nil, err
+	}
+	// A copied root filesystem is no longer the registered image
+	if !shared["1"] {
+		vm.Config.RootfsImageID = ""
+	}
+	for i := range vm.Config.AdditionalDrives {
+		if err := copyDrive(strconv.Itoa(i+2), &vm.Config.AdditionalDrives[i]); err != nil {
+			_ = os.RemoveAll(m.diskDir(vm.ID))
+			return nil, err
+		}
+	}
+
+	if err := freshNICs(vm.Config.NetworkInterfaces); err != nil {
+		_ = os.RemoveAll(m.diskDir(vm.ID))
+		return nil, err
+	}
+
+	// Nor share a chroot, which is removed on every start and stop; the
+	// jailer ID then follows the clone's own ID
+	if vm.Config.Jailer != nil {
+		vm.Config.Jailer.ID = ""
+	}
+
+	// Two VMs cannot listen on the same vsock socket
+	m.placeVsockSockets(vm.ID, &vm.Config)
+
+	if err := m.store.Create(vm); err != nil {
+		_ = os.RemoveAll(m.diskDir(vm.ID))
+		return nil, fmt.Errorf("failed to create VM: %w", err)
+	}
+
+	m.logger.Info().Str("vm_id", vm.ID).Str("source", source.ID).Str("name", vm.Name).Int("reflinked", reflinked).Msg("VM cloned")
+	return vm, nil
+}
+
+// copyRootfsImage gives a VM booting a registered rootfs read-write its own
+// copy of the image. The guest writes to its root filesystem, which would
+// break the image's checksum and corrupt it for every other VM booting it.
+// The copy is verified against the image and is the VM's own drive from then
+// on. Read-only root drives keep using the image.
+func (m *Manager) copyRootfsImage(id string, cfg *models.VMConfig) error {
+	if cfg.RootfsImageID == "" || cfg.RootDrive.ReadOnly {
+		return nil
+	}
+
+	img, err := m.images.Get(cfg.RootfsImageID)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(m.diskDir(id), "1-"+filepath.Base(img.Path))
+	if _, err := copyDisk(img.Path, dst); err != nil {
+		return fmt.Errorf("failed to copy rootfs image: %w", err)
+	}
+	if err := image.VerifyFile(img, dst); err != nil {
+		_ = os.Remove(dst)
+		return err
+	}
+
+	cfg.RootDrive.Path = dst
+	cfg.RootfsImageID = ""
+	return nil
+}
+
+// diskDir returns where a VM's cloned drives live
+func (m *Manager) diskDir(id string) string {
+	return filepath.Join(m.dataDir, "disks", id)
+}
+
+// copyConfig returns a deep copy of a VM config
+func copyConfig(cfg *models.VMConfig) (*models.VMConfig, error) {
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var out models.VMConfig
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// cloneName expands a clone name pattern. Several clones always get a
+// number, even if the pattern has no {n}.
+func cloneName(pattern, source string, n, count int) string {
+	if pattern == "" {
+		pattern = "{name}-clone"
+	}
+	if count > 1 && !strings.Contains(pattern, "{n}") {
+		pattern += "-{n}"
+	}
+	return strings.NewReplacer("{name}", source, "{n}", strconv.Itoa(n)).Replace(pattern)
+}
+
+// freshNICs gives cloned NICs new MAC addresses and drops what was assigned
+// to the source at runtime; managed NICs get their own tap and address on
+// first start
+func freshNICs(nics []models.NIC) error {
+	for i := range nics {
+		nic := &nics[i]
+		if nic.Managed {
+			nic.Device = ""
+			nic.IPAddress = ""
+			nic.Gateway = ""
+		}
+		if nic.CNI != nil {
+			nic.MacAddress = ""
+			continue
+		}
+		mac, err := network.RandomMAC()
+		if err != nil {
+			return err
+		}
+		nic.MacAddress = mac
+	}
+	return nil
+}
+
+// copyDisk copies a disk image to dst, which must not exist. It reports
+// whether the copy is a reflink sharing blocks with the source; otherwise
+// the copy is sparse.
+func copyDisk(src, dst string) (reflinked bool, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0750); err != nil {
+		return false, err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	if unix.IoctlFileClone(int(out.Fd()), int(in.Fd())) == nil {
+		return true, nil
+	}
+	return false, sparseCopy(out, in, info.Size())
+}
+
+// sparseCopy copies size bytes from in to out, skipping blocks of zeroes
+func sparseCopy(out *os.File, in io.Reader, size int64) error {
+	buf := make([]byte, sparseBlockSize)
+	zero := make([]byte, sparseBlockSize)
+
+	var offset int64
+	for {
+		n, err := io.ReadFull(in, buf)
+		if n > 0 && !bytes.Equal(buf[:n], zero[:n]) {
+			if _, err := out.WriteAt(buf[:n], offset); err != nil {
+				return err
+			}
+		}
+		offset += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Trailing holes only exist once the size is set
+	return out.Truncate(size)
+}
@@ -0,0 +1,211 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestCloneName(t *testing.T) {
+	cases := []struct {
+		pattern  string
+		n, count int
+		want     string
+	}{
+		{"", 1, 1, "golden-clone"},
+		{"", 2, 3, "golden-clone-2"},
+		{"test-{n}-{name}", 3, 3, "test-3-golden"},
+		{"ci", 1, 2, "ci-1"},
+	}
+
+	for _, c := range cases {
+		if got := cloneName(c.pattern, "golden", c.n, c.count); got != c.want {
+			t.Errorf("cloneName(%q, %d, %d) = %q, want %q", c.pattern, c.n, c.count, got, c.want)
+		}
+	}
+}
+
+func TestFreshNICs(t *testing.T) {
+	nics := []models.NIC{
+		{Device: "tap0", MacAddress: "02:00:00:00:00:01"},
+		{Device: "agni1234-1", MacAddress: "02:00:00:00:00:02", Managed: true, IPAddress: "172.30.0.2/24", Gateway: "172.30.0.1"},
+	}
+	if err := freshNICs(nics); err != nil {
+		t.Fatal(err)
+	}
+
+	if nics[0].Device != "tap0" || nics[0].MacAddress == "02:00:00:00:00:01" || nics[0].MacAddress == "" {
+		t.Errorf("unmanaged NIC = %+v, want same tap with a new MAC", nics[0])
+	}
+	if nics[1].Device != "" || nics[1].IPAddress != "" || nics[1].MacAddress == "02:00:00:00:00:02" {
+		t.Errorf("managed NIC = %+v, want no tap or address and a new MAC", nics[1])
+	}
+}
+
+func TestCopyDisk(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.ext4")
+
+	// Data at both ends with a large hole in between
+	data := bytes.Repeat([]byte("agni"), 1024)
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(data, 16<<20); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dst := filepath.Join(dir, "clone", "1-rootfs.ext4")
+	reflinked, err := copyDisk(src, dst)
+	if err != nil {
+		t.Fatalf("copyDisk() error = %v", err)
+	}
+
+	want, _ := os.ReadFile(src)
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("copy differs from source")
+	}
+
+	if !reflinked {
+		var st syscall.Stat_t
+		if err := syscall.Stat(dst, &st); err != nil {
+			t.Fatal(err)
+		}
+		if st.Blocks*512 >= int64(len(want)) {
+			t.Errorf("copy uses %d bytes on disk, want a sparse file", st.Blocks*512)
+		}
+	}
+
+	if _, err := copyDisk(src, dst); err == nil {
+		t.Errorf("copyDisk() overwrote an existing file")
+	}
+}
+
+func TestCloneJailed(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(rootfs, []byte("rootfs"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	source := &models.VM{ID: "golden", Name: "golden", Status: models.VMStatusStopped, Config: models.VMConfig{
+		RootDrive: models.Drive{Path: rootfs},
+		Jailer:    &models.JailerConfig{ID: "golden", UID: 1000, GID: 1000},
+	}}
+	if err := m.store.Create(source); err != nil {
+		t.Fatal(err)
+	}
+
+	clones, err := m.Clone(source.ID, "", "alice", models.CloneVMRequest{Count: 2})
+	if err != nil {
+		t.Fatalf("Clone() error = %v", err)
+	}
+	for _, clone := range clones {
+		if clone.Config.Jailer == nil || clone.Config.Jailer.ID != "" || clone.Config.Jailer.UID != 1000 {
+			t.Errorf("clone jailer = %+v, want the source's settings without its ID", clone.Config.Jailer)
+		}
+	}
+
+	if got, _ := m.Get(source.ID); got.Config.Jailer.ID != "golden" {
+		t.Errorf("source jailer ID = %q, want golden", got.Config.Jailer.ID)
+	}
+}
+
+func TestCopyRootfsImage(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	path := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(path, []byte("pristine ext4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	img, err := m.Images().Register(models.RegisterImageRequest{Name: "rootfs", Type: models.ImageTypeRootfs, Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.Create(models.CreateVMRequest{Name: "first", Config: models.VMConfig{RootfsImageID: img.ID}}, "", "alice")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	second, err := m.Create(models.CreateVMRequest{Name: "second", Config: models.VMConfig{RootfsImageID: img.ID}}, "", "alice")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	root := first.Config.RootDrive.Path
+	if root == path || root == second.Config.RootDrive.Path || first.Config.RootfsImageID != "" {
+		t.Fatalf("root drives = %s, %s, want separate copies of %s", root, second.Config.RootDrive.Path, path)
+	}
+
+	// The guest writes to its root filesystem on the first boot; the next
+	// start must not trip over the image checksum
+	if err := os.WriteFile(root, []byte("guest was here"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := first.Config
+	if err := m.copyRootfsImage(first.ID, &cfg); err != nil || cfg.RootDrive.Path != root {
+		t.Errorf("copyRootfsImage() on restart = %s, %v, want %s left alone", cfg.RootDrive.Path, err, root)
+	}
+	if err := m.Images().Prepare(&cfg); err != nil {
+		t.Errorf("Prepare() after a guest write error = %v", err)
+	}
+	if _, err := m.Images().Verify(img.ID); err != nil {
+		t.Errorf("image changed by a VM: %v", err)
+	}
+
+	// Read-only root drives boot the verified image itself
+	shared, err := m.Create(models.CreateVMRequest{Name: "shared", Config: models.VMConfig{RootfsImageID: img.ID, RootDrive: models.Drive{ReadOnly: true}}}, "", "alice")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	cfg = shared.Config
+	if err := m.Images().Prepare(&cfg); err != nil || cfg.RootDrive.Path != path {
+		t.Errorf("Prepare() of a read-only root = %s, %v, want %s", cfg.RootDrive.Path, err, path)
+	}
+
+	// An image that changed since it was registered is not copied
+	if err := os.WriteFile(path, []byte("tampered ext4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Create(models.CreateVMRequest{Name: "third", Config: models.VMConfig{RootfsImageID: img.ID}}, "", "alice"); err != models.ErrImageChecksumMismatch {
+		t.Errorf("Create() from a changed image error = %v, want %v", err, models.ErrImageChecksumMismatch)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/containernetworking/cni/libcni"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Same locations the SDK falls back to
+	cniNetNSDir       = "/var/run/netns"
+	defaultCNIConfDir = "/etc/cni/conf.d"
+	defaultCNIBinDir  = "/opt/cni/bin"
+)
+
+// hasCNINICs reports whether a VM has a NIC set up by CNI
+func hasCNINICs(cfg *models.VMConfig) bool {
+	for _, nic := range cfg.NetworkInterfaces {
+		if nic.CNI != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCNI checks the limits the SDK places on CNI interfaces: the kernel
+// only takes one ip= argument, which the SDK fills in from the CNI result
+func validateCNI(cfg *models.VMConfig) error {
+	for _, nic := range cfg.NetworkInterfaces {
+		if nic.CNI == nil {
+			continue
+		}
+		if nic.CNI.NetworkName == "" || nic.Managed || len(cfg.NetworkInterfaces) > 1 {
+			return models.ErrInvalidCNIConfig
+		}
+		for _, field := range strings.Fields(cfg.KernelOpts) {
+			if strings.HasPrefix(field, "ip=") {
+				return models.ErrInvalidCNIConfig
+			}
+		}
+	}
+	return nil
+}
+
+// cniNetNSPath returns the network namespace CNI sets up for a VM
+func cniNetNSPath(id string) string {
+	return filepath.Join(cniNetNSDir, id)
+}
+
+// cniCacheDir returns where CNI keeps a VM's results, which DEL relies on
+func (m *Manager) cniCacheDir(id string) string {
+	return filepath.Join(m.dataDir, "cni", id)
+}
+
+// toFCCNIConfig converts a NIC's CNI settings for the SDK
+func (m *Manager) toFCCNIConfig(id string, cni *models.CNIConfig) *firecracker.CNIConfiguration {
+	return &firecracker.CNIConfiguration{
+		NetworkName: cni.NetworkName,
+		IfName:      cni.IfName,
+		BinPath:     cni.BinPath,
+		ConfDir:     cni.ConfDir,
+		CacheDir:    m.cniCacheDir(id),
+	}
+}
+
+// recordCNIResult copies the tap, MAC and address CNI assigned into the VM
+func recordCNIResult(vm *models.VM, ifaces firecracker.NetworkInterfaces) {
+	for i := range vm.Config.NetworkInterfaces {
+		nic := &vm.Config.NetworkInterfaces[i]
+		if nic.CNI == nil || i >= len(ifaces) || ifaces[i].StaticConfiguration == nil {
+			continue
+		}
+
+		static := ifaces[i].StaticConfiguration
+		nic.Device = static.HostDevName
+		nic.MacAddress = static.MacAddress
+		if static.IPConfiguration != nil {
+			nic.IPAddress = static.IPConfiguration.IPAddr.String()
+			nic.Gateway = static.IPConfiguration.Gateway.String()
+		}
+	}
+}
+
+// clearCNIResult forgets what CNI assigned, it only holds while the VM runs
+func clearCNIResult(vm *models.VM) {
+	for i := range vm.Config.NetworkInterfaces {
+		nic := &vm.Config.NetworkInterfaces[i]
+		if nic.CNI == nil {
+			continue
+		}
+		nic.Device = ""
+		nic.MacAddress = ""
+		nic.IPAddress = ""
+		nic.Gateway = ""
+	}
+}
+
+// teardownCNI runs CNI DEL and removes the network namespace of a VM whose
+// SDK cleanup was lost, because the VM was started by a previous daemon
+func (m *Manager) teardownCNI(vm *models.VM) {
+	if !hasCNINICs(&vm.Config) {
+		return
+	}
+
+	netNS := cniNetNSPath(vm.ID)
+	for _, nic := range vm.Config.NetworkInterfaces {
+		if nic.CNI == nil {
+			continue
+		}
+
+		confDir := nic.CNI.ConfDir
+		if confDir == "" {
+			confDir = defaultCNIConfDir
+		}
+		binPath := nic.CNI.BinPath
+		if len(binPath) == 0 {
+			binPath = []string{defaultCNIBinDir}
+		}
+
+		conf, err := libcni.LoadConfList(confDir, nic.CNI.NetworkName)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Str("network", nic.CNI.NetworkName).Msg("Failed to load CNI network")
+			continue
+		}
+
+		cni := libcni.NewCNIConfigWithCacheDir(binPath, m.cniCacheDir(vm.ID), nil)
+		if err := cni.DelNetworkList(context.Background(), conf, &libcni.RuntimeConf{
+			ContainerID: vm.ID,
+			NetNS:       netNS,
+			IfName:      nic.CNI.IfName,
+		}); err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Str("network", nic.CNI.NetworkName).Msg("CNI DEL failed")
+		}
+	}
+
+	if _, err := os.Stat(netNS); err == nil {
+		_ = unix.Unmount(netNS, unix.MNT_DETACH)
+		if err := os.Remove(netNS); err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Str("netns", netNS).Msg("Failed to remove network namespace")
+		}
+	}
+}
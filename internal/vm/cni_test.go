@@ -0,0 +1,77 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"net"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+func TestValidateCNI(t *testing.T) {
+	cni := &models.CNIConfig{NetworkName: "fcnet"}
+
+	cases := []struct {
+		name    string
+		cfg     models.VMConfig
+		wantErr bool
+	}{
+		{"static only", models.VMConfig{NetworkInterfaces: []models.NIC{{Device: "tap0"}, {Device: "tap1"}}}, false},
+		{"single CNI", models.VMConfig{NetworkInterfaces: []models.NIC{{CNI: cni}}}, false},
+		{"no network name", models.VMConfig{NetworkInterfaces: []models.NIC{{CNI: &models.CNIConfig{}}}}, true},
+		{"second NIC", models.VMConfig{NetworkInterfaces: []models.NIC{{CNI: cni}, {Device: "tap0"}}}, true},
+		{"managed too", models.VMConfig{NetworkInterfaces: []models.NIC{{CNI: cni, Managed: true}}}, true},
+		{"ip= argument", models.VMConfig{KernelOpts: "console=ttyS0 ip=dhcp", NetworkInterfaces: []models.NIC{{CNI: cni}}}, true},
+	}
+
+	for _, c := range cases {
+		if err := validateCNI(&c.cfg); (err != nil) != c.wantErr {
+			t.Errorf("%s: validateCNI() error = %v, wantErr %v", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestRecordCNIResult(t *testing.T) {
+	vm := &models.VM{Config: models.VMConfig{
+		NetworkInterfaces: []models.NIC{{CNI: &models.CNIConfig{NetworkName: "fcnet"}}},
+	}}
+
+	_, ipNet, _ := net.ParseCIDR("192.168.127.0/24")
+	ipNet.IP = net.ParseIP("192.168.127.2").To4()
+	recordCNIResult(vm, firecracker.NetworkInterfaces{{
+		StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+			HostDevName: "tap0",
+			MacAddress:  "02:00:00:00:00:01",
+			IPConfiguration: &firecracker.IPConfiguration{
+				IPAddr:  *ipNet,
+				Gateway: net.ParseIP("192.168.127.1"),
+			},
+		},
+	}})
+
+	nic := vm.Config.NetworkInterfaces[0]
+	if nic.Device != "tap0" || nic.MacAddress != "02:00:00:00:00:01" {
+		t.Errorf("recordCNIResult() device = %q, mac = %q", nic.Device, nic.MacAddress)
+	}
+	if nic.IPAddress != "192.168.127.2/24" || nic.Gateway != "192.168.127.1" {
+		t.Errorf("recordCNIResult() ip = %q, gateway = %q", nic.IPAddress, nic.Gateway)
+	}
+
+	clearCNIResult(vm)
+	if nic := vm.Config.NetworkInterfaces[0]; nic.IPAddress != "" || nic.Device != "" || nic.CNI == nil {
+		t.Errorf("clearCNIResult() left %+v", nic)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/google/uuid"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Output kept for clients that attach after the guest printed something
+	consoleScrollback = 64 * 1024
+
+	consoleChannelSize = 256
+)
+
+// Console is a VM's serial console, backed by a PTY or, when no PTY can be
+// allocated, a pair of pipes
+type Console struct {
+	pty    *os.File // PTY master, nil when using pipes
+	input  io.WriteCloser
+	output io.ReadCloser
+
+	// Ends handed to Firecracker, closed once the process has started
+	guestIn  *os.File
+	guestOut *os.File
+
+	mu         sync.Mutex
+	clients    map[string]chan []byte
+	scrollback []byte
+	closed     bool
+	closeOnce  sync.Once
+}
+
+// newConsole allocates a PTY for a VM, falling back to pipes
+func newConsole() (*Console, error) {
+	master, slave, err := openPTY()
+	if err == nil {
+		return &Console{
+			pty:      master,
+			input:    master,
+			output:   master,
+			guestIn:  slave,
+			guestOut: slave,
+			clients:  make(map[string]chan []byte),
+		}, nil
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create console input pipe: %w", err)
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, fmt.Errorf("failed to create console output pipe: %w", err)
+	}
+
+	return &Console{
+		input:    inW,
+		output:   outR,
+		guestIn:  inR,
+		guestOut: outW,
+		clients:  make(map[string]chan []byte),
+	}, nil
+}
+
+// start copies console output to attached clients and to log until the
+// console is closed or Firecracker exits
+func (c *Console) start(log io.Writer) {
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := c.output.Read(buf)
+			if n > 0 {
+				data := make([]byte, n)
+				copy(data, buf[:n])
+				_, _ = log.Write(data)
+				c.broadcast(data)
+			}
+			if err != nil {
+				// A PTY master returns EIO once Firecracker exits
+				c.Close()
+				return
+			}
+		}
+	}()
+}
+
+// releaseGuest closes the ends handed to Firecracker once it holds its own
+// copies, so reads fail when the process exits
+func (c *Console) releaseGuest() {
+	c.guestIn.Close()
+	if c.guestOut != c.guestIn {
+		c.guestOut.Close()
+	}
+}
+
+// broadcast sends output to every attached client, dropping it for clients
+// that are not keeping up
+func (c *Console) broadcast(data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.scrollback = append(c.scrollback, data...)
+	if len(c.scrollback) > consoleScrollback {
+		c.scrollback = c.scrollback[len(c.scrollback)-consoleScrollback:]
+	}
+
+	for _, ch := range c.clients {
+		select {
+		case ch <- data:
+		default:
+		}
+	}
+}
+
+// Attach registers a client and returns its ID, a channel of output and the
+// recent scrollback. The channel is closed when the console closes.
+func (c *Console) Attach() (string, <-chan []byte, []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := uuid.New().String()
+	ch := make(chan []byte, consoleChannelSize)
+	if c.closed {
+		close(ch)
+	} else {
+		c.clients[id] = ch
+	}
+
+	scrollback := make([]byte, len(c.scrollback))
+	copy(scrollback, c.scrollback)
+	return id, ch, scrollback
+}
+
+// Detach removes a client
+func (c *Console) Detach(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ch, ok := c.clients[id]; ok {
+		close(ch)
+		delete(c.clients, id)
+	}
+}
+
+// Write sends input to the guest
+func (c *Console) Write(p []byte) (int, error) {
+	return c.input.Write(p)
+}
+
+// Resize sets the terminal size. It is a no-op for pipe-backed consoles.
+func (c *Console) Resize(cols, rows uint16) error {
+	if c.pty == nil {
+		return nil
+	}
+	return unix.IoctlSetWinsize(int(c.pty.Fd()), unix.TIOCSWINSZ, &unix.Winsize{
+		Col: cols,
+		Row: rows,
+	})
+}
+
+// Close releases the console and disconnects all clients
+func (c *Console) Close() error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		for id, ch := range c.clients {
+			close(ch)
+			delete(c.clients, id)
+		}
+		c.mu.Unlock()
+
+		c.releaseGuest()
+		c.input.Close()
+		if c.pty == nil {
+			c.output.Close()
+		}
+	})
+	return nil
+}
+
+// openPTY allocates a PTY pair with the slave in raw mode, leaving line
+// editing and echo to the guest's own terminal
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fd := int(master.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock pty: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to get pty number: %w", err)
+	}
+
+	slave, err := os.OpenFile("/dev/pts/"+strconv.Itoa(int(n)), os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	if err := makeRaw(int(slave.Fd())); err != nil {
+		master.Close()
+		slave.Close()
+		return nil, nil, fmt.Errorf("failed to set pty raw mode: %w", err)
+	}
+
+	return master, slave, nil
+}
+
+// makeRaw is the equivalent of cfmakeraw(3)
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
+
+// Console returns the serial console of a running VM
+func (m *Manager) Console(id string) (*Console, error) {
+	m.mu.RLock()
+	running, exists := m.runningVMs[id]
+	m.mu.RUnlock()
+
+	if !exists {
+		if _, err := m.store.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrVMNotRunning
+	}
+
+	// Adopted VMs kept the console of the daemon that started them
+	if running.console == nil {
+		return nil, models.ErrConsoleNotFound
+	}
+	return running.console, nil
+}
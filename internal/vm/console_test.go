@@ -0,0 +1,68 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestConsole(t *testing.T) {
+	console, err := newConsole()
+	if err != nil {
+		t.Fatalf("newConsole failed: %v", err)
+	}
+	defer console.Close()
+
+	console.start(io.Discard)
+
+	id, output, _ := console.Attach()
+	defer console.Detach(id)
+
+	// Guest output reaches attached clients
+	if _, err := console.guestOut.Write([]byte("login: ")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-output:
+		if string(data) != "login: " {
+			t.Errorf("unexpected output %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for console output")
+	}
+
+	// Client input reaches the guest
+	if _, err := console.Write([]byte("root\n")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(console.guestIn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "root\n" {
+		t.Errorf("unexpected input %q", buf)
+	}
+
+	// Late clients get the scrollback
+	_, _, scrollback := console.Attach()
+	if string(scrollback) != "login: " {
+		t.Errorf("unexpected scrollback %q", scrollback)
+	}
+
+	if err := console.Resize(120, 40); err != nil {
+		t.Errorf("Resize failed: %v", err)
+	}
+}
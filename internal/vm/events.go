@@ -0,0 +1,160 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// eventBufferSize is how many events a subscriber may fall behind before it
+// is dropped
+const eventBufferSize = 256
+
+// EventSubscriber receives the events published after it subscribed. Its
+// channel is closed when it falls too far behind, after which it should
+// subscribe again from the last sequence number it received, and when the
+// bus is closed.
+type EventSubscriber struct {
+	Channel chan *models.Event
+}
+
+// EventBus publishes VM lifecycle events. Events are stored before they are
+// sent, so subscribers can resume from a sequence number.
+type EventBus struct {
+	store       *storage.EventStore
+	subscribers map[*EventSubscriber]struct{}
+	closed      bool
+	mu          sync.Mutex // Orders publishing, so subscribers see increasing sequence numbers
+	logger      *logging.Logger
+}
+
+// NewEventBus creates a new EventBus
+func NewEventBus(store *storage.Store) *EventBus {
+	return &EventBus{
+		store:       storage.NewEventStore(store),
+		subscribers: make(map[*EventSubscriber]struct{}),
+		logger:      logging.GetLogger().WithComponent("events"),
+	}
+}
+
+// Publish stores an event, assigning its sequence number, and sends it to
+// all subscribers
+func (b *EventBus) Publish(event *models.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.Timestamp = time.Now()
+	if err := b.store.Append(event); err != nil {
+		b.logger.Error().Err(err).Str("vm_id", event.VMID).Str("type", string(event.Type)).Msg("Failed to store event")
+		return
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.Channel <- event:
+		default:
+			// Too far behind, it has to resume
+			close(sub.Channel)
+			delete(b.subscribers, sub)
+		}
+	}
+}
+
+// Close ends every subscription, so streams finish before the API server
+// shuts down. Events are still stored, and later subscribers get a closed
+// channel.
+func (b *EventBus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		close(sub.Channel)
+		delete(b.subscribers, sub)
+	}
+}
+
+// Subscribe registers a subscriber for events published from now on
+func (b *EventBus) Subscribe() *EventSubscriber {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe()
+}
+
+// Resume registers a subscriber and returns the stored events after since,
+// which come before anything sent on its channel. Events older than the
+// retention are gone.
+func (b *EventBus) Resume(since uint64) (*EventSubscriber, []*models.Event, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, nil, models.ErrEventBusClosed
+	}
+	backlog, err := b.store.Since(since, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b.subscribe(), backlog, nil
+}
+
+// subscribe adds a subscriber, mu must be held
+func (b *EventBus) subscribe() *EventSubscriber {
+	sub := &EventSubscriber{Channel: make(chan *models.Event, eventBufferSize)}
+	if b.closed {
+		close(sub.Channel)
+		return sub
+	}
+	b.subscribers[sub] = struct{}{}
+	return sub
+}
+
+// Unsubscribe removes a subscriber
+func (b *EventBus) Unsubscribe(sub *EventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subscribers[sub]; ok {
+		close(sub.Channel)
+		delete(b.subscribers, sub)
+	}
+}
+
+// Events returns the lifecycle event bus
+func (m *Manager) Events() *EventBus {
+	return m.events
+}
+
+// emit publishes a lifecycle event for a VM
+func (m *Manager) emit(eventType models.EventType, vm *models.VM, from, to models.VMStatus, actor string) {
+	event := &models.Event{
+		Type:      eventType,
+		VMID:      vm.ID,
+		VMName:    vm.Name,
+		OwnerID:   vm.OwnerID,
+		Actor:     actor,
+		OldStatus: from,
+		NewStatus: to,
+	}
+	if eventType == models.EventCrashed {
+		event.Message = vm.Error
+	}
+	m.events.Publish(event)
+}
@@ -0,0 +1,166 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+func TestEventBus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agni.db")
+	store, err := storage.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(store)
+
+	sub := m.Events().Subscribe()
+	req := models.CreateVMRequest{Name: "web", Labels: map[string]string{"tier": "web"}, Autostart: true, BootOrder: 2}
+	vm, err := m.Create(req, "alice", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stored in one write, before anyone hears of the VM
+	if stored, err := m.Get(vm.ID); err != nil || stored.Labels["tier"] != "web" || !stored.Autostart || stored.BootOrder != 2 {
+		t.Errorf("created VM = %+v, %v, want labels and autostart settings", stored, err)
+	}
+	if _, err := m.Update(vm.ID, func(vm *models.VM) { vm.Labels = map[string]string{"tier": "db"} }, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete(vm.ID, "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		eventType models.EventType
+		actor     string
+		from, to  models.VMStatus
+	}{
+		{models.EventCreated, "alice", "", models.VMStatusStopped},
+		{models.EventConfigChanged, "bob", models.VMStatusStopped, models.VMStatusStopped},
+		{models.EventDeleted, "alice", models.VMStatusStopped, ""},
+	}
+	for i, w := range want {
+		event := <-sub.Channel
+		if event.Sequence != uint64(i+1) || event.Type != w.eventType || event.Actor != w.actor ||
+			event.OldStatus != w.from || event.NewStatus != w.to || event.VMID != vm.ID || event.OwnerID != "alice" {
+			t.Errorf("event %d = %+v, want %s by %s from %q to %q", i+1, event, w.eventType, w.actor, w.from, w.to)
+		}
+	}
+	m.Events().Unsubscribe(sub)
+
+	// A subscriber that falls behind is dropped
+	slow := m.Events().Subscribe()
+	for i := 0; i <= eventBufferSize; i++ {
+		m.Events().Publish(&models.Event{Type: models.EventConfigChanged, VMID: "x"})
+	}
+	for range slow.Channel {
+	}
+	m.Events().Unsubscribe(slow)
+
+	// Sequence numbers survive a restart and clients resume after the last one they saw
+	store.Close()
+	store, err = storage.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	bus := NewEventBus(store)
+
+	total := uint64(len(want) + eventBufferSize + 1)
+	bus.Publish(&models.Event{Type: models.EventCreated, VMID: "y"})
+	resumed, backlog, err := bus.Resume(total - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlog) != 2 || backlog[0].Sequence != total || backlog[1].Sequence != total+1 || backlog[1].VMID != "y" {
+		t.Errorf("Resume() backlog = %+v", backlog)
+	}
+
+	// Closing the bus ends every subscription, including later ones
+	bus.Close()
+	if _, ok := <-resumed.Channel; ok {
+		t.Errorf("subscriber still open after Close()")
+	}
+	bus.Unsubscribe(resumed)
+	if _, ok := <-bus.Subscribe().Channel; ok {
+		t.Errorf("Subscribe() after Close() returned an open subscriber")
+	}
+	if _, _, err := bus.Resume(0); err != models.ErrEventBusClosed {
+		t.Errorf("Resume() after Close() error = %v, want %v", err, models.ErrEventBusClosed)
+	}
+}
+
+func TestStatusChangeEvents(t *testing.T) {
+	dir, err := os.MkdirTemp("", "agni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	vm := &models.VM{ID: "vm", Status: models.VMStatusRunning}
+	if err := m.store.Create(vm); err != nil {
+		t.Fatal(err)
+	}
+	socketPath := filepath.Join(dir, "fc.sock")
+	fakeFirecracker(t, socketPath, "Running")
+	machine, err := firecracker.NewMachine(context.Background(), firecracker.Config{SocketPath: socketPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.runningVMs[vm.ID] = &RunningVM{Machine: machine}
+
+	sub := m.Events().Subscribe()
+	defer m.Events().Unsubscribe(sub)
+
+	if err := m.Pause(vm.ID, "alice"); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if err := m.Resume(vm.ID, "bob"); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	// Metadata of a VM that is not running is only stored
+	delete(m.runningVMs, vm.ID)
+	if _, err := m.SetMetadata(vm.ID, map[string]interface{}{"role": "web"}, "carol"); err != nil {
+		t.Fatalf("SetMetadata() error = %v", err)
+	}
+
+	want := []struct {
+		actor    string
+		from, to models.VMStatus
+	}{
+		{"alice", models.VMStatusRunning, models.VMStatusPaused},
+		{"bob", models.VMStatusPaused, models.VMStatusRunning},
+		{"carol", models.VMStatusRunning, models.VMStatusRunning},
+	}
+	for i, w := range want {
+		event := <-sub.Channel
+		if event.Type != models.EventConfigChanged || event.Actor != w.actor || event.OldStatus != w.from || event.NewStatus != w.to {
+			t.Errorf("event %d = %+v, want config-changed by %s from %q to %q", i+1, event, w.actor, w.from, w.to)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"syscall"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+const (
+	defaultJailerBinary  = "jailer"
+	defaultChrootBaseDir = "/srv/jailer"
+
+	// The jailer's chroot lives in <base>/<exec file name>/<id>/root
+	chrootRootName = "root"
+
+	// Relative to the chroot; the SDK turns it into the host path
+	jailedSocketPath = "firecracker.socket"
+
+	stageChrootHandlerName = "agni.StageChrootFiles"
+)
+
+// jailerID is the jailer's own rule for --id, which also keeps the chroot
+// path from escaping the base directory
+var jailerID = regexp.MustCompile(`^[A-Za-z0-9-]{1,64}$`)
+
+// JailerSettings are the jailer paths and users chosen by the host's admin.
+// VMs cannot pick their own paths: the jailer runs as root and agni removes
+// the chroot it creates on every start, stop and delete. Files staged into the
+// chroot are handed to the jailed user, so only the allowed UIDs and GIDs may
+// be used.
+type JailerSettings struct {
+	Binary        string // Jailer binary
+	ChrootBaseDir string // Where chroots are created
+	UIDs          []int  // Users jailed VMs may run as
+	GIDs          []int  // Groups jailed VMs may run as
+}
+
+// DefaultJailerSettings returns the default jailer paths
+func DefaultJailerSettings() JailerSettings {
+	return JailerSettings{
+		Binary:        defaultJailerBinary,
+		ChrootBaseDir: defaultChrootBaseDir,
+	}
+}
+
+// SetJailer changes the jailer paths used for jailed VMs
+func (m *Manager) SetJailer(settings JailerSettings) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.jailer = settings
+}
+
+// validateJailer rejects jailer IDs the jailer would refuse or another VM
+// already uses, users the host does not allow and paths other than the
+// configured ones. Leaving a path empty selects the configured one.
+func (m *Manager) validateJailer(cfg *models.VMConfig) error {
+	jc := cfg.Jailer
+	if jc == nil {
+		return nil
+	}
+
+	if jc.ID != "" && !jailerID.MatchString(jc.ID) {
+		return models.ErrInvalidJailerConfig
+	}
+	if !m.jailerUserAllowed(jc) {
+		return models.ErrInvalidJailerConfig
+	}
+	if jc.Binary != "" && jc.Binary != m.jailer.Binary {
+		return models.ErrInvalidJailerConfig
+	}
+	if jc.ChrootBaseDir != "" && filepath.Clean(jc.ChrootBaseDir) != filepath.Clean(m.jailer.ChrootBaseDir) {
+		return models.ErrInvalidJailerConfig
+	}
+	if jc.ExecFile != "" {
+		bin, err := m.getFirecrackerBinary()
+		if err != nil || filepath.Clean(jc.ExecFile) != bin {
+			return models.ErrInvalidJailerConfig
+		}
+	}
+
+	// Every start and stop removes the chroot, so two VMs cannot share one
+	if jc.ID != "" {
+		vms, err := m.store.List()
+		if err != nil {
+			return err
+		}
+		for _, other := range vms {
+			if other.Config.Jailer != nil && effectiveJailerID(other) == jc.ID {
+				return models.ErrJailerIDInUse
+			}
+		}
+	}
+	return nil
+}
+
+// effectiveJailerID returns the jailer ID a jailed VM runs under
+func effectiveJailerID(vm *models.VM) string {
+	if vm.Config.Jailer.ID != "" {
+		return vm.Config.Jailer.ID
+	}
+	return vm.ID
+}
+
+// buildJailerConfig converts a VM's jailer settings to the SDK's. The paths
+// always come from the host's settings, whatever an older record says.
+// Returns nil if the VM does not use the jailer. Daemonize is never passed
+// on: a daemonized jailer detaches and sends the console to /dev/null,
+// leaving nothing for the manager to supervise.
+func (m *Manager) buildJailerConfig(vm *models.VM) (*firecracker.JailerConfig, error) {
+	jc := vm.Config.Jailer
+	if jc == nil {
+		return nil, nil
+	}
+
+	execFile, err := m.getFirecrackerBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	id := effectiveJailerID(vm)
+	if !jailerID.MatchString(id) || !m.jailerUserAllowed(jc) {
+		return nil, models.ErrInvalidJailerConfig
+	}
+
+	return &firecracker.JailerConfig{
+		GID:            firecracker.Int(jc.GID),
+		UID:            firecracker.Int(jc.UID),
+		ID:             id,
+		NumaNode:       firecracker.Int(jc.NumaNode),
+		ExecFile:       execFile,
+		JailerBinary:   m.jailer.Binary,
+		ChrootBaseDir:  m.jailer.ChrootBaseDir,
+		ChrootStrategy: stagingChrootStrategy{diskDir: m.diskDir(vm.ID)},
+	}, nil
+}
+
+// jailerUserAllowed reports whether the host allows a jailed VM's UID and GID
+func (m *Manager) jailerUserAllowed(jc *models.JailerConfig) bool {
+	return containsInt(m.jailer.UIDs, jc.UID) && containsInt(m.jailer.GIDs, jc.GID)
+}
+
+// containsInt reports whether list contains n
+func containsInt(list []int, n int) bool {
+	for _, item := range list {
+		if item == n {
+			return true
+		}
+	}
+	return false
+}
+
+// chrootDir returns the directory the jailer creates for a VM
+func chrootDir(jc *firecracker.JailerConfig) string {
+	return filepath.Join(jc.ChrootBaseDir, filepath.Base(jc.ExecFile), jc.ID)
+}
+
+// chrootRoot returns the directory Firecracker sees as /
+func chrootRoot(jc *firecracker.JailerConfig) string {
+	return filepath.Join(chrootDir(jc), chrootRootName)
+}
+
+// stagingChrootStrategy stages the kernel, drives, FIFOs and vsock sockets
+// into the chroot. Unlike the SDK's NaiveChrootStrategy it gives files unique
+// names and hands copies of read-only files to the jailed user, never the
+// host's originals.
+type stagingChrootStrategy struct {
+	diskDir string // The VM's own disk copies, which may be handed over
+}
+
+// AdaptHandlers implements firecracker.HandlersAdapter
+func (s stagingChrootStrategy) AdaptHandlers(handlers *firecracker.Handlers) error {
+	if !handlers.FcInit.Has(firecracker.CreateLogFilesHandlerName) {
+		return firecracker.ErrRequiredHandlerMissing
+	}
+
+	handlers.FcInit = handlers.FcInit.AppendAfter(
+		firecracker.CreateLogFilesHandlerName,
+		firecracker.Handler{Name: stageChrootHandlerName, Fn: s.stageChrootFiles},
+	)
+	return nil
+}
+
+// stageChrootFiles places every file Firecracker opens inside the chroot and
+// rewrites the machine config to the paths it sees from inside
+func (s stagingChrootStrategy) stageChrootFiles(ctx context.Context, m *firecracker.Machine) error {
+	jc := m.Cfg.JailerCfg
+	if jc == nil {
+		return firecracker.ErrMissingJailerConfig
+	}
+	root := chrootRoot(jc)
+	uid, gid := *jc.UID, *jc.GID
+
+	if err := stageFile(m.Cfg.KernelImagePath, filepath.Join(root, "vmlinux"), true, s.diskDir, uid, gid); err != nil {
+		return fmt.Errorf("failed to stage kernel: %w", err)
+	}
+	m.Cfg.KernelImagePath = "vmlinux"
+
+	if m.Cfg.InitrdPath != "" {
+		if err := stageFile(m.Cfg.InitrdPath, filepath.Join(root, "initrd"), true, s.diskDir, uid, gid); err != nil {
+			return fmt.Errorf("failed to stage initrd: %w", err)
+		}
+		m.Cfg.InitrdPath = "initrd"
+	}
+
+	for i, drive := range m.Cfg.Drives {
+		name := "drive-" + firecracker.StringValue(drive.DriveID)
+		readOnly := firecracker.BoolValue(drive.IsReadOnly)
+		if err := stageFile(firecracker.StringValue(drive.PathOnHost), filepath.Join(root, name), readOnly, s.diskDir, uid, gid); err != nil {
+			return fmt.Errorf("failed to stage drive %s: %w", firecracker.StringValue(drive.DriveID), err)
+		}
+		m.Cfg.Drives[i].PathOnHost = firecracker.String(name)
+	}
+
+	// The FIFOs are created directly in the chroot, they only need handing over
+	for _, fifo := range []*string{&m.Cfg.LogFifo, &m.Cfg.MetricsFifo} {
+		if *fifo == "" {
+			continue
+		}
+		if err := os.Chown(*fifo, uid, gid); err != nil {
+			return fmt.Errorf("failed to chown %s: %w", *fifo, err)
+		}
+		*fifo = filepath.Base(*fifo)
+	}
+
+	// Firecracker creates vsock sockets itself; linkVsockSockets exposes them
+	for i := range m.Cfg.VsockDevices {
+		m.Cfg.VsockDevices[i].Path = vsockSocketName(i)
+	}
+
+	return nil
+}
+
+// stageFile places src in the chroot for the jailed user. Read-only files
+// are copied, reflinked where possible, and the copy is handed over. Writable
+// files must be hard-linked, or guest writes would land in a throwaway copy.
+// Chowning a hard link changes src itself, so only the VM's own copies in
+// diskDir are handed over; any other writable file must already belong to
+// the jailed user.
+func stageFile(src, dst string, readOnly bool, diskDir string, uid, gid int) error {
+	if readOnly {
+		if _, err := copyDisk(src, dst); err != nil {
+			return err
+		}
+		return os.Chown(dst, uid, gid)
+	}
+
+	if err := os.Link(src, dst); err != nil {
+		if errors.Is(err, syscall.EXDEV) {
+			return fmt.Errorf("%s is not on the same filesystem as the chroot base directory", src)
+		}
+		return err
+	}
+	info, err := os.Lstat(dst)
+	if err != nil {
+		return err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	if int(stat.Uid) == uid && int(stat.Gid) == gid {
+		return nil
+	}
+	if diskDir == "" || filepath.Dir(filepath.Clean(src)) != filepath.Clean(diskDir) {
+		return fmt.Errorf("%s must belong to the jailed user %d:%d", src, uid, gid)
+	}
+	return os.Chown(dst, uid, gid)
+}
+
+// vsockSocketName is the name of a vsock socket inside the chroot
+func vsockSocketName(index int) string {
+	return fmt.Sprintf("vsock-%d.sock", index)
+}
+
+// linkVsockSockets links the VM's vsock paths to the sockets Firecracker
+// created inside the chroot. Only a stale link or socket is replaced.
+func (m *Manager) linkVsockSockets(vm *models.VM, jc *firecracker.JailerConfig) {
+	for i := range vm.Config.VsockDevices {
+		path := m.vsockPath(vm.ID, i)
+		target := filepath.Join(chrootRoot(jc), vsockSocketName(i))
+		if info, err := os.Lstat(path); err == nil && info.Mode()&(os.ModeSymlink|os.ModeSocket) != 0 {
+			_ = os.Remove(path)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Str("path", path).Msg("Failed to link vsock socket out of chroot")
+		}
+	}
+}
+
+// cleanupJail removes a jailed VM's chroot and the vsock links pointing into
+// it. It is a no-op for VMs that do not use the jailer.
+func (m *Manager) cleanupJail(vm *models.VM) {
+	jc, err := m.buildJailerConfig(vm)
+	if err != nil || jc == nil {
+		return
+	}
+
+	dir := chrootDir(jc)
+	if !isChrootDir(jc, dir) {
+		m.logger.Error().Str("vm_id", vm.ID).Str("dir", dir).Msg("Refusing to remove a directory that is not a jailer chroot")
+		return
+	}
+	for i := range vm.Config.VsockDevices {
+		path := m.vsockPath(vm.ID, i)
+		if target, err := os.Readlink(path); err == nil && filepath.Dir(target) == chrootRoot(jc) {
+			_ = os.Remove(path)
+		}
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		m.logger.Warn().Err(err).Str("vm_id", vm.ID).Str("dir", dir).Msg("Failed to remove jailer chroot")
+	}
+}
+
+// isChrootDir reports whether dir is exactly <base>/<exec file name>/<id> and
+// is a real directory, so that removing it cannot reach anything else
+func isChrootDir(jc *firecracker.JailerConfig, dir string) bool {
+	base := filepath.Clean(jc.ChrootBaseDir)
+	execName := filepath.Base(jc.ExecFile)
+	if !filepath.IsAbs(base) || base == "/" || !jailerID.MatchString(jc.ID) ||
+		execName == "." || execName == ".." || execName == string(filepath.Separator) {
+		return false
+	}
+	if dir != filepath.Join(base, execName, jc.ID) {
+		return false
+	}
+
+	// A symlink planted in place of the chroot or its parent could point anywhere
+	for _, path := range []string{filepath.Dir(dir), dir} {
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
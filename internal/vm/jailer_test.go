@@ -0,0 +1,241 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+func TestStageFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(src, []byte("rootfs"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+
+	dst := filepath.Join(dir, "drive-1")
+	if err := stageFile(src, dst, false, "", uid, gid); err != nil {
+		t.Fatalf("stageFile failed: %v", err)
+	}
+
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !os.SameFile(srcInfo, dstInfo) {
+		t.Errorf("expected writable drive to be hard-linked, not copied")
+	}
+
+	// Read-only files are copied, so handing them over leaves src alone
+	kernel := filepath.Join(dir, "vmlinux")
+	if err := stageFile(src, kernel, true, "", uid, gid); err != nil {
+		t.Fatalf("stageFile of a read-only file failed: %v", err)
+	}
+	if kernelInfo, err := os.Stat(kernel); err != nil || os.SameFile(srcInfo, kernelInfo) {
+		t.Errorf("expected read-only file to be copied, not hard-linked")
+	}
+
+	// A writable file of someone else's is never handed over through a link
+	if err := stageFile(src, filepath.Join(dir, "drive-2"), false, "", uid+1, gid+1); err == nil {
+		t.Errorf("expected a writable file owned by another user to be refused")
+	}
+	if info, _ := os.Stat(src); info.Sys().(*syscall.Stat_t).Uid != uint32(uid) {
+		t.Errorf("src changed owner")
+	}
+
+	// The VM's own disk copies are
+	if os.Geteuid() == 0 {
+		if err := stageFile(src, filepath.Join(dir, "drive-3"), false, dir, uid+1, gid+1); err != nil {
+			t.Errorf("stageFile of the VM's own disk failed: %v", err)
+		}
+	}
+}
+
+func TestStagingChrootStrategy(t *testing.T) {
+	handlers := firecracker.Handlers{
+		FcInit: firecracker.HandlerList{}.Append(
+			firecracker.StartVMMHandler,
+			firecracker.CreateLogFilesHandler,
+			firecracker.CreateMachineHandler,
+		),
+	}
+
+	if err := (stagingChrootStrategy{}).AdaptHandlers(&handlers); err != nil {
+		t.Fatalf("AdaptHandlers failed: %v", err)
+	}
+	if !handlers.FcInit.Has(stageChrootHandlerName) {
+		t.Errorf("expected staging handler to be added")
+	}
+
+	empty := firecracker.Handlers{}
+	if err := (stagingChrootStrategy{}).AdaptHandlers(&empty); err != firecracker.ErrRequiredHandlerMissing {
+		t.Errorf("expected ErrRequiredHandlerMissing, got %v", err)
+	}
+}
+
+func TestValidateJailer(t *testing.T) {
+	bin := filepath.Join(t.TempDir(), "firecracker")
+	if err := os.WriteFile(bin, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+	m.SetFirecrackerBinary(bin)
+	m.jailer.UIDs = []int{1000}
+	m.jailer.GIDs = []int{1000}
+
+	// Jailer IDs of existing VMs, given or taken from the VM ID, are taken
+	for _, vm := range []*models.VM{
+		{ID: "db-1", Config: models.VMConfig{Jailer: &models.JailerConfig{}}},
+		{ID: "web-2", Config: models.VMConfig{Jailer: &models.JailerConfig{ID: "cache-1"}}},
+		{ID: "plain-1"},
+	} {
+		if err := m.store.Create(vm); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		jailer *models.JailerConfig
+		valid  bool
+	}{
+		{nil, true},
+		{&models.JailerConfig{UID: 1000, GID: 1000}, true},
+		{&models.JailerConfig{ID: "web-1", UID: 1000, GID: 1000, ExecFile: bin, ChrootBaseDir: "/srv/jailer/", Binary: "jailer"}, true},
+		{&models.JailerConfig{}, false},
+		{&models.JailerConfig{UID: 1000, GID: 0}, false},
+		{&models.JailerConfig{UID: 1001, GID: 1000}, false},
+		{&models.JailerConfig{ID: "../../..", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ID: "a/b", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ID: string(make([]byte, 65)), UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ChrootBaseDir: "/", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ExecFile: "/bin/sh", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{Binary: "/tmp/evil", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ID: "db-1", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ID: "cache-1", UID: 1000, GID: 1000}, false},
+		{&models.JailerConfig{ID: "plain-1", UID: 1000, GID: 1000}, true},
+	}
+
+	for _, c := range cases {
+		err := m.validateJailer(&models.VMConfig{Jailer: c.jailer})
+		if (err == nil) != c.valid {
+			t.Errorf("validateJailer(%+v) error = %v, want valid %v", c.jailer, err, c.valid)
+		}
+	}
+}
+
+func TestIsChrootDir(t *testing.T) {
+	base := t.TempDir()
+	jc := &firecracker.JailerConfig{ID: "vm-1", ExecFile: "/usr/bin/firecracker", ChrootBaseDir: base}
+
+	if !isChrootDir(jc, chrootDir(jc)) {
+		t.Errorf("expected %s to be accepted", chrootDir(jc))
+	}
+	if isChrootDir(jc, base) {
+		t.Errorf("expected the base directory to be refused")
+	}
+
+	// A chroot replaced by a symlink is left alone
+	if err := os.MkdirAll(filepath.Join(base, "firecracker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), chrootDir(jc)); err != nil {
+		t.Fatal(err)
+	}
+	if isChrootDir(jc, chrootDir(jc)) {
+		t.Errorf("expected a symlinked chroot to be refused")
+	}
+
+	for _, bad := range []*firecracker.JailerConfig{
+		{ID: "..", ExecFile: jc.ExecFile, ChrootBaseDir: base},
+		{ID: "vm-1", ExecFile: jc.ExecFile, ChrootBaseDir: "/"},
+		{ID: "vm-1", ExecFile: "/", ChrootBaseDir: base},
+	} {
+		if isChrootDir(bad, chrootDir(bad)) {
+			t.Errorf("expected %+v to be refused", bad)
+		}
+	}
+}
+
+func TestVsockPaths(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+	m.jailer.UIDs = []int{1000}
+	m.jailer.GIDs = []int{1000}
+
+	// A configured path is replaced by one in the VM's runtime directory
+	victim := filepath.Join(dir, "victim")
+	if err := os.WriteFile(victim, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	vm, err := m.Create(models.CreateVMRequest{Name: "vsock", Config: models.VMConfig{
+		VsockDevices: []models.Vsock{{Path: victim, CID: 3}},
+		Jailer:       &models.JailerConfig{UID: 1000, GID: 1000},
+	}}, "", "alice")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	path := m.vsockPath(vm.ID, 0)
+	if got := vm.Config.VsockDevices[0].Path; got != path {
+		t.Errorf("vsock path = %s, want %s", got, path)
+	}
+
+	// Neither linking nor cleaning up replaces a regular file
+	if err := os.MkdirAll(m.runDir(vm.ID), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("keep me"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	jc := &firecracker.JailerConfig{ID: vm.ID, ExecFile: "/usr/bin/firecracker", ChrootBaseDir: filepath.Join(dir, "jailer")}
+	m.linkVsockSockets(vm, jc)
+	for _, file := range []string{victim, path} {
+		if info, err := os.Lstat(file); err != nil || !info.Mode().IsRegular() {
+			t.Errorf("%s was replaced: %v, %v", file, info, err)
+		}
+	}
+
+	// A stale link is replaced
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(victim, path); err != nil {
+		t.Fatal(err)
+	}
+	m.linkVsockSockets(vm, jc)
+	if target, err := os.Readlink(path); err != nil || target != filepath.Join(chrootRoot(jc), vsockSocketName(0)) {
+		t.Errorf("vsock link = %s, %v, want it to point into the chroot", target, err)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+const maxLabelLength = 63
+
+var (
+	// Keys may carry a prefix, like team.example.com/owner
+	labelKeyPattern   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?)?$`)
+)
+
+// ValidateLabels rejects labels a selector could not match
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if len(key) > maxLabelLength || !labelKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: invalid key %q", models.ErrInvalidLabels, key)
+		}
+		if len(value) > maxLabelLength || !labelValuePattern.MatchString(value) {
+			return fmt.Errorf("%w: invalid value %q for %s", models.ErrInvalidLabels, value, key)
+		}
+	}
+	return nil
+}
+
+// selectorOp is how a requirement compares a label
+type selectorOp int
+
+const (
+	opEquals selectorOp = iota
+	opNotEquals
+	opExists
+	opNotExists
+)
+
+// requirement is a single term of a selector
+type requirement struct {
+	key   string
+	op    selectorOp
+	value string
+}
+
+// Selector matches labels against comma-separated requirements, all of
+// which must hold: key=value (or ==), key!=value, key and !key. A label that
+// is missing is not equal to any value.
+type Selector []requirement
+
+// ParseSelector parses a label selector such as env=staging,team!=infra.
+// An empty selector matches everything.
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	if strings.TrimSpace(s) == "" {
+		return selector, nil
+	}
+
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		var req requirement
+		switch {
+		case strings.Contains(term, "!="):
+			key, value, _ := strings.Cut(term, "!=")
+			req = requirement{key: key, op: opNotEquals, value: value}
+		case strings.Contains(term, "=="):
+			key, value, _ := strings.Cut(term, "==")
+			req = requirement{key: key, op: opEquals, value: value}
+		case strings.Contains(term, "="):
+			key, value, _ := strings.Cut(term, "=")
+			req = requirement{key: key, op: opEquals, value: value}
+		case strings.HasPrefix(term, "!"):
+			req = requirement{key: term[1:], op: opNotExists}
+		default:
+			req = requirement{key: term, op: opExists}
+		}
+
+		req.key = strings.TrimSpace(req.key)
+		req.value = strings.TrimSpace(req.value)
+		if err := ValidateLabels(map[string]string{req.key: req.value}); err != nil {
+			return nil, fmt.Errorf("%w: %q", models.ErrInvalidSelector, term)
+		}
+		selector = append(selector, req)
+	}
+	return selector, nil
+}
+
+// Matches reports whether labels satisfy every requirement
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, exists := labels[req.key]
+		switch req.op {
+		case opEquals:
+			if !exists || value != req.value {
+				return false
+			}
+		case opNotEquals:
+			if exists && value == req.value {
+				return false
+			}
+		case opExists:
+			if !exists {
+				return false
+			}
+		case opNotExists:
+			if exists {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Empty reports whether the selector matches everything
+func (s Selector) Empty() bool {
+	return len(s) == 0
+}
@@ -0,0 +1,67 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestSelector(t *testing.T) {
+	labels := map[string]string{"env": "staging", "team": "web", "canary": ""}
+
+	cases := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env=staging", true},
+		{"env==staging, team=web", true},
+		{"env=staging,team!=infra", true},
+		{"env=staging,team!=web", false},
+		{"env=prod", false},
+		{"region!=eu", true}, // Missing labels are not equal to anything
+		{"region=", false},
+		{"canary", true},
+		{"!canary", false},
+		{"!region", true},
+	}
+	for _, c := range cases {
+		selector, err := ParseSelector(c.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q) error = %v", c.selector, err)
+		}
+		if got := selector.Matches(labels); got != c.want {
+			t.Errorf("ParseSelector(%q).Matches() = %v, want %v", c.selector, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"env=a b", "=staging", "env=staging,", "!"} {
+		if _, err := ParseSelector(bad); !errors.Is(err, models.ErrInvalidSelector) {
+			t.Errorf("ParseSelector(%q) error = %v, want %v", bad, err, models.ErrInvalidSelector)
+		}
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	if err := ValidateLabels(map[string]string{"example.com/team": "web-1", "empty": ""}); err != nil {
+		t.Errorf("ValidateLabels() error = %v", err)
+	}
+	for _, labels := range []map[string]string{{"": "x"}, {"env": "a,b"}, {"-env": "x"}, {"env": "x="}} {
+		if err := ValidateLabels(labels); !errors.Is(err, models.ErrInvalidLabels) {
+			t.Errorf("ValidateLabels(%v) error = %v, want %v", labels, err, models.ErrInvalidLabels)
+		}
+	}
+}
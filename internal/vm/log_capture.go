@@ -0,0 +1,200 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// Log sources reported in models.LogEntry
+const (
+	LogSourceFirecracker = "firecracker"
+	LogSourceSerial      = "serial"
+	LogSourceSDK         = "sdk"
+)
+
+const (
+	logFifoName = "log.fifo"
+
+	// Lines longer than this are published in pieces
+	maxLogLineLength = 64 * 1024
+
+	// Firecracker timestamps carry no zone and are written in local time
+	firecrackerTimeLayout = "2006-01-02T15:04:05.999999999"
+)
+
+// firecrackerLogLevels maps Firecracker level names to LogStreamer levels
+var firecrackerLogLevels = map[string]string{
+	"ERROR": "error",
+	"WARN":  "warn",
+	"INFO":  "info",
+	"DEBUG": "debug",
+	"TRACE": "debug",
+}
+
+// lineWriter is an io.Writer that hands every complete line to a callback
+type lineWriter struct {
+	mu     sync.Mutex
+	buf    []byte
+	onLine func(line string)
+}
+
+// newLineWriter creates a lineWriter calling onLine for each line
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+// Write buffers p and emits any complete lines
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+
+	if len(w.buf) >= maxLogLineLength {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+// emit publishes a line, skipping blank ones
+func (w *lineWriter) emit(line []byte) {
+	s := strings.TrimRight(string(line), "\r")
+	if strings.TrimSpace(s) == "" {
+		return
+	}
+	w.onLine(s)
+}
+
+// firecrackerLogWriter returns a writer publishing Firecracker log lines
+func (m *Manager) firecrackerLogWriter(vmID string) io.Writer {
+	return newLineWriter(func(line string) {
+		m.logStreamer.Publish(vmID, parseFirecrackerLogLine(line))
+	})
+}
+
+// serialLogWriter returns a writer publishing guest serial console output
+func (m *Manager) serialLogWriter(vmID string) io.Writer {
+	return newLineWriter(func(line string) {
+		m.logStreamer.Publish(vmID, &models.LogEntry{
+			Timestamp: time.Now(),
+			Level:     "info",
+			Message:   line,
+			Source:    LogSourceSerial,
+		})
+	})
+}
+
+// sdkLogger returns a logger for the Firecracker SDK that also publishes to
+// the VM's log stream
+func (m *Manager) sdkLogger(vmID string) *log.Entry {
+	logger := log.New()
+	logger.AddHook(&sdkLogHook{vmID: vmID, streamer: m.logStreamer})
+	return log.NewEntry(logger)
+}
+
+// attachLogFifo copies an existing Firecracker log FIFO into the VM's log
+// stream. Used for adopted VMs, whose FIFO was set up by a previous daemon.
+func (m *Manager) attachLogFifo(vmID, path string) (io.Closer, error) {
+	fifo, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		_, _ = io.Copy(m.firecrackerLogWriter(vmID), fifo)
+	}()
+	return fifo, nil
+}
+
+// parseFirecrackerLogLine parses a line such as
+// "2024-05-01T10:00:00.123456789 [anonymous-instance:main:WARN:src/main.rs:42] message"
+func parseFirecrackerLogLine(line string) *models.LogEntry {
+	entry := &models.LogEntry{
+		Timestamp: time.Now(),
+		Level:     "info",
+		Source:    LogSourceFirecracker,
+	}
+
+	if ts, rest, ok := strings.Cut(line, " "); ok {
+		if t, err := time.ParseInLocation(firecrackerTimeLayout, ts, time.Local); err == nil {
+			entry.Timestamp = t
+			line = rest
+		}
+	}
+
+	if strings.HasPrefix(line, "[") {
+		if end := strings.Index(line, "]"); end > 0 {
+			for _, field := range strings.Split(line[1:end], ":") {
+				if level, ok := firecrackerLogLevels[field]; ok {
+					entry.Level = level
+					break
+				}
+			}
+			line = strings.TrimSpace(line[end+1:])
+		}
+	}
+
+	entry.Message = line
+	return entry
+}
+
+// sdkLogHook publishes SDK log entries to a VM's log stream
+type sdkLogHook struct {
+	vmID     string
+	streamer *LogStreamer
+}
+
+// Levels implements logrus.Hook
+func (h *sdkLogHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook
+func (h *sdkLogHook) Fire(e *log.Entry) error {
+	level := "info"
+	switch e.Level {
+	case log.PanicLevel, log.FatalLevel, log.ErrorLevel:
+		level = "error"
+	case log.WarnLevel:
+		level = "warn"
+	case log.DebugLevel, log.TraceLevel:
+		level = "debug"
+	}
+
+	h.streamer.Publish(h.vmID, &models.LogEntry{
+		Timestamp: e.Time,
+		Level:     level,
+		Message:   e.Message,
+		Source:    LogSourceSDK,
+	})
+	return nil
+}
@@ -0,0 +1,72 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"testing"
+)
+
+func TestParseFirecrackerLogLine(t *testing.T) {
+	cases := []struct {
+		line    string
+		level   string
+		message string
+	}{
+		{
+			line:    "2024-05-01T10:00:00.123456789 [anonymous-instance:main:WARN:src/main.rs:42] Disk is slow",
+			level:   "warn",
+			message: "Disk is slow",
+		},
+		{
+			line:    "2024-05-01T10:00:00.123456789 [anonymous-instance:fc_api] Running Firecracker v1.4.0",
+			level:   "info",
+			message: "Running Firecracker v1.4.0",
+		},
+		{
+			line:    "no header at all",
+			level:   "info",
+			message: "no header at all",
+		},
+	}
+
+	for _, c := range cases {
+		entry := parseFirecrackerLogLine(c.line)
+		if entry.Level != c.level {
+			t.Errorf("%q: expected level %q, got %q", c.line, c.level, entry.Level)
+		}
+		if entry.Message != c.message {
+			t.Errorf("%q: expected message %q, got %q", c.line, c.message, entry.Message)
+		}
+		if entry.Source != LogSourceFirecracker {
+			t.Errorf("%q: expected source %q, got %q", c.line, LogSourceFirecracker, entry.Source)
+		}
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	w := newLineWriter(func(line string) {
+		lines = append(lines, line)
+	})
+
+	for _, chunk := range []string{"Booting ", "Linux\r\n\nlog", "in: "} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(lines) != 1 || lines[0] != "Booting Linux" {
+		t.Errorf("expected one complete line, got %q", lines)
+	}
+}
@@ -102,8 +102,9 @@ func (ls *LogStreamer) Unsubscribe(subID string) {
 
 // Publish sends a log entry to all relevant subscribers
 func (ls *LogStreamer) Publish(vmID string, entry *models.LogEntry) {
-	ls.mu.RLock()
-	defer ls.mu.RUnlock()
+	// Write lock: several sources publish concurrently and the buffer is shared
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
 
 	// Add to buffer
 	ls.addToBuffer(vmID, entry)
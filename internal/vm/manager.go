@@ -16,23 +16,29 @@ package vm
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sync"
 	"time"
 
-	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
-	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/anubhavg-icpl/agni/internal/image"
 	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/network"
 	"github.com/anubhavg-icpl/agni/internal/storage"
 	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
 	"github.com/google/uuid"
-	log "github.com/sirupsen/logrus"
 )
 
 const (
 	executableMask         = 0111
 	firecrackerDefaultPath = "firecracker"
+
+	// DefaultShutdownTimeout is how long a guest gets to power off
+	DefaultShutdownTimeout = 30 * time.Second
 )
 
 // RunningVM holds the state of a running VM
@@ -40,182 +46,505 @@ type RunningVM struct {
 	Machine    *firecracker.Machine
 	Cancel     context.CancelFunc
 	SocketPath string
+	PID        int
+	Adopted    bool // Re-attached after a daemon restart, not a child process
+
+	cpus           int64 // Committed to the VM, for admission control and quotas
+	memoryMB       int64
+	ownerID        string
+	stopActor      string // Who asked the guest to shut down
+	lastSnapshotID string // Base for the next diff: the last snapshot this process took or restored
+	snapshotting   bool   // A snapshot is being written, the VM must stay paused
+	metrics        *metricsCollector
+	exited         chan struct{} // Closed once the process has exited
+	console        *Console      // Nil for adopted VMs
+	logFifo        io.Closer     // Only set for adopted VMs; the SDK owns it otherwise
+	releaseOnce    sync.Once
+}
+
+// release stops the per-VM collectors. Safe to call more than once.
+func (r *RunningVM) release() {
+	r.releaseOnce.Do(func() {
+		if r.metrics != nil {
+			r.metrics.close()
+		}
+		if r.logFifo != nil {
+			r.logFifo.Close()
+		}
+		if r.console != nil {
+			r.console.Close()
+		}
+	})
 }
 
 // Manager manages multiple Firecracker VMs
 type Manager struct {
 	store       *storage.VMStore
+	snapshots   *storage.SnapshotStore
+	images      *image.Registry
+	users       *storage.UserStore // For quotas
+	dataDir     string
 	runningVMs  map[string]*RunningVM
-	mu          sync.RWMutex
+	starting    map[string]bool // VMs copying or verifying images before they start
+	mu          sync.RWMutex    // Guards runningVMs and starting
 	logger      *logging.Logger
 	fcBinary    string
+	jailer      JailerSettings
 	logStreamer *LogStreamer
+	events      *EventBus
+	network     *network.Manager // Nil unless managed networking is enabled
+	admission   AdmissionConfig
+	createMu    sync.Mutex // Serializes quota and jailer ID checks on create with the creates
+
+	// Restart supervision; guarded by restartMu, not mu, so timers never wait on a start
+	restartMu      sync.Mutex
+	restartTimers  map[string]*time.Timer
+	restartHistory map[string][]time.Time
 }
 
 // NewManager creates a new VM Manager
 func NewManager(store *storage.Store) *Manager {
 	return &Manager{
 		store:       storage.NewVMStore(store),
+		snapshots:   storage.NewSnapshotStore(store),
+		images:      image.NewRegistry(store),
+		users:       storage.NewUserStore(store),
+		dataDir:     filepath.Dir(store.Path()),
 		runningVMs:  make(map[string]*RunningVM),
+		starting:    make(map[string]bool),
 		logger:      logging.GetLogger().WithComponent("vm-manager"),
 		logStreamer: NewLogStreamer(),
+		events:      NewEventBus(store),
+		admission:   DefaultAdmissionConfig(),
+		jailer:      DefaultJailerSettings(),
+
+		restartTimers:  make(map[string]*time.Timer),
+		restartHistory: make(map[string][]time.Time),
 	}
 }
 
+// Images returns the image registry
+func (m *Manager) Images() *image.Registry {
+	return m.images
+}
+
 // SetFirecrackerBinary sets the path to the firecracker binary
 func (m *Manager) SetFirecrackerBinary(path string) {
 	m.fcBinary = path
 }
 
-// Create creates a new VM configuration (does not start)
-func (m *Manager) Create(config models.VMConfig) (*models.VM, error) {
+// Create creates a new VM (does not start) owned by the given user, within
+// their quota. Its labels and autostart settings are stored with it in one
+// write. An empty owner leaves the VM to admins.
+func (m *Manager) Create(req models.CreateVMRequest, ownerID, actor string) (*models.VM, error) {
+	config := req.Config
+	if req.Name != "" {
+		config.Name = req.Name
+	}
+	if err := ValidateLabels(req.Labels); err != nil {
+		return nil, err
+	}
+	if _, err := parseMetadata(config.Metadata); err != nil {
+		return nil, err
+	}
+	if err := validateBalloon(&config); err != nil {
+		return nil, err
+	}
+	if hasManagedNICs(&config) && m.network == nil {
+		return nil, models.ErrNetworkNotConfigured
+	}
+	if err := validateManagedNICs(&config); err != nil {
+		return nil, err
+	}
+	if err := validateCNI(&config); err != nil {
+		return nil, err
+	}
+	if err := validateRestartPolicy(config.RestartPolicy); err != nil {
+		return nil, err
+	}
+	if err := m.images.Resolve(&config); err != nil {
+		return nil, err
+	}
+
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	if err := m.validateJailer(&config); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	err := m.checkCreateQuota(ownerID, 1, &config, nil)
+	m.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	id := uuid.New().String()
+	m.placeVsockSockets(id, &config)
+	if err := m.copyRootfsImage(id, &config); err != nil {
+		_ = os.RemoveAll(m.diskDir(id))
+		return nil, err
+	}
+
 	vm := &models.VM{
-		ID:        uuid.New().String(),
+		ID:        id,
 		Name:      config.Name,
+		OwnerID:   ownerID,
+		Labels:    req.Labels,
+		Autostart: req.Autostart,
+		BootOrder: req.BootOrder,
 		Status:    models.VMStatusStopped,
 		Config:    config,
 		CreatedAt: time.Now(),
 	}
+	if len(vm.Labels) == 0 {
+		vm.Labels = nil
+	}
 
 	if err := m.store.Create(vm); err != nil {
+		_ = os.RemoveAll(m.diskDir(id))
 		return nil, fmt.Errorf("failed to create VM: %w", err)
 	}
 
 	m.logger.Info().Str("vm_id", vm.ID).Str("name", vm.Name).Msg("VM created")
+	m.emit(models.EventCreated, vm, "", vm.Status, actor)
 	return vm, nil
 }
 
-// Start starts a VM
-func (m *Manager) Start(id string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// Start starts a VM. A manual start replaces any pending automatic restart
+// and resets the restart count.
+func (m *Manager) Start(id, actor string) error {
+	m.resetRestarts(id)
+	if vm, err := m.store.Get(id); err == nil && vm.RestartCount != 0 {
+		vm.RestartCount = 0
+		_ = m.store.Update(vm)
+	}
+	return m.start(id, actor)
+}
 
-	// Check if already running
-	if _, exists := m.runningVMs[id]; exists {
+// start boots a VM, applying any extra machine options such as snapshot
+// loading. Copying and verifying images can take minutes, so it happens
+// before mu is held for the rest of the start; starting keeps a second start
+// of the same VM out meanwhile.
+func (m *Manager) start(id, actor string, extraOpts ...firecracker.Opt) error {
+	m.mu.Lock()
+	_, exists := m.runningVMs[id]
+	if exists || m.starting[id] {
+		m.mu.Unlock()
 		return models.ErrVMAlreadyRunning
 	}
 
 	vm, err := m.store.Get(id)
 	if err != nil {
+		m.mu.Unlock()
 		return err
 	}
 
+	// Refuse to overcommit the host before anything is set up
+	if err := m.admit(&vm.Config); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	if err := m.checkStartQuota(vm); err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	m.starting[id] = true
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		delete(m.starting, id)
+		m.mu.Unlock()
+	}()
+
 	// Update status to starting
+	previous := vm.Status
 	vm.Status = models.VMStatusStarting
 	if err := m.store.Update(vm); err != nil {
 		return err
 	}
+	m.emit(models.EventStarting, vm, previous, vm.Status, actor)
+
+	// VMs created before writable root filesystems were copied get their copy now
+	if err := m.copyRootfsImage(vm.ID, &vm.Config); err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
+
+	// Refuse to boot images that changed since they were registered
+	if err := m.images.Prepare(&vm.Config); err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Other VMs may have taken the capacity while the images were prepared
+	if err := m.admit(&vm.Config); err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
+	if err := m.checkStartQuota(vm); err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
+
+	// Create taps and allocate addresses for managed NICs
+	if err := m.attachNetwork(vm); err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
 
 	// Build firecracker config
 	fcConfig, err := m.buildFirecrackerConfig(vm)
 	if err != nil {
-		vm.Status = models.VMStatusError
-		vm.Error = err.Error()
-		_ = m.store.Update(vm)
+		m.failStart(vm, err, actor)
 		return fmt.Errorf("failed to build config: %w", err)
 	}
 
+	// Validate MMDS metadata before anything is started
+	metadata, err := parseMetadata(vm.Config.Metadata)
+	if err != nil {
+		m.failStart(vm, err, actor)
+		return err
+	}
+
 	// Get firecracker binary
 	fcBinary, err := m.getFirecrackerBinary()
 	if err != nil {
-		vm.Status = models.VMStatusError
-		vm.Error = err.Error()
-		_ = m.store.Update(vm)
+		m.failStart(vm, err, actor)
 		return err
 	}
 
+	// The SDK creates the FIFOs itself, so clear any left by a previous run.
+	// The jailer likewise expects to create the chroot from scratch.
+	m.cleanupJail(vm)
+	if err := m.prepareRunDir(id); err != nil {
+		m.failStart(vm, err, actor)
+		return fmt.Errorf("failed to prepare runtime directory: %w", err)
+	}
+
+	// Give the VM its own serial console instead of the daemon's stdio
+	console, err := newConsole()
+	if err != nil {
+		m.failStart(vm, err, actor)
+		return fmt.Errorf("failed to allocate console: %w", err)
+	}
+	console.start(m.serialLogWriter(id))
+
 	// Create context with cancel
 	ctx, cancel := context.WithCancel(context.Background())
 
-	// Build command
-	cmd := firecracker.VMCommandBuilder{}.
-		WithBin(fcBinary).
-		WithSocketPath(fcConfig.SocketPath).
-		WithStdin(os.Stdin).
-		WithStdout(os.Stdout).
-		WithStderr(os.Stderr).
-		Build(ctx)
+	// Publish Firecracker's own log per VM
+	fcConfig.FifoLogWriter = m.firecrackerLogWriter(id)
 
-	logger := log.New()
 	machineOpts := []firecracker.Opt{
-		firecracker.WithLogger(log.NewEntry(logger)),
-		firecracker.WithProcessRunner(cmd),
+		firecracker.WithLogger(m.sdkLogger(id)),
 	}
 
+	// If the jailer is used, the SDK builds the jailer command in NewMachine()
+	if fcConfig.JailerCfg != nil {
+		if vm.Config.Jailer.Daemonize {
+			m.logger.Warn().Str("vm_id", id).Msg("Ignoring jailer daemonize, the manager supervises the process")
+		}
+		fcConfig.JailerCfg.Stdin = console.guestIn
+		fcConfig.JailerCfg.Stdout = console.guestOut
+		fcConfig.JailerCfg.Stderr = m.firecrackerLogWriter(id)
+	} else {
+		cmd := firecracker.VMCommandBuilder{}.
+			WithBin(fcBinary).
+			WithSocketPath(fcConfig.SocketPath).
+			WithStdin(console.guestIn).
+			WithStdout(console.guestOut).
+			WithStderr(m.firecrackerLogWriter(id)).
+			Build(ctx)
+
+		machineOpts = append(machineOpts, firecracker.WithProcessRunner(cmd))
+	}
+	machineOpts = append(machineOpts, extraOpts...)
+
 	// Create machine
 	machine, err := firecracker.NewMachine(ctx, fcConfig, machineOpts...)
 	if err != nil {
 		cancel()
-		vm.Status = models.VMStatusError
-		vm.Error = err.Error()
-		_ = m.store.Update(vm)
+		console.Close()
+		m.failStart(vm, err, actor)
 		return fmt.Errorf("failed to create machine: %w", err)
 	}
 
+	// The jailer moves the API socket into the chroot
+	socketPath := machine.Cfg.SocketPath
+
+	// Read metrics as soon as the SDK has created the FIFO
+	metrics := newMetricsCollector(id, socketPath, vm.Config.MemoryMB, m.logger)
+	machine.Handlers.FcInit = machine.Handlers.FcInit.AppendAfter(
+		firecracker.CreateLogFilesHandlerName, metrics.handler(fcConfig.MetricsFifo))
+
+	// Load MMDS metadata before the guest boots so it is there on first read
+	if metadata != nil {
+		machine.Handlers.FcInit = machine.Handlers.FcInit.Append(metadataHandler(metadata))
+	}
+
+	// A VM restored from a snapshot already has its balloon
+	if vm.Config.Balloon != nil && !machine.Handlers.FcInit.Has(firecracker.LoadSnapshotHandlerName) {
+		machine.Handlers.FcInit = machine.Handlers.FcInit.Append(balloonHandler(vm.Config.Balloon))
+	}
+
 	// Start machine
 	if err := machine.Start(ctx); err != nil {
 		cancel()
-		vm.Status = models.VMStatusError
-		vm.Error = err.Error()
-		_ = m.store.Update(vm)
+		metrics.close()
+		console.Close()
+		m.cleanupJail(vm)
+		m.failStart(vm, err, actor)
 		return fmt.Errorf("failed to start machine: %w", err)
 	}
 
+	// Firecracker holds its own copies of the console's guest ends now
+	console.releaseGuest()
+
+	// Report what CNI handed out; the SDK runs DEL once Firecracker exits
+	recordCNIResult(vm, machine.Cfg.NetworkInterfaces)
+
+	if fcConfig.JailerCfg != nil {
+		m.linkVsockSockets(vm, fcConfig.JailerCfg)
+	}
+
+	// Record the PID so the VM can be re-attached after a daemon restart
+	pid, _ := machine.PID()
+
 	// Update VM state
 	now := time.Now()
 	vm.Status = models.VMStatusRunning
 	vm.StartedAt = &now
-	vm.SocketPath = fcConfig.SocketPath
+	vm.SocketPath = socketPath
+	vm.PID = pid
 	vm.Error = ""
+	vm.ExitCode = nil
 	if err := m.store.Update(vm); err != nil {
 		m.logger.Error().Err(err).Msg("Failed to update VM state")
 	}
+	m.emit(models.EventRunning, vm, models.VMStatusStarting, vm.Status, actor)
 
 	// Store running VM
-	m.runningVMs[id] = &RunningVM{
+	running := &RunningVM{
 		Machine:    machine,
 		Cancel:     cancel,
-		SocketPath: fcConfig.SocketPath,
+		SocketPath: socketPath,
+		PID:        pid,
+		metrics:    metrics,
+		exited:     make(chan struct{}),
+		console:    console,
+		cpus:       vm.Config.CPUs,
+		memoryMB:   vm.Config.MemoryMB,
+		ownerID:    vm.OwnerID,
 	}
+	m.runningVMs[id] = running
 
 	m.logger.Info().Str("vm_id", id).Msg("VM started")
 
 	// Start goroutine to wait for VM and handle cleanup
-	go m.waitForVM(id, machine, ctx)
+	go m.waitForVM(id, running, ctx)
 
 	return nil
 }
 
+// failStart records why a VM failed to start
+func (m *Manager) failStart(vm *models.VM, err error, actor string) {
+	vm.Status = models.VMStatusError
+	vm.Error = err.Error()
+	_ = m.store.Update(vm)
+	m.emit(models.EventCrashed, vm, models.VMStatusStarting, vm.Status, actor)
+}
+
 // waitForVM waits for a VM to terminate and cleans up
-func (m *Manager) waitForVM(id string, machine *firecracker.Machine, ctx context.Context) {
-	err := machine.Wait(ctx)
+func (m *Manager) waitForVM(id string, running *RunningVM, ctx context.Context) {
+	err := running.Machine.Wait(ctx)
 	if err != nil {
 		m.logger.Error().Err(err).Str("vm_id", id).Msg("VM wait error")
 	}
 
+	m.markExited(id, running, exitStatus(err))
+}
+
+// markExited removes a VM from the running set and records how it exited: a
+// non-zero exit status is a crash, unless a shutdown was requested. The VM's
+// restart policy is applied to exits nobody asked for. Nothing is recorded if
+// the VM was already stopped and possibly restarted.
+func (m *Manager) markExited(id string, running *RunningVM, code *int) {
+	running.release()
+	close(running.exited)
+
 	m.mu.Lock()
-	delete(m.runningVMs, id)
+	current := m.runningVMs[id] == running
+	if current {
+		delete(m.runningVMs, id)
+	}
+	actor := running.stopActor
 	m.mu.Unlock()
 
-	// Update status
-	vm, err := m.store.Get(id)
-	if err == nil {
+	if !current {
+		return
+	}
+
+	// CNI results are cleared below, tear down with the ones in use
+	if running.Adopted {
+		if vm, err := m.store.Get(id); err == nil {
+			m.teardownCNI(vm)
+		}
+	}
+
+	var requested, crashed bool
+	var previous models.VMStatus
+	vm, err := m.updateVM(id, func(vm *models.VM) {
+		requested = vm.Status == models.VMStatusStopping
+		crashed = code != nil && *code != 0 && !requested
+		previous = vm.Status
 		now := time.Now()
 		vm.Status = models.VMStatusStopped
 		vm.StoppedAt = &now
-		_ = m.store.Update(vm)
+		vm.PID = 0
+		vm.ExitCode = code
+		if crashed {
+			vm.Status = models.VMStatusError
+			vm.Error = fmt.Sprintf("firecracker exited with status %d", *code)
+		}
+		clearCNIResult(vm)
+	})
+	if err != nil {
+		return
+	}
+	if !requested || actor == "" {
+		actor = models.ActorSystem
+	}
+	m.cleanupJail(vm)
+
+	if crashed {
+		m.logger.Warn().Str("vm_id", id).Int("exit_code", *code).Msg("VM crashed")
+		m.emit(models.EventCrashed, vm, previous, vm.Status, actor)
+	} else {
+		m.logger.Info().Str("vm_id", id).Msg("VM stopped")
+		m.emit(models.EventStopped, vm, previous, vm.Status, actor)
 	}
 
-	m.logger.Info().Str("vm_id", id).Msg("VM stopped")
+	if !requested {
+		m.scheduleRestart(vm, crashed)
+	}
 }
 
 // Stop force stops a VM
-func (m *Manager) Stop(id string) error {
+func (m *Manager) Stop(id, actor string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	running, exists := m.runningVMs[id]
 	if !exists {
+		// Stopping a VM that waits to be restarted keeps it down
+		if m.cancelRestart(id) {
+			m.logger.Info().Str("vm_id", id).Msg("Pending VM restart cancelled")
+			return nil
+		}
 		return models.ErrVMNotRunning
 	}
 
@@ -224,6 +553,7 @@ func (m *Manager) Stop(id string) error {
 		return err
 	}
 
+	previous := vm.Status
 	vm.Status = models.VMStatusStopping
 	_ = m.store.Update(vm)
 
@@ -232,59 +562,207 @@ func (m *Manager) Stop(id string) error {
 	}
 
 	running.Cancel()
+	running.release()
 	delete(m.runningVMs, id)
 
 	now := time.Now()
 	vm.Status = models.VMStatusStopped
 	vm.StoppedAt = &now
+	vm.PID = 0
+	if running.Adopted {
+		m.teardownCNI(vm)
+	}
+	clearCNIResult(vm)
 	_ = m.store.Update(vm)
+	m.cleanupJail(vm)
 
 	m.logger.Info().Str("vm_id", id).Msg("VM force stopped")
+	m.emit(models.EventStopped, vm, previous, vm.Status, actor)
 	return nil
 }
 
-// Shutdown gracefully shuts down a VM
-func (m *Manager) Shutdown(id string) error {
+// Shutdown gracefully shuts down a VM: the guest gets Ctrl-Alt-Del and
+// timeout to power off, after which Firecracker is force stopped. The
+// returned method tells which of the two happened.
+func (m *Manager) Shutdown(id string, timeout time.Duration, actor string) (models.ShutdownMethod, error) {
+	if timeout <= 0 {
+		timeout = DefaultShutdownTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return m.shutdown(ctx, id, actor)
+}
+
+// ShutdownContext shuts a VM down like Shutdown, forcing it off once ctx is
+// done, so that several VMs can share one grace period
+func (m *Manager) ShutdownContext(ctx context.Context, id, actor string) (models.ShutdownMethod, error) {
+	return m.shutdown(ctx, id, actor)
+}
+
+// shutdown asks the guest to power off and force stops the VM once ctx is done
+func (m *Manager) shutdown(ctx context.Context, id, actor string) (models.ShutdownMethod, error) {
+	running, err := m.requestShutdown(id, actor)
+	if err != nil {
+		if err == models.ErrVMNotRunning || err == models.ErrVMNotFound {
+			return "", err
+		}
+		// Ctrl-Alt-Del only exists on x86, among other things that can go wrong
+		m.logger.Warn().Err(err).Str("vm_id", id).Msg("Shutdown request failed, forcing stop")
+	} else {
+		select {
+		case <-running.exited:
+			m.logger.Info().Str("vm_id", id).Msg("VM shut down gracefully")
+			return models.ShutdownGraceful, nil
+		case <-ctx.Done():
+			m.logger.Warn().Str("vm_id", id).Msg("Guest ignored shutdown request, forcing stop")
+		}
+	}
+
+	if err := m.Stop(id, actor); err != nil {
+		// It made it just in time
+		if err == models.ErrVMNotRunning {
+			return models.ShutdownGraceful, nil
+		}
+		return "", err
+	}
+	return models.ShutdownForced, nil
+}
+
+// requestShutdown sends Ctrl-Alt-Del to a VM's guest
+func (m *Manager) requestShutdown(id, actor string) (*RunningVM, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	running, exists := m.runningVMs[id]
 	if !exists {
-		return models.ErrVMNotRunning
+		if _, err := m.store.Get(id); err != nil {
+			return nil, err
+		}
+		return nil, models.ErrVMNotRunning
 	}
 
 	vm, err := m.store.Get(id)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	ctx := context.Background()
+
+	// A paused guest cannot react to Ctrl-Alt-Del
+	if vm.Status == models.VMStatusPaused {
+		if err := running.Machine.ResumeVM(ctx); err != nil {
+			return nil, fmt.Errorf("failed to resume VM for shutdown: %w", err)
+		}
+	}
+
+	previous := vm.Status
 	vm.Status = models.VMStatusStopping
 	_ = m.store.Update(vm)
+	running.stopActor = actor
+	m.emit(models.EventConfigChanged, vm, previous, vm.Status, actor)
 
-	ctx := context.Background()
 	if err := running.Machine.Shutdown(ctx); err != nil {
-		return fmt.Errorf("failed to shutdown VM: %w", err)
+		return nil, fmt.Errorf("failed to shutdown VM: %w", err)
 	}
 
 	m.logger.Info().Str("vm_id", id).Msg("VM shutdown requested")
+	return running, nil
+}
+
+// Pause pauses a running VM's vCPUs, keeping its process and devices alive
+func (m *Manager) Pause(id, actor string) error {
+	return m.setPaused(id, true, actor)
+}
+
+// Resume resumes a paused VM
+func (m *Manager) Resume(id, actor string) error {
+	return m.setPaused(id, false, actor)
+}
+
+// setPaused pauses or resumes a VM after validating the status transition
+func (m *Manager) setPaused(id string, pause bool, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	running, exists := m.runningVMs[id]
+	if !exists {
+		if _, err := m.store.Get(id); err != nil {
+			return err
+		}
+		return models.ErrVMNotRunning
+	}
+	if running.snapshotting {
+		return models.ErrSnapshotInProgress
+	}
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+
+	next := models.VMStatusRunning
+	if pause {
+		next = models.VMStatusPaused
+	}
+	if !vm.Status.CanTransitionTo(next) {
+		return models.ErrInvalidTransition
+	}
+
+	ctx := context.Background()
+	if pause {
+		err = running.Machine.PauseVM(ctx)
+	} else {
+		err = running.Machine.ResumeVM(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change VM state to %s: %w", next, err)
+	}
+
+	previous := vm.Status
+	vm.Status = next
+	if err := m.store.Update(vm); err != nil {
+		m.logger.Error().Err(err).Msg("Failed to update VM state")
+	}
+
+	m.logger.Info().Str("vm_id", id).Str("status", string(next)).Msg("VM state changed")
+	m.emit(models.EventConfigChanged, vm, previous, next, actor)
 	return nil
 }
 
 // Delete removes a VM (must be stopped first)
-func (m *Manager) Delete(id string) error {
+func (m *Manager) Delete(id, actor string) error {
 	m.mu.RLock()
 	_, isRunning := m.runningVMs[id]
+	isRunning = isRunning || m.starting[id]
 	m.mu.RUnlock()
 
 	if isRunning {
 		return fmt.Errorf("cannot delete running VM, stop it first")
 	}
 
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+
 	if err := m.store.Delete(id); err != nil {
 		return err
 	}
 
+	m.resetRestarts(id)
+	m.cleanupJail(vm)
+	m.releaseNetwork(vm)
+	_ = os.RemoveAll(m.cniCacheDir(id))
+	_ = os.RemoveAll(m.diskDir(id))
+
+	if err := m.deleteSnapshots(id); err != nil {
+		m.logger.Warn().Err(err).Str("vm_id", id).Msg("Failed to remove VM snapshots")
+	}
+	m.logStreamer.ClearBuffer(id)
+
 	m.logger.Info().Str("vm_id", id).Msg("VM deleted")
+	m.emit(models.EventDeleted, vm, vm.Status, "", actor)
 	return nil
 }
 
@@ -293,9 +771,53 @@ func (m *Manager) Get(id string) (*models.VM, error) {
 	return m.store.Get(id)
 }
 
-// Update updates a VM configuration (must be stopped)
-func (m *Manager) Update(vm *models.VM) error {
-	return m.store.Update(vm)
+// Update applies change to a stopped VM's record. The record is read,
+// changed and saved under the manager lock, so it doesn't race with
+// supervision updating the same VM. A VM handed to another owner has to fit
+// into the new owner's quota.
+func (m *Manager) Update(id string, change func(vm *models.VM), actor string) (*models.VM, error) {
+	m.createMu.Lock()
+	defer m.createMu.Unlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, running := m.runningVMs[id]; running || m.starting[id] {
+		return nil, models.ErrVMAlreadyRunning
+	}
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ownerID := vm.OwnerID
+	change(vm)
+	if vm.OwnerID != ownerID {
+		if err := m.checkCreateQuota(vm.OwnerID, 1, &vm.Config, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := m.store.Update(vm); err != nil {
+		return nil, err
+	}
+	m.emit(models.EventConfigChanged, vm, vm.Status, vm.Status, actor)
+	return vm, nil
+}
+
+// updateVM reads, changes and saves a VM's record under the manager lock
+func (m *Manager) updateVM(id string, change func(vm *models.VM)) (*models.VM, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	change(vm)
+	if err := m.store.Update(vm); err != nil {
+		return nil, err
+	}
+	return vm, nil
 }
 
 // List returns all VMs
@@ -303,21 +825,39 @@ func (m *Manager) List() ([]*models.VM, error) {
 	return m.store.List()
 }
 
-// GetMetrics retrieves metrics for a running VM
+// ListPage returns one sorted page of the VMs accepted by match and the
+// number of matches
+func (m *Manager) ListPage(opts storage.PageOptions, match func(*models.VM) bool) ([]*models.VM, int, error) {
+	return m.store.ListPage(opts, match)
+}
+
+// GetMetrics returns the latest metrics sample for a running VM
 func (m *Manager) GetMetrics(id string) (*models.VMMetrics, error) {
 	m.mu.RLock()
-	_, exists := m.runningVMs[id]
+	running, exists := m.runningVMs[id]
 	m.mu.RUnlock()
 
 	if !exists {
 		return nil, models.ErrVMNotRunning
 	}
 
-	// For now, return basic metrics
-	// In a full implementation, we would query the Firecracker metrics FIFO
-	return &models.VMMetrics{
-		Timestamp: time.Now(),
-	}, nil
+	// Adopted VMs whose FIFO is gone have nothing to report
+	metrics := &models.VMMetrics{Timestamp: time.Now()}
+	if running.metrics != nil {
+		metrics = running.metrics.latest()
+	}
+
+	// Only the balloon can see inside the guest
+	if vm, err := m.store.Get(id); err == nil && vm.Config.Balloon != nil && vm.Config.Balloon.StatsPollingIntervalS > 0 {
+		stats, err := balloonStats(running, vm.Config.Balloon)
+		if err != nil {
+			m.logger.Debug().Err(err).Str("vm_id", id).Msg("Failed to read balloon statistics")
+		} else {
+			metrics.MemoryUsed = memoryUsed(stats)
+		}
+	}
+
+	return metrics, nil
 }
 
 // IsRunning checks if a VM is running
@@ -333,8 +873,40 @@ func (m *Manager) GetLogStreamer() *LogStreamer {
 	return m.logStreamer
 }
 
+// ShutdownAll gracefully shuts down all running VMs in parallel, force
+// stopping those still running when ctx is done
+func (m *Manager) ShutdownAll(ctx context.Context) {
+	m.cancelRestarts()
+
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.runningVMs))
+	for id := range m.runningVMs {
+		ids = append(ids, id)
+	}
+	m.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			method, err := m.shutdown(ctx, id, models.ActorSystem)
+			if err != nil {
+				if err != models.ErrVMNotRunning {
+					m.logger.Error().Err(err).Str("vm_id", id).Msg("Failed to shut down VM")
+				}
+				return
+			}
+			m.logger.Info().Str("vm_id", id).Str("method", string(method)).Msg("VM shut down during daemon shutdown")
+		}(id)
+	}
+	wg.Wait()
+}
+
 // StopAll stops all running VMs
 func (m *Manager) StopAll() {
+	m.cancelRestarts()
+
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -342,6 +914,13 @@ func (m *Manager) StopAll() {
 		m.logger.Info().Str("vm_id", id).Msg("Stopping VM during shutdown")
 		_ = running.Machine.StopVMM()
 		running.Cancel()
+		running.release()
+		if vm, err := m.store.Get(id); err == nil {
+			if running.Adopted {
+				m.teardownCNI(vm)
+			}
+			m.cleanupJail(vm)
+		}
 	}
 	m.runningVMs = make(map[string]*RunningVM)
 }
@@ -358,6 +937,7 @@ func (m *Manager) buildFirecrackerConfig(vm *models.VM) (firecracker.Config, err
 			IsReadOnly:   firecracker.Bool(cfg.RootDrive.ReadOnly),
 			IsRootDevice: firecracker.Bool(true),
 			Partuuid:     cfg.RootDrive.PartUUID,
+			RateLimiter:  toFCRateLimiter(cfg.RootDrive.RateLimiter),
 		},
 	}
 
@@ -367,48 +947,77 @@ func (m *Manager) buildFirecrackerConfig(vm *models.VM) (firecracker.Config, err
 			PathOnHost:   firecracker.String(drive.Path),
 			IsReadOnly:   firecracker.Bool(drive.ReadOnly),
 			IsRootDevice: firecracker.Bool(false),
+			RateLimiter:  toFCRateLimiter(drive.RateLimiter),
 		})
 	}
 
-	// Build network interfaces
+	// Build network interfaces. CNI interfaces get their tap and MAC from
+	// the plugins, so only the CNI settings are passed on.
 	var nics []firecracker.NetworkInterface
+	netNS := ""
 	for _, nic := range cfg.NetworkInterfaces {
-		nics = append(nics, firecracker.NetworkInterface{
-			StaticConfiguration: &firecracker.StaticNetworkConfiguration{
+		iface := firecracker.NetworkInterface{
+			AllowMMDS:      nic.AllowMMDS,
+			InRateLimiter:  toFCRateLimiter(nic.RxRateLimiter),
+			OutRateLimiter: toFCRateLimiter(nic.TxRateLimiter),
+		}
+		if nic.CNI != nil {
+			iface.CNIConfiguration = m.toFCCNIConfig(vm.ID, nic.CNI)
+			netNS = cniNetNSPath(vm.ID)
+		} else {
+			iface.StaticConfiguration = &firecracker.StaticNetworkConfiguration{
 				MacAddress:  nic.MacAddress,
 				HostDevName: nic.Device,
-			},
-			AllowMMDS: nic.AllowMMDS,
-		})
+			}
+		}
+		nics = append(nics, iface)
 	}
 
 	// Build vsock devices
 	var vsocks []firecracker.VsockDevice
-	for _, vs := range cfg.VsockDevices {
+	for i, vs := range cfg.VsockDevices {
 		vsocks = append(vsocks, firecracker.VsockDevice{
-			Path: vs.Path,
+			Path: m.vsockPath(vm.ID, i),
 			CID:  vs.CID,
 		})
 	}
 
 	// Generate socket path
 	socketPath := fmt.Sprintf("/tmp/firecracker-%s.sock", vm.ID)
+	fifoDir := m.runDir(vm.ID)
+
+	// Jailed VMs get their socket and FIFOs inside the chroot, where the
+	// jailed Firecracker can reach them
+	jail, err := m.buildJailerConfig(vm)
+	if err != nil {
+		return firecracker.Config{}, err
+	}
+	if jail != nil {
+		socketPath = jailedSocketPath
+		fifoDir = chrootRoot(jail)
+	}
 
 	return firecracker.Config{
+		VMID:              vm.ID,
 		SocketPath:        socketPath,
+		LogFifo:           filepath.Join(fifoDir, logFifoName),
+		MetricsFifo:       filepath.Join(fifoDir, metricsFifoName),
 		KernelImagePath:   cfg.KernelPath,
-		KernelArgs:        cfg.KernelOpts,
+		KernelArgs:        m.kernelArgs(&cfg),
 		InitrdPath:        cfg.InitrdPath,
 		Drives:            drives,
 		NetworkInterfaces: nics,
 		VsockDevices:      vsocks,
+		NetNS:             netNS,
 		LogLevel:          cfg.LogLevel,
 		MachineCfg: fcmodels.MachineConfiguration{
-			VcpuCount:   firecracker.Int64(cfg.CPUs),
-			CPUTemplate: fcmodels.CPUTemplate(cfg.CPUTemplate),
-			Smt:         firecracker.Bool(!cfg.DisableSMT),
-			MemSizeMib:  firecracker.Int64(cfg.MemoryMB),
+			VcpuCount:       firecracker.Int64(cfg.CPUs),
+			CPUTemplate:     fcmodels.CPUTemplate(cfg.CPUTemplate),
+			Smt:             firecracker.Bool(!cfg.DisableSMT),
+			MemSizeMib:      firecracker.Int64(cfg.MemoryMB),
+			TrackDirtyPages: cfg.TrackDirtyPages,
 		},
+		JailerCfg: jail,
 	}, nil
 }
 
@@ -443,3 +1052,44 @@ func (m *Manager) validateBinary(path string) (string, error) {
 	}
 	return path, nil
 }
+
+// runDir returns the directory holding a VM's runtime files such as FIFOs
+func (m *Manager) runDir(id string) string {
+	return filepath.Join(m.dataDir, "run", id)
+}
+
+// vsockPath returns where a VM's vsock socket, or the link to it for a
+// jailed VM, is created. The path a user configured is never used: the
+// daemon runs as root and replaces whatever is there.
+func (m *Manager) vsockPath(id string, index int) string {
+	return filepath.Join(m.runDir(id), vsockSocketName(index))
+}
+
+// placeVsockSockets records the paths vsock sockets are created at, so users
+// know where to connect
+func (m *Manager) placeVsockSockets(id string, cfg *models.VMConfig) {
+	for i := range cfg.VsockDevices {
+		cfg.VsockDevices[i].Path = m.vsockPath(id, i)
+	}
+}
+
+// prepareRunDir creates a VM's runtime directory and removes stale FIFOs and
+// vsock sockets
+func (m *Manager) prepareRunDir(id string) error {
+	dir := m.runDir(id)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	names := []string{logFifoName, metricsFifoName}
+	sockets, _ := filepath.Glob(filepath.Join(dir, "vsock-*.sock"))
+	for _, socket := range sockets {
+		names = append(names, filepath.Base(socket))
+	}
+	for _, name := range names {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestStartGuard(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	vm, err := m.Create(models.CreateVMRequest{Name: "web"}, "", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// While a start prepares images without mu, the VM is neither started
+	// again nor deleted
+	m.mu.Lock()
+	m.starting[vm.ID] = true
+	m.mu.Unlock()
+
+	if err := m.Start(vm.ID, "alice"); err != models.ErrVMAlreadyRunning {
+		t.Errorf("Start() during a start error = %v, want %v", err, models.ErrVMAlreadyRunning)
+	}
+	if err := m.Delete(vm.ID, "alice"); err == nil {
+		t.Errorf("Delete() during a start succeeded")
+	}
+	if m.IsRunning(vm.ID) {
+		t.Errorf("IsRunning() = true for a VM that has not started yet")
+	}
+}
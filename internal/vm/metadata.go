@@ -0,0 +1,153 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+const setMetadataHandlerName = "agni.SetMetadata"
+
+// parseMetadata decodes a VM's stored MMDS metadata. Empty metadata is nil.
+func parseMetadata(raw string) (interface{}, error) {
+	if raw == "" {
+		return nil, nil
+	}
+
+	var metadata interface{}
+	if err := json.Unmarshal([]byte(raw), &metadata); err != nil {
+		return nil, models.ErrInvalidMetadata
+	}
+	return metadata, nil
+}
+
+// metadataHandler returns an FcInit handler that loads metadata into MMDS
+// before the guest boots
+func metadataHandler(metadata interface{}) firecracker.Handler {
+	return firecracker.Handler{
+		Name: setMetadataHandlerName,
+		Fn: func(ctx context.Context, m *firecracker.Machine) error {
+			return m.SetMetadata(ctx, metadata)
+		},
+	}
+}
+
+// GetMetadata returns a VM's MMDS contents. Running VMs are asked directly,
+// stopped VMs report what will be applied at the next boot.
+func (m *Manager) GetMetadata(id string) (interface{}, error) {
+	m.mu.RLock()
+	running, exists := m.runningVMs[id]
+	m.mu.RUnlock()
+
+	if exists {
+		var metadata interface{}
+		if err := running.Machine.GetMetadata(context.Background(), &metadata); err != nil {
+			return nil, fmt.Errorf("failed to get metadata: %w", err)
+		}
+		return metadata, nil
+	}
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return parseMetadata(vm.Config.Metadata)
+}
+
+// SetMetadata replaces a VM's MMDS contents
+func (m *Manager) SetMetadata(id string, metadata interface{}, actor string) (interface{}, error) {
+	return m.updateMetadata(id, metadata, false, actor)
+}
+
+// PatchMetadata merges a JSON merge patch (RFC 7396) into a VM's MMDS contents
+func (m *Manager) PatchMetadata(id string, patch interface{}, actor string) (interface{}, error) {
+	return m.updateMetadata(id, patch, true, actor)
+}
+
+// updateMetadata replaces or patches metadata, live if the VM is running, and
+// persists the result so it survives a restart
+func (m *Manager) updateMetadata(id string, data interface{}, merge bool, actor string) (interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata interface{}
+	if running, exists := m.runningVMs[id]; exists {
+		ctx := context.Background()
+		if merge {
+			err = running.Machine.UpdateMetadata(ctx, data)
+		} else {
+			err = running.Machine.SetMetadata(ctx, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to update metadata: %w", err)
+		}
+		if err := running.Machine.GetMetadata(ctx, &metadata); err != nil {
+			return nil, fmt.Errorf("failed to get metadata: %w", err)
+		}
+	} else {
+		metadata = data
+		if merge {
+			current, err := parseMetadata(vm.Config.Metadata)
+			if err != nil {
+				return nil, err
+			}
+			metadata = mergePatch(current, data)
+		}
+	}
+
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, models.ErrInvalidMetadata
+	}
+	vm.Config.Metadata = string(raw)
+	if err := m.store.Update(vm); err != nil {
+		return nil, err
+	}
+
+	m.logger.Info().Str("vm_id", id).Bool("merge", merge).Msg("VM metadata updated")
+	m.emit(models.EventConfigChanged, vm, vm.Status, vm.Status, actor)
+	return metadata, nil
+}
+
+// mergePatch applies a JSON merge patch as described in RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+
+	for key, value := range patchObj {
+		if value == nil {
+			delete(targetObj, key)
+			continue
+		}
+		targetObj[key] = mergePatch(targetObj[key], value)
+	}
+	return targetObj
+}
@@ -0,0 +1,61 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestMergePatch(t *testing.T) {
+	decode := func(s string) interface{} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(s), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	// Examples from RFC 7396, appendix A
+	cases := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+	}
+
+	for _, c := range cases {
+		got := mergePatch(decode(c.target), decode(c.patch))
+		if !reflect.DeepEqual(got, decode(c.want)) {
+			t.Errorf("mergePatch(%s, %s) = %v, want %s", c.target, c.patch, got, c.want)
+		}
+	}
+}
+
+func TestParseMetadata(t *testing.T) {
+	if v, err := parseMetadata(""); v != nil || err != nil {
+		t.Errorf("expected empty metadata to be nil, got %v, %v", v, err)
+	}
+	if _, err := parseMetadata(`{"latest":`); err != models.ErrInvalidMetadata {
+		t.Errorf("expected ErrInvalidMetadata, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	metricsFifoName = "metrics.fifo"
+
+	// Firecracker only writes metrics once a minute on its own
+	metricsFlushInterval = 5 * time.Second
+	metricsFlushTimeout  = 2 * time.Second
+
+	startMetricsHandlerName = "agni.StartMetricsCollector"
+)
+
+// fcMetrics is the subset of a Firecracker metrics line that agni tracks.
+// Counters are reset on every flush, so each line holds deltas.
+type fcMetrics struct {
+	Block struct {
+		ReadBytes  int64 `json:"read_bytes"`
+		WriteBytes int64 `json:"write_bytes"`
+	} `json:"block"`
+	Net struct {
+		RxBytes int64 `json:"rx_bytes_count"`
+		TxBytes int64 `json:"tx_bytes_count"`
+	} `json:"net"`
+	Vcpu struct {
+		ExitIoIn      int64 `json:"exit_io_in"`
+		ExitIoOut     int64 `json:"exit_io_out"`
+		ExitMmioRead  int64 `json:"exit_mmio_read"`
+		ExitMmioWrite int64 `json:"exit_mmio_write"`
+	} `json:"vcpu"`
+	Vmm struct {
+		DeviceEvents int64 `json:"device_events"`
+	} `json:"vmm"`
+}
+
+// metricsCollector reads a VM's metrics FIFO and keeps the latest totals
+type metricsCollector struct {
+	vmID       string
+	socketPath string
+	logger     *logging.Logger
+
+	mu     sync.RWMutex
+	sample models.VMMetrics
+
+	fifo      *os.File
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newMetricsCollector creates a collector for a VM with the given memory size
+func newMetricsCollector(vmID, socketPath string, memoryMB int64, logger *logging.Logger) *metricsCollector {
+	return &metricsCollector{
+		vmID:       vmID,
+		socketPath: socketPath,
+		logger:     logger,
+		sample: models.VMMetrics{
+			MemoryTotal: memoryMB * 1024 * 1024,
+			Timestamp:   time.Now(),
+		},
+		done: make(chan struct{}),
+	}
+}
+
+// handler returns an FcInit handler that attaches the collector once the SDK
+// has created the FIFO
+func (c *metricsCollector) handler(path string) firecracker.Handler {
+	return firecracker.Handler{
+		Name: startMetricsHandlerName,
+		Fn: func(ctx context.Context, m *firecracker.Machine) error {
+			return c.attach(path)
+		},
+	}
+}
+
+// attach opens the FIFO and starts reading and flushing in the background
+func (c *metricsCollector) attach(path string) error {
+	// Opening read-write never blocks waiting for a writer and keeps reads
+	// from hitting EOF before Firecracker opens its end
+	fifo, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	c.fifo = fifo
+
+	go c.readLoop()
+	go c.flushLoop()
+	return nil
+}
+
+// readLoop applies every metrics line written to the FIFO
+func (c *metricsCollector) readLoop() {
+	scanner := bufio.NewScanner(c.fifo)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := c.apply(scanner.Bytes()); err != nil {
+			c.logger.Debug().Err(err).Str("vm_id", c.vmID).Msg("Skipping malformed metrics line")
+		}
+	}
+}
+
+// flushLoop asks Firecracker to write metrics more often than its default
+func (c *metricsCollector) flushLoop() {
+	client := firecracker.NewClient(c.socketPath, log.NewEntry(log.New()), false)
+	action := &fcmodels.InstanceActionInfo{
+		ActionType: firecracker.String(fcmodels.InstanceActionInfoActionTypeFlushMetrics),
+	}
+
+	ticker := time.NewTicker(metricsFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), metricsFlushTimeout)
+			if _, err := client.CreateSyncAction(ctx, action); err != nil {
+				c.logger.Debug().Err(err).Str("vm_id", c.vmID).Msg("Failed to flush metrics")
+			}
+			cancel()
+		}
+	}
+}
+
+// apply adds one metrics line to the running totals
+func (c *metricsCollector) apply(line []byte) error {
+	var fm fcMetrics
+	if err := json.Unmarshal(line, &fm); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sample.DiskRead += fm.Block.ReadBytes
+	c.sample.DiskWrite += fm.Block.WriteBytes
+	c.sample.NetRx += fm.Net.RxBytes
+	c.sample.NetTx += fm.Net.TxBytes
+	c.sample.VCPUExits += fm.Vcpu.ExitIoIn + fm.Vcpu.ExitIoOut + fm.Vcpu.ExitMmioRead + fm.Vcpu.ExitMmioWrite
+	c.sample.DeviceEvents += fm.Vmm.DeviceEvents
+	c.sample.Timestamp = time.Now()
+	return nil
+}
+
+// latest returns a copy of the most recent sample
+func (c *metricsCollector) latest() *models.VMMetrics {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sample := c.sample
+	return &sample
+}
+
+// close stops the background loops and releases the FIFO
+func (c *metricsCollector) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.fifo != nil {
+			c.fifo.Close()
+		}
+	})
+}
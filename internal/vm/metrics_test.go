@@ -0,0 +1,52 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+)
+
+func TestMetricsCollectorApply(t *testing.T) {
+	c := newMetricsCollector("vm", "/nonexistent.sock", 128, logging.GetLogger())
+
+	lines := []string{
+		`{"utc_timestamp_ms":1,"block":{"read_bytes":4096,"write_bytes":512},"net":{"rx_bytes_count":100,"tx_bytes_count":50},"vcpu":{"exit_io_in":1,"exit_io_out":2,"exit_mmio_read":3,"exit_mmio_write":4},"vmm":{"device_events":7}}`,
+		`{"utc_timestamp_ms":2,"block":{"read_bytes":1024,"write_bytes":0},"net":{"rx_bytes_count":10,"tx_bytes_count":5}}`,
+	}
+	for _, line := range lines {
+		if err := c.apply([]byte(line)); err != nil {
+			t.Fatalf("apply failed: %v", err)
+		}
+	}
+
+	if err := c.apply([]byte("not json")); err == nil {
+		t.Errorf("expected malformed line to be rejected")
+	}
+
+	got := c.latest()
+	if got.DiskRead != 5120 || got.DiskWrite != 512 {
+		t.Errorf("unexpected disk totals: read=%d write=%d", got.DiskRead, got.DiskWrite)
+	}
+	if got.NetRx != 110 || got.NetTx != 55 {
+		t.Errorf("unexpected net totals: rx=%d tx=%d", got.NetRx, got.NetTx)
+	}
+	if got.VCPUExits != 10 || got.DeviceEvents != 7 {
+		t.Errorf("unexpected counters: exits=%d events=%d", got.VCPUExits, got.DeviceEvents)
+	}
+	if got.MemoryTotal != 128*1024*1024 {
+		t.Errorf("unexpected memory total: %d", got.MemoryTotal)
+	}
+}
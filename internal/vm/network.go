@@ -0,0 +1,88 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"github.com/anubhavg-icpl/agni/internal/network"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// SetNetwork enables managed NICs, backed by the given network manager
+func (m *Manager) SetNetwork(manager *network.Manager) {
+	m.network = manager
+}
+
+// hasManagedNICs reports whether any of a VM's NICs is managed by agni
+func hasManagedNICs(cfg *models.VMConfig) bool {
+	for _, nic := range cfg.NetworkInterfaces {
+		if nic.Managed {
+			return true
+		}
+	}
+	return false
+}
+
+// validateManagedNICs rejects managed NICs that name a device: agni creates
+// and deletes their taps, so they cannot point at one it does not own
+func validateManagedNICs(cfg *models.VMConfig) error {
+	for _, nic := range cfg.NetworkInterfaces {
+		if nic.Managed && nic.Device != "" {
+			return models.ErrManagedNICDevice
+		}
+	}
+	return nil
+}
+
+// attachNetwork sets up the host side of a VM's managed NICs and records the
+// devices, MACs and addresses in its config
+func (m *Manager) attachNetwork(vm *models.VM) error {
+	if !hasManagedNICs(&vm.Config) {
+		return nil
+	}
+	if m.network == nil {
+		return models.ErrNetworkNotConfigured
+	}
+
+	// A jailed Firecracker runs as the jail user and must be able to open its taps
+	uid := 0
+	if vm.Config.Jailer != nil {
+		uid = vm.Config.Jailer.UID
+	}
+
+	nics, err := m.network.Attach(vm.ID, vm.Config.NetworkInterfaces, uid)
+	if err != nil {
+		return err
+	}
+	vm.Config.NetworkInterfaces = nics
+	return m.store.Update(vm)
+}
+
+// releaseNetwork removes a deleted VM's taps and frees its addresses
+func (m *Manager) releaseNetwork(vm *models.VM) {
+	if m.network == nil || !hasManagedNICs(&vm.Config) {
+		return
+	}
+	if err := m.network.Release(vm.ID, vm.Config.NetworkInterfaces); err != nil {
+		m.logger.Warn().Err(err).Str("vm_id", vm.ID).Msg("Failed to release VM network")
+	}
+}
+
+// kernelArgs returns a VM's kernel command line, passing the guest address
+// of managed NICs to the kernel
+func (m *Manager) kernelArgs(cfg *models.VMConfig) string {
+	if m.network == nil {
+		return cfg.KernelOpts
+	}
+	return m.network.KernelArgs(cfg.KernelOpts, cfg.NetworkInterfaces)
+}
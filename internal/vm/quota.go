@@ -0,0 +1,200 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+// quotaRequest is what a create or start adds to a user's usage
+type quotaRequest struct {
+	vms      int
+	cpus     int64 // Per VM
+	memoryMB int64 // Per VM
+	diskMB   int64 // In total
+}
+
+// Usage reports what a user's VMs use
+func (m *Manager) Usage(ownerID string) (*models.ResourceUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	usage, _, err := m.usage(ownerID)
+	return usage, err
+}
+
+// usage sums a user's VMs and returns the drive files they use. Callers
+// hold mu.
+func (m *Manager) usage(ownerID string) (*models.ResourceUsage, map[string]bool, error) {
+	vms, err := m.store.List()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage := &models.ResourceUsage{}
+	paths := make(map[string]bool)
+	var diskBytes int64
+	for _, vm := range vms {
+		if vm.OwnerID != ownerID {
+			continue
+		}
+		usage.VMs++
+		for _, path := range drivePaths(&vm.Config) {
+			if !paths[path] {
+				paths[path] = true
+				diskBytes += fileSize(path)
+			}
+		}
+	}
+	for _, running := range m.runningVMs {
+		if running.ownerID == ownerID {
+			usage.CPUs += running.cpus
+			usage.MemoryMB += running.memoryMB
+		}
+	}
+	usage.DiskMB = toMiB(diskBytes)
+	return usage, paths, nil
+}
+
+// ValidateOwner checks that a VM can be handed to the given user
+func (m *Manager) ValidateOwner(ownerID string) error {
+	_, err := m.users.Get(ownerID)
+	return err
+}
+
+// quota returns a user's quota, nil if there is none to enforce
+func (m *Manager) quota(ownerID string) (*models.UserQuota, error) {
+	if ownerID == "" {
+		return nil, nil
+	}
+	user, err := m.users.Get(ownerID)
+	if err == models.ErrUserNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user.Quota, nil
+}
+
+// checkCreateQuota makes sure new VMs with the given config fit into their
+// owner's quota. Drives the owner's VMs already use take no new space.
+// Callers hold createMu and mu.
+func (m *Manager) checkCreateQuota(ownerID string, count int, cfg *models.VMConfig, copied map[string]bool) error {
+	quota, err := m.quota(ownerID)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	usage, paths, err := m.usage(ownerID)
+	if err != nil {
+		return err
+	}
+
+	// Copied drives are new files for every VM, the others may be shared
+	var diskBytes int64
+	for _, path := range drivePaths(cfg) {
+		switch {
+		case copied[path]:
+			diskBytes += fileSize(path) * int64(count)
+		case !paths[path]:
+			paths[path] = true
+			diskBytes += fileSize(path)
+		}
+	}
+
+	return checkQuota(quota, usage, quotaRequest{
+		vms:      count,
+		cpus:     cfg.CPUs,
+		memoryMB: cfg.MemoryMB,
+		diskMB:   toMiB(diskBytes),
+	})
+}
+
+// checkStartQuota makes sure a VM fits into its owner's quota next to their
+// running VMs. Callers hold mu.
+func (m *Manager) checkStartQuota(vm *models.VM) error {
+	quota, err := m.quota(vm.OwnerID)
+	if err != nil || quota == nil {
+		return err
+	}
+	usage, _, err := m.usage(vm.OwnerID)
+	if err != nil {
+		return err
+	}
+
+	// The VM itself was counted when it was created, only the running ones
+	// have to make room for it
+	usage.VMs = 0
+	return checkQuota(quota, usage, quotaRequest{
+		cpus:     vm.Config.CPUs,
+		memoryMB: vm.Config.MemoryMB,
+	})
+}
+
+// checkQuota rejects a request that takes usage past a quota. vCPUs and
+// memory are checked against running VMs for starts, and against the quota
+// alone for creates, so a VM that could never start is not created.
+func checkQuota(quota *models.UserQuota, usage *models.ResourceUsage, req quotaRequest) error {
+	if req.vms == 0 {
+		switch {
+		case quota.MaxCPUs > 0 && usage.CPUs+req.cpus > quota.MaxCPUs:
+			return fmt.Errorf("%w: the VM needs %d vCPUs, running VMs use %d of %d", models.ErrQuotaExceeded, req.cpus, usage.CPUs, quota.MaxCPUs)
+		case quota.MaxMemoryMB > 0 && usage.MemoryMB+req.memoryMB > quota.MaxMemoryMB:
+			return fmt.Errorf("%w: the VM needs %d MiB of memory, running VMs use %d of %d MiB", models.ErrQuotaExceeded, req.memoryMB, usage.MemoryMB, quota.MaxMemoryMB)
+		}
+	} else {
+		switch {
+		case quota.MaxVMs > 0 && usage.VMs+req.vms > quota.MaxVMs:
+			return fmt.Errorf("%w: %d more VMs requested, %d of %d exist", models.ErrQuotaExceeded, req.vms, usage.VMs, quota.MaxVMs)
+		case quota.MaxCPUs > 0 && req.cpus > quota.MaxCPUs:
+			return fmt.Errorf("%w: the VM needs %d vCPUs, the quota allows %d", models.ErrQuotaExceeded, req.cpus, quota.MaxCPUs)
+		case quota.MaxMemoryMB > 0 && req.memoryMB > quota.MaxMemoryMB:
+			return fmt.Errorf("%w: the VM needs %d MiB of memory, the quota allows %d MiB", models.ErrQuotaExceeded, req.memoryMB, quota.MaxMemoryMB)
+		}
+	}
+	if quota.MaxDiskMB > 0 && usage.DiskMB+req.diskMB > quota.MaxDiskMB {
+		return fmt.Errorf("%w: %d MiB of disk needed, drives use %d of %d MiB", models.ErrQuotaExceeded, req.diskMB, usage.DiskMB, quota.MaxDiskMB)
+	}
+	return nil
+}
+
+// drivePaths returns the files backing a VM's drives
+func drivePaths(cfg *models.VMConfig) []string {
+	var paths []string
+	if cfg.RootDrive.Path != "" {
+		paths = append(paths, cfg.RootDrive.Path)
+	}
+	for _, drive := range cfg.AdditionalDrives {
+		if drive.Path != "" {
+			paths = append(paths, drive.Path)
+		}
+	}
+	return paths
+}
+
+// fileSize returns the apparent size of a file, 0 if it is missing
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// toMiB rounds bytes up to MiB
+func toMiB(bytes int64) int64 {
+	return (bytes + 1<<20 - 1) >> 20
+}
@@ -0,0 +1,116 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package vm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestQuota(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	users := storage.NewUserStore(store)
+	alice := &models.User{ID: "alice", Username: "alice", Quota: &models.UserQuota{MaxVMs: 2, MaxCPUs: 4, MaxMemoryMB: 1024, MaxDiskMB: 3}}
+	if err := users.Create(alice); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two VMs sharing a 2 MiB image take 2 MiB, not 4
+	image := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(image, make([]byte, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := models.VMConfig{Name: "web", CPUs: 2, MemoryMB: 512, RootDrive: models.Drive{Path: image}}
+
+	if _, err := m.Create(models.CreateVMRequest{Config: models.VMConfig{CPUs: 8, MemoryMB: 512}}, "alice", "alice"); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Errorf("Create() of a VM that can never start error = %v, want %v", err, models.ErrQuotaExceeded)
+	}
+	first, err := m.Create(models.CreateVMRequest{Config: cfg}, "alice", "alice")
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if first.OwnerID != "alice" {
+		t.Errorf("Create() owner = %q, want alice", first.OwnerID)
+	}
+	if _, err := m.Create(models.CreateVMRequest{Config: cfg}, "alice", "alice"); err != nil {
+		t.Fatalf("Create() of a second VM on the same image error = %v", err)
+	}
+	if _, err := m.Create(models.CreateVMRequest{Config: cfg}, "alice", "alice"); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Errorf("Create() past MaxVMs error = %v, want %v", err, models.ErrQuotaExceeded)
+	}
+
+	// Others are not limited by alice's quota
+	shared, err := m.Create(models.CreateVMRequest{Config: cfg}, "bob", "bob")
+	if err != nil {
+		t.Fatalf("Create() for a user without a quota error = %v", err)
+	}
+
+	usage, err := m.Usage("alice")
+	if err != nil || usage.VMs != 2 || usage.DiskMB != 2 {
+		t.Errorf("Usage() = %+v, %v, want 2 VMs and 2 MiB", usage, err)
+	}
+
+	// Cloning copies the drive, which does not fit
+	alice.Quota.MaxVMs = 0
+	if err := users.Update(alice); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Clone(first.ID, "alice", "alice", models.CloneVMRequest{}); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Errorf("Clone() past MaxDiskMB error = %v, want %v", err, models.ErrQuotaExceeded)
+	}
+	if _, err := m.Clone(first.ID, "alice", "alice", models.CloneVMRequest{SharedDrives: []string{"1"}}); err != nil {
+		t.Errorf("Clone() sharing the drive error = %v", err)
+	}
+
+	// Handing a VM over counts against the new owner's quota
+	other := filepath.Join(dir, "other.ext4")
+	if err := os.WriteFile(other, make([]byte, 2<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	gift, err := m.Create(models.CreateVMRequest{Config: models.VMConfig{Name: "gift", CPUs: 1, MemoryMB: 128, RootDrive: models.Drive{Path: other}}}, "bob", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	toAlice := func(vm *models.VM) { vm.OwnerID = "alice" }
+	if _, err := m.Update(gift.ID, toAlice, "admin"); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Errorf("Update() handing over a drive past MaxDiskMB error = %v, want %v", err, models.ErrQuotaExceeded)
+	}
+	if stored, err := m.Get(gift.ID); err != nil || stored.OwnerID != "bob" {
+		t.Errorf("VM after a refused handover = %+v, %v, want it to stay with bob", stored, err)
+	}
+	if _, err := m.Update(shared.ID, toAlice, "admin"); err != nil {
+		t.Errorf("Update() handing over a VM on alice's image error = %v", err)
+	}
+
+	// A running VM takes 2 vCPUs and 512 MiB, room is left for one more
+	m.runningVMs["running"] = &RunningVM{cpus: 2, memoryMB: 512, ownerID: "alice"}
+	if err := m.checkStartQuota(first); err != nil {
+		t.Errorf("checkStartQuota() error = %v", err)
+	}
+	m.runningVMs["other"] = &RunningVM{cpus: 1, memoryMB: 128, ownerID: "alice"}
+	if err := m.checkStartQuota(first); !errors.Is(err, models.ErrQuotaExceeded) {
+		t.Errorf("checkStartQuota() past MaxCPUs error = %v, want %v", err, models.ErrQuotaExceeded)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	log "github.com/sirupsen/logrus"
+)
+
+// toFCRateLimiter converts a rate limiter to Firecracker's representation
+func toFCRateLimiter(rl *models.RateLimiter) *fcmodels.RateLimiter {
+	if rl == nil {
+		return nil
+	}
+	return &fcmodels.RateLimiter{
+		Bandwidth: toFCTokenBucket(rl.Bandwidth),
+		Ops:       toFCTokenBucket(rl.Ops),
+	}
+}
+
+// toFCTokenBucket converts a token bucket to Firecracker's representation
+func toFCTokenBucket(tb *models.TokenBucket) *fcmodels.TokenBucket {
+	if tb == nil {
+		return nil
+	}
+	bucket := &fcmodels.TokenBucket{
+		Size:       firecracker.Int64(tb.Size),
+		RefillTime: firecracker.Int64(tb.RefillTimeMs),
+	}
+	if tb.OneTimeBurst > 0 {
+		bucket.OneTimeBurst = firecracker.Int64(tb.OneTimeBurst)
+	}
+	return bucket
+}
+
+// toFCRateLimiterUpdate converts a rate limiter for a live update. Firecracker
+// leaves buckets missing from a PATCH untouched, so they are sent as empty
+// buckets, which disable the limit, to make the update replace the limiter.
+func toFCRateLimiterUpdate(rl *models.RateLimiter) *fcmodels.RateLimiter {
+	update := toFCRateLimiter(rl)
+	if update == nil {
+		update = &fcmodels.RateLimiter{}
+	}
+	disabled := &fcmodels.TokenBucket{Size: firecracker.Int64(0), RefillTime: firecracker.Int64(0)}
+	if update.Bandwidth == nil {
+		update.Bandwidth = disabled
+	}
+	if update.Ops == nil {
+		update.Ops = disabled
+	}
+	return update
+}
+
+// validateRateLimiter rejects negative sizes and refill times
+func validateRateLimiter(rl *models.RateLimiter) error {
+	if rl == nil {
+		return nil
+	}
+	for _, tb := range []*models.TokenBucket{rl.Bandwidth, rl.Ops} {
+		if tb != nil && (tb.Size < 0 || tb.RefillTimeMs < 0 || tb.OneTimeBurst < 0) {
+			return models.ErrInvalidRateLimiter
+		}
+	}
+	return nil
+}
+
+// normalizeRateLimiter returns nil for limiters that limit nothing, so they
+// are dropped from the stored config
+func normalizeRateLimiter(rl *models.RateLimiter) *models.RateLimiter {
+	if rl == nil || (rl.Bandwidth == nil && rl.Ops == nil) {
+		return nil
+	}
+	return rl
+}
+
+// UpdateRateLimiters changes drive and NIC rate limiters, live if the VM is
+// running, and persists them so they survive a restart
+func (m *Manager) UpdateRateLimiters(id string, req *models.UpdateRateLimitersRequest, actor string) (*models.VM, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate everything before touching a running VM
+	nicIndex := make(map[string]int, len(vm.Config.NetworkInterfaces))
+	for i, nic := range vm.Config.NetworkInterfaces {
+		nicIndex[nic.Device] = i
+	}
+	for driveID, rl := range req.Drives {
+		if driveIndex(vm, driveID) < 0 {
+			return nil, models.ErrDriveNotFound
+		}
+		if err := validateRateLimiter(rl); err != nil {
+			return nil, err
+		}
+	}
+	for device, limits := range req.NICs {
+		if _, ok := nicIndex[device]; !ok {
+			return nil, models.ErrNICNotFound
+		}
+		if err := validateRateLimiter(limits.Rx); err != nil {
+			return nil, err
+		}
+		if err := validateRateLimiter(limits.Tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if running, exists := m.runningVMs[id]; exists {
+		if err := m.applyRateLimiters(running, req, nicIndex); err != nil {
+			return nil, err
+		}
+	}
+
+	for driveID, rl := range req.Drives {
+		if i := driveIndex(vm, driveID); i == 0 {
+			vm.Config.RootDrive.RateLimiter = normalizeRateLimiter(rl)
+		} else {
+			vm.Config.AdditionalDrives[i-1].RateLimiter = normalizeRateLimiter(rl)
+		}
+	}
+	for device, limits := range req.NICs {
+		nic := &vm.Config.NetworkInterfaces[nicIndex[device]]
+		nic.RxRateLimiter = normalizeRateLimiter(limits.Rx)
+		nic.TxRateLimiter = normalizeRateLimiter(limits.Tx)
+	}
+
+	if err := m.store.Update(vm); err != nil {
+		return nil, err
+	}
+
+	m.logger.Info().Str("vm_id", id).Int("drives", len(req.Drives)).Int("nics", len(req.NICs)).Msg("VM rate limiters updated")
+	m.emit(models.EventConfigChanged, vm, vm.Status, vm.Status, actor)
+	return vm, nil
+}
+
+// applyRateLimiters sends rate limiter updates to a running Firecracker
+func (m *Manager) applyRateLimiters(running *RunningVM, req *models.UpdateRateLimitersRequest, nicIndex map[string]int) error {
+	ctx := context.Background()
+
+	for driveID, rl := range req.Drives {
+		limiter := toFCRateLimiterUpdate(rl)
+		if err := running.Machine.UpdateGuestDrive(ctx, driveID, "", func(params *ops.PatchGuestDriveByIDParams) {
+			params.Body.RateLimiter = limiter
+		}); err != nil {
+			return fmt.Errorf("failed to update rate limiter of drive %s: %w", driveID, err)
+		}
+	}
+
+	if len(req.NICs) == 0 {
+		return nil
+	}
+
+	// Machine.UpdateGuestNetworkInterfaceRateLimit applies the receive limiter
+	// to both directions, so talk to the API directly
+	client := firecracker.NewClient(running.Machine.Cfg.SocketPath, log.NewEntry(log.New()), false)
+	for device, limits := range req.NICs {
+		ifaceID := strconv.Itoa(nicIndex[device] + 1)
+		if _, err := client.PatchGuestNetworkInterfaceByID(ctx, ifaceID, &fcmodels.PartialNetworkInterface{
+			IfaceID:       firecracker.String(ifaceID),
+			RxRateLimiter: toFCRateLimiterUpdate(limits.Rx),
+			TxRateLimiter: toFCRateLimiterUpdate(limits.Tx),
+		}); err != nil {
+			return fmt.Errorf("failed to update rate limiters of %s: %w", device, err)
+		}
+	}
+	return nil
+}
+
+// driveIndex returns 0 for the root drive, i+1 for additional drive i and -1
+// if the VM has no drive with that ID
+func driveIndex(vm *models.VM, driveID string) int {
+	if driveID == "1" {
+		return 0
+	}
+	n, err := strconv.Atoi(driveID)
+	if err != nil || n < 2 || n-2 >= len(vm.Config.AdditionalDrives) {
+		return -1
+	}
+	return n - 1
+}
@@ -0,0 +1,54 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+func TestToFCRateLimiterUpdate(t *testing.T) {
+	update := toFCRateLimiterUpdate(&models.RateLimiter{
+		Bandwidth: &models.TokenBucket{Size: 1024, RefillTimeMs: 100, OneTimeBurst: 4096},
+	})
+
+	if got := firecracker.Int64Value(update.Bandwidth.Size); got != 1024 {
+		t.Errorf("bandwidth size = %d, want 1024", got)
+	}
+	if got := firecracker.Int64Value(update.Bandwidth.OneTimeBurst); got != 4096 {
+		t.Errorf("bandwidth burst = %d, want 4096", got)
+	}
+	if update.Ops == nil || firecracker.Int64Value(update.Ops.Size) != 0 {
+		t.Errorf("missing ops bucket should be sent disabled, got %+v", update.Ops)
+	}
+
+	if cleared := toFCRateLimiterUpdate(nil); cleared.Bandwidth == nil || cleared.Ops == nil {
+		t.Errorf("nil limiter should disable both buckets, got %+v", cleared)
+	}
+}
+
+func TestDriveIndex(t *testing.T) {
+	vm := &models.VM{Config: models.VMConfig{
+		AdditionalDrives: []models.Drive{{Path: "/a"}, {Path: "/b"}},
+	}}
+
+	cases := map[string]int{"1": 0, "2": 1, "3": 2, "4": -1, "0": -1, "root": -1}
+	for id, want := range cases {
+		if got := driveIndex(vm, id); got != want {
+			t.Errorf("driveIndex(%q) = %d, want %d", id, got, want)
+		}
+	}
+}
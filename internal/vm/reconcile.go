@@ -0,0 +1,266 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// probeTimeout bounds how long we wait for a recorded API socket to answer
+	probeTimeout = 2 * time.Second
+
+	// adoptedPollInterval is how often an adopted process is checked for exit
+	adoptedPollInterval = time.Second
+)
+
+// processAlive checks whether a recorded PID still exists
+var processAlive = isProcessAlive
+
+// Reconcile brings persisted VM state in line with reality after a daemon
+// restart. VMs recorded as active are probed through their API socket: live
+// Firecracker processes are re-attached so Stop, Shutdown and Metrics work
+// again, dead ones are marked stopped (or error) with a reason.
+func (m *Manager) Reconcile(ctx context.Context) error {
+	vms, err := m.store.List()
+	if err != nil {
+		return fmt.Errorf("failed to list VMs: %w", err)
+	}
+
+	for _, vm := range vms {
+		if !isActiveStatus(vm.Status) {
+			continue
+		}
+
+		m.mu.RLock()
+		_, tracked := m.runningVMs[vm.ID]
+		m.mu.RUnlock()
+		if tracked {
+			continue
+		}
+
+		if err := m.reconcileVM(ctx, vm); err != nil {
+			m.logger.Error().Err(err).Str("vm_id", vm.ID).Msg("Failed to reconcile VM")
+		}
+	}
+
+	return nil
+}
+
+// reconcileVM probes a single VM and either adopts it or records why it is gone
+func (m *Manager) reconcileVM(ctx context.Context, vm *models.VM) error {
+	alive := vm.PID > 0 && processAlive(vm.PID)
+
+	if vm.SocketPath == "" || !alive {
+		m.removeStaleSocket(vm.SocketPath)
+		if err := m.markReconciled(vm, models.VMStatusStopped,
+			"firecracker process exited while agni was not running"); err != nil {
+			return err
+		}
+		// How it exited is unknown, so only the always policy applies
+		m.scheduleRestart(vm, false)
+		return nil
+	}
+
+	state, err := probeSocket(ctx, vm.SocketPath)
+	if err != nil {
+		return m.markReconciled(vm, models.VMStatusError,
+			fmt.Sprintf("firecracker process %d is alive but its API socket is unresponsive: %v", vm.PID, err))
+	}
+
+	status := models.VMStatusRunning
+	if state == fcmodels.InstanceInfoStatePaused {
+		status = models.VMStatusPaused
+	}
+
+	return m.adopt(vm, status)
+}
+
+// adopt re-attaches a live Firecracker process to the manager
+func (m *Manager) adopt(vm *models.VM, status models.VMStatus) error {
+	fcConfig, err := m.buildFirecrackerConfig(vm)
+	if err != nil {
+		return fmt.Errorf("failed to build config: %w", err)
+	}
+	// A jailed VM keeps the chroot-relative path, which the SDK joins with
+	// the chroot again; vm.SocketPath is already the joined host path
+	if fcConfig.JailerCfg == nil {
+		fcConfig.SocketPath = vm.SocketPath
+	}
+
+	proc, err := os.FindProcess(vm.PID)
+	if err != nil {
+		return fmt.Errorf("failed to find process %d: %w", vm.PID, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// The process was started by a previous daemon, so it cannot be waited
+	// on. A command carrying only the process lets StopVMM signal it.
+	machine, err := firecracker.NewMachine(ctx, fcConfig,
+		firecracker.WithLogger(m.sdkLogger(vm.ID)),
+		firecracker.WithProcessRunner(&exec.Cmd{Process: proc}),
+	)
+	if err != nil {
+		cancel()
+		return fmt.Errorf("failed to create machine: %w", err)
+	}
+
+	running := &RunningVM{
+		Machine:    machine,
+		Cancel:     cancel,
+		SocketPath: vm.SocketPath,
+		PID:        vm.PID,
+		Adopted:    true,
+		exited:     make(chan struct{}),
+		cpus:       vm.Config.CPUs,
+		memoryMB:   vm.Config.MemoryMB,
+		ownerID:    vm.OwnerID,
+	}
+
+	// Firecracker keeps writing to the FIFO created by the previous daemon
+	if _, err := os.Stat(fcConfig.MetricsFifo); err == nil {
+		metrics := newMetricsCollector(vm.ID, vm.SocketPath, vm.Config.MemoryMB, m.logger)
+		if err := metrics.attach(fcConfig.MetricsFifo); err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Msg("Failed to re-attach metrics FIFO")
+		} else {
+			running.metrics = metrics
+		}
+	}
+
+	// Serial output went to the previous daemon and cannot be recovered
+	if _, err := os.Stat(fcConfig.LogFifo); err == nil {
+		logFifo, err := m.attachLogFifo(vm.ID, fcConfig.LogFifo)
+		if err != nil {
+			m.logger.Warn().Err(err).Str("vm_id", vm.ID).Msg("Failed to re-attach log FIFO")
+		} else {
+			running.logFifo = logFifo
+		}
+	}
+
+	m.mu.Lock()
+	m.runningVMs[vm.ID] = running
+	m.mu.Unlock()
+
+	if vm.Status != status {
+		vm.Status = status
+		if err := m.store.Update(vm); err != nil {
+			m.logger.Error().Err(err).Str("vm_id", vm.ID).Msg("Failed to update VM state")
+		}
+	}
+
+	m.logger.Info().Str("vm_id", vm.ID).Int("pid", vm.PID).Msg("Re-attached to running VM")
+
+	go m.waitForAdoptedVM(vm.ID, running, ctx)
+
+	return nil
+}
+
+// waitForAdoptedVM polls an adopted process until it exits or is stopped
+func (m *Manager) waitForAdoptedVM(id string, running *RunningVM, ctx context.Context) {
+	ticker := time.NewTicker(adoptedPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			m.markExited(id, running, nil)
+			return
+		case <-ticker.C:
+			if !processAlive(running.PID) {
+				m.markExited(id, running, nil)
+				return
+			}
+		}
+	}
+}
+
+// markReconciled records the outcome of reconciling a VM that is no longer running
+func (m *Manager) markReconciled(vm *models.VM, status models.VMStatus, reason string) error {
+	previous := vm.Status
+	now := time.Now()
+	vm.Status = status
+	vm.Error = reason
+	vm.StoppedAt = &now
+	vm.PID = 0
+	m.teardownCNI(vm)
+	clearCNIResult(vm)
+	if err := m.store.Update(vm); err != nil {
+		return err
+	}
+	m.cleanupJail(vm)
+
+	m.logger.Warn().Str("vm_id", vm.ID).Str("status", string(status)).Str("reason", reason).Msg("Reconciled stale VM state")
+
+	eventType := models.EventStopped
+	if status == models.VMStatusError {
+		eventType = models.EventCrashed
+	}
+	m.emit(eventType, vm, previous, status, models.ActorSystem)
+	return nil
+}
+
+// isActiveStatus reports whether a status implies a Firecracker process
+func isActiveStatus(status models.VMStatus) bool {
+	switch status {
+	case models.VMStatusStarting, models.VMStatusRunning, models.VMStatusPaused, models.VMStatusStopping:
+		return true
+	}
+	return false
+}
+
+// isProcessAlive checks whether a process exists without signalling it
+func isProcessAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// probeSocket checks that a Firecracker API socket answers requests and
+// returns the instance state it reports
+func probeSocket(ctx context.Context, socketPath string) (string, error) {
+	if _, err := os.Stat(socketPath); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+
+	client := firecracker.NewClient(socketPath, log.NewEntry(log.New()), false)
+	resp, err := client.GetInstanceInfo(ctx)
+	if err != nil {
+		return "", err
+	}
+	return firecracker.StringValue(resp.Payload.State), nil
+}
+
+// removeStaleSocket removes a socket file left behind by a dead process
+func (m *Manager) removeStaleSocket(socketPath string) {
+	if socketPath == "" {
+		return
+	}
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		m.logger.Warn().Err(err).Str("socket", socketPath).Msg("Failed to remove stale socket")
+	}
+}
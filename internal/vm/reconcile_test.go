@@ -0,0 +1,179 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// fakeFirecracker serves a Firecracker API reporting the given instance state
+func fakeFirecracker(t *testing.T, socketPath, state string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"app_name":    "Firecracker",
+			"id":          "fake",
+			"state":       state,
+			"vmm_version": "1.0.0",
+		})
+	})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+}
+
+func TestReconcile(t *testing.T) {
+	const pid = 4242
+
+	cases := []struct {
+		name        string
+		status      models.VMStatus
+		alive       bool
+		socket      string // "" for none recorded, "stale" for a plain file, or a state to serve
+		jailed      bool
+		wantStatus  models.VMStatus
+		wantAdopted bool
+	}{
+		{name: "dead process", status: models.VMStatusRunning, socket: "stale", wantStatus: models.VMStatusStopped},
+		{name: "no socket recorded", status: models.VMStatusStarting, alive: true, wantStatus: models.VMStatusStopped},
+		{name: "unresponsive socket", status: models.VMStatusRunning, alive: true, socket: "stale", wantStatus: models.VMStatusError},
+		{name: "running", status: models.VMStatusRunning, alive: true, socket: fcmodels.InstanceInfoStateRunning, wantStatus: models.VMStatusRunning, wantAdopted: true},
+		{name: "paused while away", status: models.VMStatusRunning, alive: true, socket: fcmodels.InstanceInfoStatePaused, wantStatus: models.VMStatusPaused, wantAdopted: true},
+		{name: "resumed while away", status: models.VMStatusPaused, alive: true, socket: fcmodels.InstanceInfoStateRunning, wantStatus: models.VMStatusRunning, wantAdopted: true},
+		{name: "stopped", status: models.VMStatusStopped, alive: true, socket: fcmodels.InstanceInfoStateRunning, wantStatus: models.VMStatusStopped},
+		{name: "jailed", status: models.VMStatusRunning, alive: true, socket: fcmodels.InstanceInfoStateRunning, jailed: true, wantStatus: models.VMStatusRunning, wantAdopted: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			// Unix socket paths are short, so stay out of the long test directory
+			dir, err := os.MkdirTemp("", "agni")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			m := NewManager(store)
+
+			bin := filepath.Join(dir, "firecracker")
+			if err := os.WriteFile(bin, nil, 0755); err != nil {
+				t.Fatal(err)
+			}
+			m.SetFirecrackerBinary(bin)
+			m.SetJailer(JailerSettings{Binary: "jailer", ChrootBaseDir: filepath.Join(dir, "jail"), UIDs: []int{0}, GIDs: []int{0}})
+
+			alive := c.alive
+			processAlive = func(int) bool { return alive }
+			defer func() { processAlive = isProcessAlive }()
+
+			vm := &models.VM{ID: "vm", Status: c.status, PID: pid}
+			vm.SocketPath = filepath.Join(dir, "fc.sock")
+			if c.jailed {
+				vm.Config.Jailer = &models.JailerConfig{ID: "vm"}
+				vm.SocketPath = filepath.Join(dir, "jail", "firecracker", "vm", chrootRootName, jailedSocketPath)
+			}
+			switch c.socket {
+			case "":
+				vm.SocketPath = ""
+			case "stale":
+				if !c.alive {
+					if err := os.WriteFile(vm.SocketPath, nil, 0600); err != nil {
+						t.Fatal(err)
+					}
+				}
+			default:
+				fakeFirecracker(t, vm.SocketPath, c.socket)
+			}
+			if err := m.store.Create(vm); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := m.Reconcile(context.Background()); err != nil {
+				t.Fatalf("Reconcile() error = %v", err)
+			}
+
+			got, err := m.Get(vm.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != c.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, c.wantStatus)
+			}
+
+			m.mu.RLock()
+			running := m.runningVMs[vm.ID]
+			m.mu.RUnlock()
+			if (running != nil) != c.wantAdopted {
+				t.Fatalf("adopted = %v, want %v", running != nil, c.wantAdopted)
+			}
+
+			if running == nil {
+				if c.status != models.VMStatusStopped && (got.Error == "" || got.PID != 0) {
+					t.Errorf("expected a reason and no PID, got error %q and PID %d", got.Error, got.PID)
+				}
+				if c.socket == "stale" && !c.alive {
+					if _, err := os.Stat(vm.SocketPath); !os.IsNotExist(err) {
+						t.Errorf("expected stale socket to be removed")
+					}
+				}
+				return
+			}
+
+			if !running.Adopted || running.PID != pid {
+				t.Errorf("running = %+v, want adopted PID %d", running, pid)
+			}
+
+			// The machine must talk to the socket the process listens on
+			if running.Machine.Cfg.SocketPath != vm.SocketPath {
+				t.Errorf("machine socket = %s, want %s", running.Machine.Cfg.SocketPath, vm.SocketPath)
+			}
+			info, err := running.Machine.DescribeInstanceInfo(context.Background())
+			if err != nil || firecracker.StringValue(info.State) != c.socket {
+				t.Errorf("DescribeInstanceInfo() = %v, %v, want state %s", info.State, err, c.socket)
+			}
+
+			// Never signal the made-up PID, just let go of it
+			running.Cancel()
+			<-running.exited
+		})
+	}
+}
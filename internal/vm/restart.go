@@ -0,0 +1,218 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+const (
+	defaultRestartWindow     = 10 * time.Minute
+	defaultRestartBackoff    = time.Second
+	defaultMaxRestartBackoff = time.Minute
+)
+
+// validateRestartPolicy rejects unknown policies and negative limits
+func validateRestartPolicy(policy *models.RestartPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	switch policy.Policy {
+	case models.RestartNever, models.RestartOnFailure, models.RestartAlways:
+	default:
+		return models.ErrInvalidRestartPolicy
+	}
+	if policy.MaxRetries < 0 || policy.WindowSeconds < 0 || policy.InitialBackoffMs < 0 || policy.MaxBackoffMs < 0 {
+		return models.ErrInvalidRestartPolicy
+	}
+	return nil
+}
+
+// exitStatus extracts Firecracker's exit status from the error returned by
+// Machine.Wait. A process killed by a signal reports 128 plus the signal
+// number, like a shell does. Nil means the status is unknown.
+func exitStatus(err error) *int {
+	code := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		switch {
+		case errors.As(err, &exitErr):
+			code = exitErr.ExitCode()
+			if ws, ok := exitErr.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+				code = 128 + int(ws.Signal())
+			}
+		case errors.Is(err, context.Canceled):
+			return nil
+		}
+	}
+	return &code
+}
+
+// shouldRestart decides whether a policy restarts a VM after it exited
+func shouldRestart(policy *models.RestartPolicy, failed bool) bool {
+	if policy == nil {
+		return false
+	}
+	switch policy.Policy {
+	case models.RestartAlways:
+		return true
+	case models.RestartOnFailure:
+		return failed
+	}
+	return false
+}
+
+// restartBackoff returns the delay before the next restart, doubling for
+// each restart already made within the window
+func restartBackoff(policy *models.RestartPolicy, attempt int) time.Duration {
+	delay := defaultRestartBackoff
+	if policy.InitialBackoffMs > 0 {
+		delay = time.Duration(policy.InitialBackoffMs) * time.Millisecond
+	}
+	limit := defaultMaxRestartBackoff
+	if policy.MaxBackoffMs > 0 {
+		limit = time.Duration(policy.MaxBackoffMs) * time.Millisecond
+	}
+
+	for i := 0; i < attempt && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay > limit {
+		delay = limit
+	}
+	return delay
+}
+
+// restartWindow returns how far back restarts count against MaxRetries
+func restartWindow(policy *models.RestartPolicy) time.Duration {
+	if policy.WindowSeconds > 0 {
+		return time.Duration(policy.WindowSeconds) * time.Second
+	}
+	return defaultRestartWindow
+}
+
+// scheduleRestart applies a VM's restart policy after it exited on its own.
+// failed is set for crashes and failed restarts.
+func (m *Manager) scheduleRestart(vm *models.VM, failed bool) {
+	policy := vm.Config.RestartPolicy
+	if !shouldRestart(policy, failed) {
+		return
+	}
+
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+
+	// Only restarts within the window count towards the limit
+	now := time.Now()
+	cutoff := now.Add(-restartWindow(policy))
+	var recent []time.Time
+	for _, t := range m.restartHistory[vm.ID] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	if policy.MaxRetries > 0 && len(recent) >= policy.MaxRetries {
+		delete(m.restartHistory, vm.ID)
+		reason := fmt.Sprintf("gave up after %d restarts within %s", len(recent), restartWindow(policy))
+		if vm.Error != "" {
+			reason = vm.Error + "; " + reason
+		}
+		previous := vm.Status
+		updated, err := m.updateVM(vm.ID, func(vm *models.VM) {
+			previous = vm.Status
+			vm.Status = models.VMStatusError
+			vm.Error = reason
+		})
+		if err != nil {
+			m.logger.Error().Err(err).Msg("Failed to update VM state")
+			return
+		}
+		m.emit(models.EventCrashed, updated, previous, updated.Status, models.ActorSystem)
+		m.logger.Warn().Str("vm_id", vm.ID).Int("restarts", len(recent)).Msg("Restart limit reached")
+		return
+	}
+
+	delay := restartBackoff(policy, len(recent))
+	m.restartHistory[vm.ID] = append(recent, now)
+
+	id := vm.ID
+	m.restartTimers[id] = time.AfterFunc(delay, func() { m.restart(id) })
+	m.logger.Info().Str("vm_id", id).Dur("delay", delay).Msg("VM restart scheduled")
+}
+
+// restart runs a scheduled restart, scheduling another one if it fails
+func (m *Manager) restart(id string) {
+	m.restartMu.Lock()
+	delete(m.restartTimers, id)
+	m.restartMu.Unlock()
+
+	vm, err := m.updateVM(id, func(vm *models.VM) { vm.RestartCount++ })
+	if err != nil {
+		m.logger.Error().Err(err).Msg("Failed to update VM state")
+		return
+	}
+
+	m.logger.Info().Str("vm_id", id).Int("restart_count", vm.RestartCount).Msg("Restarting VM")
+
+	if err := m.start(id, models.ActorSystem); err != nil {
+		if err == models.ErrVMAlreadyRunning {
+			return
+		}
+		m.logger.Error().Err(err).Str("vm_id", id).Msg("VM restart failed")
+		if vm, err := m.store.Get(id); err == nil {
+			m.scheduleRestart(vm, true)
+		}
+	}
+}
+
+// cancelRestart drops a VM's pending restart and reports whether there was one
+func (m *Manager) cancelRestart(id string) bool {
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+
+	timer, pending := m.restartTimers[id]
+	if pending {
+		timer.Stop()
+		delete(m.restartTimers, id)
+	}
+	return pending
+}
+
+// cancelRestarts drops all pending restarts, for daemon shutdown
+func (m *Manager) cancelRestarts() {
+	m.restartMu.Lock()
+	defer m.restartMu.Unlock()
+
+	for id, timer := range m.restartTimers {
+		timer.Stop()
+		delete(m.restartTimers, id)
+	}
+}
+
+// resetRestarts cancels a pending restart and forgets a VM's restart history
+func (m *Manager) resetRestarts(id string) {
+	m.cancelRestart(id)
+
+	m.restartMu.Lock()
+	delete(m.restartHistory, id)
+	m.restartMu.Unlock()
+}
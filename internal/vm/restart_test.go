@@ -0,0 +1,79 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+)
+
+func TestExitStatus(t *testing.T) {
+	if code := exitStatus(nil); code == nil || *code != 0 {
+		t.Errorf("exitStatus(nil) = %v, want 0", code)
+	}
+	if code := exitStatus(context.Canceled); code != nil {
+		t.Errorf("exitStatus(context.Canceled) = %d, want nil", *code)
+	}
+
+	// The SDK wraps the wait error together with cleanup errors
+	err := fmt.Errorf("wait: %w", exec.Command("sh", "-c", "exit 3").Run())
+	if code := exitStatus(err); code == nil || *code != 3 {
+		t.Errorf("exitStatus() for exit 3 = %v, want 3", code)
+	}
+
+	err = exec.Command("sh", "-c", "kill -9 $$").Run()
+	if code := exitStatus(err); code == nil || *code != 137 {
+		t.Errorf("exitStatus() for SIGKILL = %v, want 137", code)
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	cases := []struct {
+		policy *models.RestartPolicy
+		failed bool
+		want   bool
+	}{
+		{nil, true, false},
+		{&models.RestartPolicy{Policy: models.RestartNever}, true, false},
+		{&models.RestartPolicy{Policy: models.RestartOnFailure}, true, true},
+		{&models.RestartPolicy{Policy: models.RestartOnFailure}, false, false},
+		{&models.RestartPolicy{Policy: models.RestartAlways}, false, true},
+	}
+
+	for _, c := range cases {
+		if got := shouldRestart(c.policy, c.failed); got != c.want {
+			t.Errorf("shouldRestart(%+v, %v) = %v, want %v", c.policy, c.failed, got, c.want)
+		}
+	}
+}
+
+func TestRestartBackoff(t *testing.T) {
+	policy := &models.RestartPolicy{InitialBackoffMs: 500, MaxBackoffMs: 3000}
+	want := []time.Duration{500 * time.Millisecond, time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+
+	for attempt, w := range want {
+		if got := restartBackoff(policy, attempt); got != w {
+			t.Errorf("restartBackoff(%d) = %s, want %s", attempt, got, w)
+		}
+	}
+
+	if got := restartBackoff(&models.RestartPolicy{}, 100); got != defaultMaxRestartBackoff {
+		t.Errorf("restartBackoff() with defaults = %s, want %s", got, defaultMaxRestartBackoff)
+	}
+}
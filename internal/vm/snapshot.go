@@ -0,0 +1,385 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	fcmodels "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/google/uuid"
+)
+
+const (
+	snapshotMemFile     = "memory"
+	snapshotStateFile   = "vmstate"
+	snapshotRestoredMem = "memory.restore"
+
+	// Linux lseek whence values for walking sparse files
+	seekData = 3
+	seekHole = 4
+)
+
+// CreateSnapshot pauses a running VM, writes a full or diff snapshot of its
+// memory and device state, and resumes it. Drives are not copied; their size
+// and modification time are recorded so a restore onto a changed drive is
+// refused. mu is only held to pause the VM and mark it busy, not while the
+// memory is written.
+func (m *Manager) CreateSnapshot(id string, snapshotType models.SnapshotType) (*models.Snapshot, error) {
+	if snapshotType == "" {
+		snapshotType = models.SnapshotTypeFull
+	}
+	if snapshotType != models.SnapshotTypeFull && snapshotType != models.SnapshotTypeDiff {
+		return nil, models.ErrInvalidSnapshotType
+	}
+
+	m.mu.Lock()
+	locked := true
+	defer func() {
+		if locked {
+			m.mu.Unlock()
+		}
+	}()
+
+	running, exists := m.runningVMs[id]
+	if !exists {
+		return nil, models.ErrVMNotRunning
+	}
+	if running.snapshotting {
+		return nil, models.ErrSnapshotInProgress
+	}
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if vm.Config.Jailer != nil {
+		return nil, models.ErrSnapshotJailed
+	}
+
+	snapshot := &models.Snapshot{
+		ID:   uuid.New().String(),
+		VMID: id,
+		Type: snapshotType,
+	}
+
+	// Dirty pages are only tracked by this process since its last snapshot
+	// or restore, so that is the only base a diff can go on
+	if snapshotType == models.SnapshotTypeDiff {
+		if !vm.Config.TrackDirtyPages {
+			return nil, models.ErrDirtyPagesNotTracked
+		}
+		if running.lastSnapshotID == "" {
+			return nil, models.ErrNoParentSnapshot
+		}
+		snapshot.ParentID = running.lastSnapshotID
+	}
+
+	dir := m.snapshotDir(id, snapshot.ID)
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	snapshot.MemFilePath = filepath.Join(dir, snapshotMemFile)
+	snapshot.StateFilePath = filepath.Join(dir, snapshotStateFile)
+
+	// Firecracker only snapshots paused VMs; leave user-paused VMs paused
+	ctx := context.Background()
+	wasPaused := vm.Status == models.VMStatusPaused
+	if !wasPaused {
+		if err := running.Machine.PauseVM(ctx); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to pause VM: %w", err)
+		}
+	}
+	running.snapshotting = true
+	m.mu.Unlock()
+	locked = false
+
+	createErr := running.Machine.CreateSnapshot(ctx, snapshot.MemFilePath, snapshot.StateFilePath,
+		withSnapshotType(snapshotType))
+
+	// Nothing writes to the drives while the VM is paused
+	if createErr == nil {
+		snapshot.Drives, createErr = recordDrives(&vm.Config)
+	}
+
+	if !wasPaused {
+		if err := running.Machine.ResumeVM(ctx); err != nil {
+			m.logger.Error().Err(err).Str("vm_id", id).Msg("Failed to resume VM after snapshot")
+		}
+	}
+
+	m.mu.Lock()
+	locked = true
+	running.snapshotting = false
+
+	if createErr != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create snapshot: %w", createErr)
+	}
+
+	snapshot.SizeBytes = diskUsage(snapshot.MemFilePath) + diskUsage(snapshot.StateFilePath)
+	snapshot.CreatedAt = time.Now()
+
+	if err := m.snapshots.Create(snapshot); err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	running.lastSnapshotID = snapshot.ID
+
+	m.logger.Info().Str("vm_id", id).Str("snapshot_id", snapshot.ID).Str("type", string(snapshotType)).Msg("Snapshot created")
+	return snapshot, nil
+}
+
+// ListSnapshots returns all snapshots of a VM, oldest first
+func (m *Manager) ListSnapshots(id string) ([]*models.Snapshot, error) {
+	if _, err := m.store.Get(id); err != nil {
+		return nil, err
+	}
+	return m.snapshots.ListByVM(id)
+}
+
+// RestoreSnapshot boots a stopped VM from one of its snapshots. Diff
+// snapshots are layered onto their full base before loading.
+func (m *Manager) RestoreSnapshot(id, snapshotID, actor string) error {
+	if m.IsRunning(id) {
+		return models.ErrVMAlreadyRunning
+	}
+
+	snapshot, err := m.snapshots.Get(snapshotID)
+	if err != nil {
+		return err
+	}
+	if snapshot.VMID != id {
+		return models.ErrSnapshotNotFound
+	}
+
+	vm, err := m.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if vm.Config.Jailer != nil {
+		return models.ErrSnapshotJailed
+	}
+
+	if err := checkDrives(snapshot.Drives); err != nil {
+		return err
+	}
+
+	// Firecracker maps the memory file when it loads the snapshot, so a
+	// rebuilt one is not needed once the VM has started
+	memFile := snapshot.MemFilePath
+	if snapshot.Type == models.SnapshotTypeDiff {
+		memFile, err = m.materializeMemory(snapshot)
+		if err != nil {
+			return fmt.Errorf("failed to rebuild snapshot memory: %w", err)
+		}
+		defer os.Remove(memFile)
+	}
+
+	m.logger.Info().Str("vm_id", id).Str("snapshot_id", snapshotID).Msg("Restoring VM from snapshot")
+
+	err = m.start(id, actor, firecracker.WithSnapshot(memFile, snapshot.StateFilePath,
+		func(cfg *firecracker.SnapshotConfig) {
+			cfg.ResumeVM = true
+			cfg.EnableDiffSnapshots = vm.Config.TrackDirtyPages
+		}))
+	if err != nil {
+		return err
+	}
+
+	// The restored guest starts from this snapshot's memory, so the next
+	// diff goes on top of it
+	m.mu.Lock()
+	if running, exists := m.runningVMs[id]; exists {
+		running.lastSnapshotID = snapshot.ID
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// materializeMemory builds a complete memory file for a diff snapshot by
+// copying its full base and overlaying every diff in the chain, oldest first
+func (m *Manager) materializeMemory(snapshot *models.Snapshot) (string, error) {
+	chain := []*models.Snapshot{snapshot}
+	for chain[0].Type == models.SnapshotTypeDiff {
+		if chain[0].ParentID == "" {
+			return "", models.ErrNoParentSnapshot
+		}
+		parent, err := m.snapshots.Get(chain[0].ParentID)
+		if err != nil {
+			return "", fmt.Errorf("snapshot chain is broken at %s: %w", chain[0].ParentID, err)
+		}
+		chain = append([]*models.Snapshot{parent}, chain...)
+	}
+
+	out := filepath.Join(filepath.Dir(snapshot.MemFilePath), snapshotRestoredMem)
+	if err := copyFile(chain[0].MemFilePath, out); err != nil {
+		return "", err
+	}
+
+	for _, diff := range chain[1:] {
+		if err := overlaySparse(diff.MemFilePath, out); err != nil {
+			return "", err
+		}
+	}
+
+	return out, nil
+}
+
+// recordDrives records the size and modification time of a VM's drives
+func recordDrives(cfg *models.VMConfig) ([]models.SnapshotDrive, error) {
+	var drives []models.SnapshotDrive
+	for _, path := range drivePaths(cfg) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat drive: %w", err)
+		}
+		drives = append(drives, models.SnapshotDrive{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+	}
+	return drives, nil
+}
+
+// checkDrives makes sure the drives a snapshot was taken with have not
+// changed since. Snapshots taken before drives were recorded are not checked.
+func checkDrives(drives []models.SnapshotDrive) error {
+	for _, drive := range drives {
+		info, err := os.Stat(drive.Path)
+		if err != nil || info.Size() != drive.Size || !info.ModTime().Equal(drive.ModTime) {
+			return fmt.Errorf("%w: %s", models.ErrSnapshotDriveChanged, drive.Path)
+		}
+	}
+	return nil
+}
+
+// deleteSnapshots removes all snapshot records and files of a VM
+func (m *Manager) deleteSnapshots(id string) error {
+	snapshots, err := m.snapshots.ListByVM(id)
+	if err != nil {
+		return err
+	}
+	for _, snapshot := range snapshots {
+		if err := m.snapshots.Delete(snapshot.ID); err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(filepath.Join(m.dataDir, "snapshots", id))
+}
+
+// snapshotDir returns the directory holding the files of a snapshot
+func (m *Manager) snapshotDir(vmID, snapshotID string) string {
+	return filepath.Join(m.dataDir, "snapshots", vmID, snapshotID)
+}
+
+// withSnapshotType selects the Firecracker snapshot type for CreateSnapshot
+func withSnapshotType(snapshotType models.SnapshotType) firecracker.CreateSnapshotOpt {
+	return func(params *ops.CreateSnapshotParams) {
+		if snapshotType == models.SnapshotTypeDiff {
+			params.Body.SnapshotType = fcmodels.SnapshotCreateParamsSnapshotTypeDiff
+		} else {
+			params.Body.SnapshotType = fcmodels.SnapshotCreateParamsSnapshotTypeFull
+		}
+	}
+}
+
+// diskUsage returns the bytes actually allocated to a file, which for sparse
+// diff memory files is far less than the apparent size
+func diskUsage(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return st.Blocks * 512
+	}
+	return info.Size()
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// overlaySparse writes every data region of the sparse file src onto dst at
+// the same offsets, leaving dst untouched where src has holes
+func overlaySparse(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	var offset int64
+	for {
+		start, err := in.Seek(offset, seekData)
+		if errors.Is(err, syscall.ENXIO) {
+			// No data past offset
+			break
+		}
+		if err != nil {
+			out.Close()
+			return err
+		}
+		end, err := in.Seek(start, seekHole)
+		if err != nil {
+			out.Close()
+			return err
+		}
+
+		if _, err := in.Seek(start, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+		if _, err := out.Seek(start, io.SeekStart); err != nil {
+			out.Close()
+			return err
+		}
+		if _, err := io.CopyN(out, in, end-start); err != nil {
+			out.Close()
+			return err
+		}
+		offset = end
+	}
+
+	return out.Close()
+}
@@ -0,0 +1,168 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+func TestOverlaySparse(t *testing.T) {
+	const pageSize = 4096
+	dir := t.TempDir()
+
+	base := filepath.Join(dir, "base")
+	if err := os.WriteFile(base, bytes.Repeat([]byte{'a'}, 4*pageSize), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A diff memory file only holds dirty pages; everything else is a hole
+	diff := filepath.Join(dir, "diff")
+	f, err := os.Create(diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(4 * pageSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(bytes.Repeat([]byte{'b'}, pageSize), 2*pageSize); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	out := filepath.Join(dir, "out")
+	if err := copyFile(base, out); err != nil {
+		t.Fatalf("copyFile failed: %v", err)
+	}
+	if err := overlaySparse(diff, out); err != nil {
+		t.Fatalf("overlaySparse failed: %v", err)
+	}
+
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := bytes.Repeat([]byte{'a'}, 4*pageSize)
+	copy(want[2*pageSize:], bytes.Repeat([]byte{'b'}, pageSize))
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected only the dirty page to be overlaid")
+	}
+}
+
+func TestSnapshotLineage(t *testing.T) {
+	dir, err := os.MkdirTemp("", "agni")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := storage.NewStore(filepath.Join(dir, "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	m := NewManager(store)
+
+	vm := &models.VM{ID: "vm", Status: models.VMStatusRunning, Config: models.VMConfig{TrackDirtyPages: true}}
+	if err := m.store.Create(vm); err != nil {
+		t.Fatal(err)
+	}
+	// Left behind by an earlier boot
+	if err := m.snapshots.Create(&models.Snapshot{ID: "old", VMID: vm.ID, Type: models.SnapshotTypeFull}); err != nil {
+		t.Fatal(err)
+	}
+
+	socketPath := filepath.Join(dir, "fc.sock")
+	fakeFirecracker(t, socketPath, "Running")
+	boot := func() {
+		machine, err := firecracker.NewMachine(context.Background(), firecracker.Config{SocketPath: socketPath})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.runningVMs[vm.ID] = &RunningVM{Machine: machine}
+	}
+	snapshot := func(snapshotType models.SnapshotType) *models.Snapshot {
+		t.Helper()
+		s, err := m.CreateSnapshot(vm.ID, snapshotType)
+		if err != nil {
+			t.Fatalf("CreateSnapshot(%s) error = %v", snapshotType, err)
+		}
+		return s
+	}
+
+	// The dirty page bitmap does not reach back into an earlier boot
+	boot()
+	if _, err := m.CreateSnapshot(vm.ID, models.SnapshotTypeDiff); err != models.ErrNoParentSnapshot {
+		t.Errorf("CreateSnapshot(diff) without a base error = %v, want %v", err, models.ErrNoParentSnapshot)
+	}
+
+	full := snapshot(models.SnapshotTypeFull)
+	first := snapshot(models.SnapshotTypeDiff)
+	second := snapshot(models.SnapshotTypeDiff)
+	if first.ParentID != full.ID || second.ParentID != first.ID {
+		t.Errorf("diff parents = %s, %s, want %s, %s", first.ParentID, second.ParentID, full.ID, first.ID)
+	}
+
+	// After restoring the old snapshot, diffs go on top of it, not the newest one
+	boot()
+	m.runningVMs[vm.ID].lastSnapshotID = "old"
+	if diff := snapshot(models.SnapshotTypeDiff); diff.ParentID != "old" {
+		t.Errorf("diff parent after restore = %s, want old", diff.ParentID)
+	}
+}
+
+func TestSnapshotDrives(t *testing.T) {
+	dir := t.TempDir()
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	if err := os.WriteFile(rootfs, []byte("before"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	drives, err := recordDrives(&models.VMConfig{RootDrive: models.Drive{Path: rootfs}})
+	if err != nil || len(drives) != 1 || drives[0].Path != rootfs || drives[0].Size != 6 {
+		t.Fatalf("recordDrives() = %+v, %v", drives, err)
+	}
+	if err := checkDrives(drives); err != nil {
+		t.Errorf("checkDrives() of unchanged drives error = %v", err)
+	}
+
+	// Same size, but written to since
+	if err := os.WriteFile(rootfs, []byte("after!"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := drives[0].ModTime.Add(time.Second)
+	if err := os.Chtimes(rootfs, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDrives(drives); !errors.Is(err, models.ErrSnapshotDriveChanged) {
+		t.Errorf("checkDrives() of a changed drive error = %v, want %v", err, models.ErrSnapshotDriveChanged)
+	}
+
+	if err := os.Remove(rootfs); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkDrives(drives); !errors.Is(err, models.ErrSnapshotDriveChanged) {
+		t.Errorf("checkDrives() of a missing drive error = %v, want %v", err, models.ErrSnapshotDriveChanged)
+	}
+}
@@ -0,0 +1,542 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package webhook POSTs VM lifecycle events to the endpoints admins
+// register. Payloads are signed with HMAC-SHA256, failed deliveries are
+// retried with backoff and every delivery is recorded.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/logging"
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Headers sent with every delivery
+const (
+	SignatureHeader = "X-Agni-Signature-256" // sha256=<hex HMAC of timestamp.body>
+	TimestampHeader = "X-Agni-Timestamp"     // Unix seconds the request was signed at
+	EventHeader     = "X-Agni-Event"
+	DeliveryHeader  = "X-Agni-Delivery"
+)
+
+const (
+	DefaultMaxAttempts    = 6
+	DefaultInitialBackoff = 10 * time.Second
+	DefaultMaxBackoff     = 10 * time.Minute
+
+	requestTimeout    = 10 * time.Second
+	maxConcurrent     = 16 // Requests in flight across all webhooks
+	deliveryRetention = 30 * 24 * time.Hour
+	pruneInterval     = time.Hour
+	dispatchRetry     = 5 * time.Second // Before dispatching an event that failed to record again
+
+	// cursorKey holds the sequence number of the last dispatched event
+	cursorKey = "webhook_cursor"
+)
+
+// Config holds the retry policy
+type Config struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration // Doubles after every failed attempt
+	MaxBackoff     time.Duration
+}
+
+// DefaultConfig returns the default retry policy
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts:    DefaultMaxAttempts,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// Dispatcher manages webhooks and delivers events to them
+type Dispatcher struct {
+	config     Config
+	store      *storage.Store
+	webhooks   *storage.WebhookStore
+	deliveries *storage.DeliveryStore
+	bus        *vm.EventBus
+	client     *http.Client
+	slots      chan struct{}
+	cursor     uint64          // Only touched by the event loop
+	dispatched map[string]bool // Webhooks the event after the cursor was recorded for, ditto
+	logger     *logging.Logger
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex // Guards stopped against wg.Add racing Stop's wg.Wait
+	stopped bool
+}
+
+// NewDispatcher creates a new Dispatcher for the events on bus. Nothing is
+// delivered until Start.
+func NewDispatcher(store *storage.Store, bus *vm.EventBus, cfg Config) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		config:     cfg,
+		store:      store,
+		webhooks:   storage.NewWebhookStore(store),
+		deliveries: storage.NewDeliveryStore(store),
+		bus:        bus,
+		client:     &http.Client{Timeout: requestTimeout},
+		slots:      make(chan struct{}, maxConcurrent),
+		dispatched: make(map[string]bool),
+		logger:     logging.GetLogger().WithComponent("webhooks"),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+}
+
+// Sign returns the signature of a payload sent at timestamp, as sent in
+// SignatureHeader. The timestamp is signed along with the body so receivers
+// can reject replayed requests.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Start resumes deliveries interrupted by a restart and starts delivering
+// events. Events published while the daemon was down, such as VMs found
+// dead on reconcile, are picked up from where the last run stopped.
+func (d *Dispatcher) Start() error {
+	pending, err := d.deliveries.ListPending()
+	if err != nil {
+		return fmt.Errorf("failed to load pending deliveries: %w", err)
+	}
+	for _, delivery := range pending {
+		d.schedule(delivery)
+	}
+
+	var sub *vm.EventSubscriber
+	var backlog []*models.Event
+	if err := d.store.Get(storage.BucketSettings, cursorKey, &d.cursor); err != nil {
+		// First run, past events are not replayed
+		sub = d.bus.Subscribe()
+	} else if sub, backlog, err = d.bus.Resume(d.cursor); err != nil {
+		return fmt.Errorf("failed to read events: %w", err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		d.bus.Unsubscribe(sub)
+		return nil
+	}
+	d.wg.Add(2)
+	go d.run(sub, backlog)
+	go d.prune()
+	return nil
+}
+
+// Stop stops delivering. Deliveries still waiting for a retry, or recorded
+// after Stop, are resumed by the next Start.
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	d.mu.Unlock()
+
+	d.cancel()
+	d.wg.Wait()
+}
+
+// run dispatches events until the dispatcher stops
+func (d *Dispatcher) run(sub *vm.EventSubscriber, backlog []*models.Event) {
+	defer d.wg.Done()
+	defer func() { d.bus.Unsubscribe(sub) }()
+
+	for {
+		// Events are dispatched in order, one that fails holds up the rest
+		for len(backlog) > 0 {
+			if err := d.dispatch(backlog[0]); err != nil {
+				d.logger.Error().Err(err).Uint64("sequence", backlog[0].Sequence).Msg("Failed to dispatch event, retrying")
+				select {
+				case <-d.ctx.Done():
+					return
+				case <-time.After(dispatchRetry):
+				}
+				continue
+			}
+			backlog = backlog[1:]
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case event, ok := <-sub.Channel:
+			if ok {
+				backlog = append(backlog, event)
+				continue
+			}
+			// Fell behind, catch up from the stored events. A closed bus means
+			// the daemon is shutting down; the next run picks up from the cursor.
+			var err error
+			sub, backlog, err = d.bus.Resume(d.cursor)
+			switch {
+			case err == models.ErrEventBusClosed:
+				return
+			case err != nil:
+				d.logger.Error().Err(err).Msg("Failed to resume events, some were not delivered")
+				sub = d.bus.Subscribe()
+			}
+		}
+	}
+}
+
+// dispatch creates a delivery of an event for every webhook that wants it,
+// then moves the cursor past the event. If a delivery fails to record the
+// cursor stays put, and dispatching the event again only records the
+// deliveries still missing.
+func (d *Dispatcher) dispatch(event *models.Event) error {
+	webhooks, err := d.webhooks.List()
+	if err != nil {
+		return fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) || d.dispatched[webhook.ID] {
+			continue
+		}
+		if _, err := d.enqueue(webhook.ID, *event, ""); err != nil {
+			return fmt.Errorf("failed to record delivery for webhook %s: %w", webhook.ID, err)
+		}
+		d.dispatched[webhook.ID] = true
+	}
+
+	d.cursor = event.Sequence
+	clear(d.dispatched)
+	if err := d.store.Put(storage.BucketSettings, cursorKey, d.cursor); err != nil {
+		d.logger.Warn().Err(err).Msg("Failed to save webhook cursor")
+	}
+	return nil
+}
+
+// enqueue records a new delivery and schedules its first attempt
+func (d *Dispatcher) enqueue(webhookID string, event models.Event, redeliveryOf string) (*models.WebhookDelivery, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	delivery := &models.WebhookDelivery{
+		ID:            id.String(),
+		WebhookID:     webhookID,
+		Event:         event,
+		Status:        models.DeliveryPending,
+		RedeliveryOf:  redeliveryOf,
+		NextAttemptAt: &now,
+	}
+	if err := d.deliveries.Put(delivery); err != nil {
+		return nil, err
+	}
+
+	d.schedule(delivery)
+	return delivery, nil
+}
+
+// schedule makes a delivery's remaining attempts in the background. Once
+// the dispatcher is stopped the delivery is left pending for the next run.
+func (d *Dispatcher) schedule(delivery *models.WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped {
+		return
+	}
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(delivery)
+	}()
+}
+
+// deliver attempts a delivery until it succeeds or runs out of attempts. A
+// delivery interrupted by Stop stays pending.
+func (d *Dispatcher) deliver(delivery *models.WebhookDelivery) {
+	for {
+		if delivery.NextAttemptAt != nil {
+			if wait := time.Until(*delivery.NextAttemptAt); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-d.ctx.Done():
+					timer.Stop()
+					return
+				}
+			}
+		}
+
+		// The log goes away with its webhook
+		webhook, err := d.webhooks.Get(delivery.WebhookID)
+		if err != nil {
+			return
+		}
+
+		if webhook.Enabled {
+			delivery.ResponseCode, err = d.attempt(webhook, delivery)
+			if err != nil && d.ctx.Err() != nil {
+				return
+			}
+			delivery.Attempts++
+		} else {
+			err = fmt.Errorf("webhook is disabled")
+		}
+
+		delivery.Error = ""
+		delivery.NextAttemptAt = nil
+		switch {
+		case err == nil:
+			delivery.Status = models.DeliverySucceeded
+		case !webhook.Enabled || delivery.Attempts >= d.config.MaxAttempts:
+			delivery.Status = models.DeliveryFailed
+			delivery.Error = err.Error()
+			d.logger.Warn().Err(err).Str("webhook_id", webhook.ID).Str("delivery_id", delivery.ID).
+				Int("attempts", delivery.Attempts).Msg("Webhook delivery failed")
+		default:
+			delivery.Error = err.Error()
+			next := time.Now().Add(d.backoff(delivery.Attempts))
+			delivery.NextAttemptAt = &next
+		}
+
+		if err := d.deliveries.Put(delivery); err != nil {
+			d.logger.Error().Err(err).Str("delivery_id", delivery.ID).Msg("Failed to update delivery")
+		}
+		if delivery.Status != models.DeliveryPending {
+			return
+		}
+	}
+}
+
+// attempt POSTs a delivery's event once and returns the response status
+func (d *Dispatcher) attempt(webhook *models.Webhook, delivery *models.WebhookDelivery) (int, error) {
+	select {
+	case d.slots <- struct{}{}:
+		defer func() { <-d.slots }()
+	case <-d.ctx.Done():
+		return 0, d.ctx.Err()
+	}
+
+	payload, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "agni-webhook")
+	req.Header.Set(EventHeader, string(delivery.Event.Type))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay after a number of failed attempts
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.InitialBackoff
+	for i := 1; i < attempts && delay < d.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.config.MaxBackoff {
+		delay = d.config.MaxBackoff
+	}
+	return delay
+}
+
+// prune drops old finished deliveries from the log
+func (d *Dispatcher) prune() {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if removed, err := d.deliveries.Prune(time.Now().Add(-deliveryRetention)); err != nil {
+			d.logger.Warn().Err(err).Msg("Failed to prune webhook deliveries")
+		} else if removed > 0 {
+			d.logger.Debug().Int("removed", removed).Msg("Pruned webhook deliveries")
+		}
+
+		select {
+		case <-ticker.C:
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+// Create registers a webhook, generating a secret when none is given
+func (d *Dispatcher) Create(req models.CreateWebhookRequest, createdBy string) (*models.Webhook, error) {
+	if err := validate(req.Name, req.URL, req.Events); err != nil {
+		return nil, err
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		if secret, err = generateSecret(); err != nil {
+			return nil, err
+		}
+	}
+
+	webhook := &models.Webhook{
+		ID:        uuid.New().String(),
+		Name:      req.Name,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    secret,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+		CreatedBy: createdBy,
+	}
+	if err := d.webhooks.Create(webhook); err != nil {
+		return nil, err
+	}
+
+	d.logger.Info().Str("webhook_id", webhook.ID).Str("url", webhook.URL).Msg("Webhook registered")
+	return webhook, nil
+}
+
+// Get returns a webhook
+func (d *Dispatcher) Get(id string) (*models.Webhook, error) {
+	return d.webhooks.Get(id)
+}
+
+// List returns all webhooks
+func (d *Dispatcher) List() ([]*models.Webhook, error) {
+	return d.webhooks.List()
+}
+
+// Update changes the given fields of a webhook
+func (d *Dispatcher) Update(id string, req models.UpdateWebhookRequest) (*models.Webhook, error) {
+	webhook, err := d.webhooks.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		webhook.Name = *req.Name
+	}
+	if req.URL != nil {
+		webhook.URL = *req.URL
+	}
+	if req.Events != nil {
+		webhook.Events = *req.Events
+	}
+	if req.Secret != nil && *req.Secret != "" {
+		webhook.Secret = *req.Secret
+	}
+	if req.Enabled != nil {
+		webhook.Enabled = *req.Enabled
+	}
+	if err := validate(webhook.Name, webhook.URL, webhook.Events); err != nil {
+		return nil, err
+	}
+
+	if err := d.webhooks.Update(webhook); err != nil {
+		return nil, err
+	}
+	return webhook, nil
+}
+
+// Delete removes a webhook along with its delivery log
+func (d *Dispatcher) Delete(id string) error {
+	if err := d.webhooks.Delete(id); err != nil {
+		return err
+	}
+	d.logger.Info().Str("webhook_id", id).Msg("Webhook deleted")
+	return nil
+}
+
+// Deliveries returns up to limit of a webhook's deliveries, newest first
+func (d *Dispatcher) Deliveries(webhookID string, limit int) ([]*models.WebhookDelivery, error) {
+	if _, err := d.webhooks.Get(webhookID); err != nil {
+		return nil, err
+	}
+	return d.deliveries.ListByWebhook(webhookID, limit)
+}
+
+// Redeliver sends the event of a past delivery again, as a new delivery
+// with its own retries
+func (d *Dispatcher) Redeliver(webhookID, deliveryID string) (*models.WebhookDelivery, error) {
+	if _, err := d.webhooks.Get(webhookID); err != nil {
+		return nil, err
+	}
+	original, err := d.deliveries.Get(deliveryID)
+	if err != nil || original.WebhookID != webhookID {
+		return nil, models.ErrDeliveryNotFound
+	}
+	return d.enqueue(webhookID, original.Event, original.ID)
+}
+
+// validate checks a webhook's name, URL and event filter
+func validate(name, rawURL string, events []models.EventType) error {
+	if name == "" {
+		return models.ErrInvalidWebhook
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return models.ErrInvalidWebhook
+	}
+	for _, t := range events {
+		if !t.Valid() {
+			return models.ErrInvalidWebhook
+		}
+	}
+	return nil
+}
+
+// generateSecret returns a random signing secret
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
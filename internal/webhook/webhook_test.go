@@ -0,0 +1,255 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anubhavg-icpl/agni/internal/storage"
+	"github.com/anubhavg-icpl/agni/internal/vm"
+	"github.com/anubhavg-icpl/agni/pkg/models"
+	bolt "go.etcd.io/bbolt"
+)
+
+// waitForDelivery polls a webhook's newest delivery until it is finished
+func waitForDelivery(t *testing.T, d *Dispatcher, webhookID string) *models.WebhookDelivery {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		deliveries, err := d.Deliveries(webhookID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) == 1 && deliveries[0].Status != models.DeliveryPending {
+			return deliveries[0]
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no finished delivery for webhook %s", webhookID)
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	// The receiver fails the first request and checks every signature
+	var requests atomic.Int32
+	received := make(chan models.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(TimestampHeader)
+		if sent, err := strconv.ParseInt(timestamp, 10, 64); err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+			t.Errorf("timestamp = %q, want the current time", timestamp)
+		}
+		if got := r.Header.Get(SignatureHeader); got != Sign("s3cret", timestamp, body) {
+			t.Errorf("signature = %q, want %q", got, Sign("s3cret", timestamp, body))
+		}
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var event models.Event
+		if err := json.Unmarshal(body, &event); err != nil || r.Header.Get(EventHeader) != string(event.Type) {
+			t.Errorf("payload = %s, event header = %q", body, r.Header.Get(EventHeader))
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	bus := vm.NewEventBus(store)
+	d := NewDispatcher(store, bus, Config{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+
+	if _, err := d.Create(models.CreateWebhookRequest{Name: "bad", URL: "ftp://example.com"}, "admin"); err != models.ErrInvalidWebhook {
+		t.Errorf("Create() with an ftp URL error = %v, want %v", err, models.ErrInvalidWebhook)
+	}
+	if _, err := d.Create(models.CreateWebhookRequest{Name: "bad", URL: receiver.URL, Events: []models.EventType{"exploded"}}, "admin"); err != models.ErrInvalidWebhook {
+		t.Errorf("Create() with an unknown event error = %v, want %v", err, models.ErrInvalidWebhook)
+	}
+
+	hook, err := d.Create(models.CreateWebhookRequest{
+		Name:   "crashes",
+		URL:    receiver.URL,
+		Events: []models.EventType{models.EventCrashed},
+		Secret: "s3cret",
+	}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := d.Create(models.CreateWebhookRequest{Name: "broken", URL: broken.URL}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failing.Secret == "" {
+		t.Error("Create() did not generate a secret")
+	}
+
+	// Only the crash passes the filter, and is delivered on the second attempt
+	bus.Publish(&models.Event{Type: models.EventRunning, VMID: "vm-1"})
+	bus.Publish(&models.Event{Type: models.EventCrashed, VMID: "vm-1", Message: "oops"})
+
+	delivery := waitForDelivery(t, d, hook.ID)
+	if delivery.Status != models.DeliverySucceeded || delivery.Attempts != 2 || delivery.ResponseCode != http.StatusOK {
+		t.Errorf("delivery = %+v, want succeeded after 2 attempts", delivery)
+	}
+	if event := <-received; event.Type != models.EventCrashed || event.Message != "oops" {
+		t.Errorf("received event = %+v", event)
+	}
+
+	// An endpoint that keeps failing runs out of attempts
+	failed := waitForDelivery(t, d, failing.ID)
+	if failed.Status != models.DeliveryFailed || failed.Attempts != 3 || failed.ResponseCode != http.StatusBadGateway {
+		t.Errorf("delivery to a broken endpoint = %+v, want failed after 3 attempts", failed)
+	}
+
+	// A redelivery is logged as a new delivery of the same event
+	redelivery, err := d.Redeliver(hook.ID, delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivery.RedeliveryOf != delivery.ID || redelivery.Event.Sequence != delivery.Event.Sequence {
+		t.Errorf("Redeliver() = %+v", redelivery)
+	}
+	if got := waitForDelivery(t, d, hook.ID); got.ID != redelivery.ID || got.Status != models.DeliverySucceeded {
+		t.Errorf("redelivery = %+v, want succeeded", got)
+	}
+	if event := <-received; event.Sequence != delivery.Event.Sequence {
+		t.Errorf("redelivered event = %+v", event)
+	}
+
+	if _, err := d.Redeliver(hook.ID, failed.ID); err != models.ErrDeliveryNotFound {
+		t.Errorf("Redeliver() of another webhook's delivery error = %v, want %v", err, models.ErrDeliveryNotFound)
+	}
+
+	deliveries, err := d.Deliveries(hook.ID, 10)
+	if err != nil || len(deliveries) != 2 {
+		t.Errorf("Deliveries() = %d deliveries, %v, want 2", len(deliveries), err)
+	}
+}
+
+func TestRedeliverAfterStop(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	bus := vm.NewEventBus(store)
+	cfg := Config{MaxAttempts: 3, InitialBackoff: 10 * time.Millisecond, MaxBackoff: 20 * time.Millisecond}
+	d := NewDispatcher(store, bus, cfg)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	hook, err := d.Create(models.CreateWebhookRequest{Name: "hook", URL: receiver.URL}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(&models.Event{Type: models.EventCrashed, VMID: "vm-1"})
+	delivery := waitForDelivery(t, d, hook.ID)
+	d.Stop()
+
+	// A redelivery requested while stopping is recorded but not attempted
+	redelivery, err := d.Redeliver(hook.ID, delivery.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	deliveries, err := d.Deliveries(hook.ID, 1)
+	if err != nil || len(deliveries) != 1 || deliveries[0].ID != redelivery.ID || deliveries[0].Status != models.DeliveryPending {
+		t.Fatalf("Deliveries() after Stop = %+v, %v, want the redelivery pending", deliveries, err)
+	}
+
+	// The next dispatcher picks it up
+	next := NewDispatcher(store, bus, cfg)
+	if err := next.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer next.Stop()
+	if got := waitForDelivery(t, next, hook.ID); got.ID != redelivery.ID || got.Status != models.DeliverySucceeded {
+		t.Errorf("resumed redelivery = %+v, want succeeded", got)
+	}
+}
+
+func TestDispatchFailureKeepsCursor(t *testing.T) {
+	store, err := storage.NewStore(filepath.Join(t.TempDir(), "agni.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	d := NewDispatcher(store, vm.NewEventBus(store), DefaultConfig())
+	defer d.Stop()
+	first, err := d.Create(models.CreateWebhookRequest{Name: "first", URL: "http://127.0.0.1:1"}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Create(models.CreateWebhookRequest{Name: "second", URL: "http://127.0.0.1:1"}, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the deliveries bucket nothing can be recorded
+	if err := store.Transaction(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket(storage.BucketWebhookDeliveries)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	event := &models.Event{Sequence: 7, Type: models.EventCrashed, VMID: "vm-1"}
+	if err := d.dispatch(event); err == nil {
+		t.Fatal("dispatch() without a deliveries bucket succeeded")
+	}
+	if d.cursor != 0 {
+		t.Errorf("cursor after a failed dispatch = %d, want 0", d.cursor)
+	}
+
+	// The retry records one delivery per webhook and moves the cursor
+	if err := store.Transaction(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket(storage.BucketWebhookDeliveries)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	d.dispatched[first.ID] = true
+	if err := d.dispatch(event); err != nil {
+		t.Fatal(err)
+	}
+	if d.cursor != event.Sequence || len(d.dispatched) != 0 {
+		t.Errorf("cursor = %d, dispatched = %v after a dispatch, want %d and none", d.cursor, d.dispatched, event.Sequence)
+	}
+	if deliveries, err := d.Deliveries(first.ID, 10); err != nil || len(deliveries) != 0 {
+		t.Errorf("Deliveries() of a webhook already dispatched to = %d, %v, want none recorded again", len(deliveries), err)
+	}
+}
@@ -35,6 +35,11 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == buildRootfsCommand {
+		runBuildRootfs(os.Args[2:])
+		return
+	}
+
 	// Check for GUI mode flag before parsing other arguments
 	for _, arg := range os.Args[1:] {
 		if arg == "--gui" || arg == "-g" {
@@ -41,8 +41,8 @@ type options struct {
 	FcInitrd           string   `long:"initrd-path" description:"Path to initrd"`
 	FcRootDrivePath    string   `long:"root-drive" description:"Path to root disk image"`
 	FcRootPartUUID     string   `long:"root-partition" description:"Root partition UUID"`
-	FcAdditionalDrives []string `long:"add-drive" description:"Path to additional drive, suffixed with :ro or :rw, can be specified multiple times"`
-	FcNicConfig        []string `long:"tap-device" description:"NIC info, specified as DEVICE/MAC, can be specified multiple times"`
+	FcAdditionalDrives []string `long:"add-drive" description:"Path to additional drive, suffixed with :ro or :rw, optionally followed by ,bw=SIZE:REFILL_MS[:BURST] and ,ops=SIZE:REFILL_MS[:BURST] rate limits, can be specified multiple times"`
+	FcNicConfig        []string `long:"tap-device" description:"NIC info, specified as DEVICE/MAC, optionally followed by ,rx-bw= ,rx-ops= ,tx-bw= and ,tx-ops=SIZE:REFILL_MS[:BURST] rate limits, can be specified multiple times"`
 	FcVsockDevices     []string `long:"vsock-device" description:"Vsock interface, specified as PATH:CID. Multiple OK"`
 	FcLogFifo          string   `long:"vmm-log-fifo" description:"FIFO for firecracker logs"`
 	FcLogLevel         string   `long:"log-level" description:"vmm log level" default:"Debug"`
@@ -163,17 +163,24 @@ func (opts *options) getNetwork() ([]firecracker.NetworkInterface, error) {
 	var NICs []firecracker.NetworkInterface
 	if len(opts.FcNicConfig) > 0 {
 		for _, nicConfig := range opts.FcNicConfig {
+			nicConfig, limits := splitRateLimits(nicConfig)
 			tapDev, tapMacAddr, err := parseNicConfig(nicConfig)
 			if err != nil {
 				return nil, err
 			}
+			buckets, err := parseTokenBuckets(limits, "rx-bw", "rx-ops", "tx-bw", "tx-ops")
+			if err != nil {
+				return nil, err
+			}
 			allowMMDS := opts.validMetadata != nil
 			nic := firecracker.NetworkInterface{
 				StaticConfiguration: &firecracker.StaticNetworkConfiguration{
 					MacAddress:  tapMacAddr,
 					HostDevName: tapDev,
 				},
-				AllowMMDS: allowMMDS,
+				AllowMMDS:      allowMMDS,
+				InRateLimiter:  newRateLimiter(buckets["rx-bw"], buckets["rx-ops"]),
+				OutRateLimiter: newRateLimiter(buckets["tx-bw"], buckets["tx-ops"]),
 			}
 			NICs = append(NICs, nic)
 		}
@@ -297,6 +304,12 @@ func parseBlockDevices(entries []string) ([]models.Drive, error) {
 		path := ""
 		readOnly := true
 
+		entry, limits := splitDriveRateLimits(entry)
+		buckets, err := parseTokenBuckets(limits, "bw", "ops")
+		if err != nil {
+			return nil, err
+		}
+
 		if strings.HasSuffix(entry, rwDeviceSuffix) {
 			readOnly = false
 			path = strings.TrimSuffix(entry, rwDeviceSuffix)
@@ -320,6 +333,7 @@ func parseBlockDevices(entries []string) ([]models.Drive, error) {
 			PathOnHost:   firecracker.String(path),
 			IsReadOnly:   firecracker.Bool(readOnly),
 			IsRootDevice: firecracker.Bool(false),
+			RateLimiter:  newRateLimiter(buckets["bw"], buckets["ops"]),
 		}
 		devices = append(devices, e)
 	}
@@ -335,6 +349,81 @@ func parseNicConfig(cfg string) (string, string, error) {
 	return fields[0], fields[1], nil
 }
 
+// Given a string of the form SPEC,KEY=VALUE,... return SPEC and the rate limits
+func splitRateLimits(entry string) (string, string) {
+	if i := strings.Index(entry, ","); i >= 0 {
+		return entry[:i], entry[i+1:]
+	}
+	return entry, ""
+}
+
+// Like splitRateLimits, but only splits after the :ro or :rw suffix so drive
+// paths may contain commas
+func splitDriveRateLimits(entry string) (string, string) {
+	for _, suffix := range []string{rwDeviceSuffix, roDeviceSuffix} {
+		if i := strings.LastIndex(entry, suffix+","); i >= 0 {
+			return entry[:i+len(suffix)], entry[i+len(suffix)+1:]
+		}
+	}
+	return entry, ""
+}
+
+// Given a string of the form KEY=SIZE:REFILL_MS[:BURST],... return the token
+// buckets by key. Only the given keys are accepted.
+func parseTokenBuckets(limits string, keys ...string) (map[string]*models.TokenBucket, error) {
+	buckets := map[string]*models.TokenBucket{}
+	if limits == "" {
+		return buckets, nil
+	}
+
+	allowed := map[string]bool{}
+	for _, key := range keys {
+		allowed[key] = true
+	}
+
+	for _, limit := range strings.Split(limits, ",") {
+		key, value, ok := strings.Cut(limit, "=")
+		if !ok || !allowed[key] {
+			return nil, errInvalidRateLimiter
+		}
+
+		fields := strings.Split(value, ":")
+		if len(fields) != 2 && len(fields) != 3 {
+			return nil, errInvalidRateLimiter
+		}
+		var nums []int64
+		for _, field := range fields {
+			n, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || n < 0 {
+				return nil, errInvalidRateLimiter
+			}
+			nums = append(nums, n)
+		}
+
+		bucket := &models.TokenBucket{
+			Size:       firecracker.Int64(nums[0]),
+			RefillTime: firecracker.Int64(nums[1]),
+		}
+		if len(nums) == 3 {
+			bucket.OneTimeBurst = firecracker.Int64(nums[2])
+		}
+		buckets[key] = bucket
+	}
+	return buckets, nil
+}
+
+// newRateLimiter builds a rate limiter from optional buckets, or nil if both
+// are unset
+func newRateLimiter(bandwidth, ops *models.TokenBucket) *models.RateLimiter {
+	if bandwidth == nil && ops == nil {
+		return nil
+	}
+	return &models.RateLimiter{
+		Bandwidth: bandwidth,
+		Ops:       ops,
+	}
+}
+
 // Given a list of string representations of vsock devices,
 // return a corresponding slice of machine.VsockDevice objects
 func parseVsocks(devices []string) ([]firecracker.VsockDevice, error) {
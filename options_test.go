@@ -222,6 +222,14 @@ func TestParseBlockDevices(t *testing.T) {
 		IsReadOnly:   firecracker.Bool(false),
 		IsRootDevice: firecracker.Bool(false),
 	}
+	limitedDrive := validDrive
+	limitedDrive.RateLimiter = &models.RateLimiter{
+		Bandwidth: &models.TokenBucket{
+			Size:         firecracker.Int64(1048576),
+			RefillTime:   firecracker.Int64(1000),
+			OneTimeBurst: firecracker.Int64(4096),
+		},
+	}
 	cases := []struct {
 		name        string
 		in          []string
@@ -258,6 +266,22 @@ func TestParseBlockDevices(t *testing.T) {
 				return a == nil
 			},
 		},
+		{
+			name:      "valid drive with rate limit",
+			in:        []string{tempFile.Name() + rwDeviceSuffix + ",bw=1048576:1000:4096"},
+			outDrives: []models.Drive{limitedDrive},
+			expectedErr: func(a error) bool {
+				return a == nil
+			},
+		},
+		{
+			name:      "invalid drive rate limit",
+			in:        []string{tempFile.Name() + rwDeviceSuffix + ",bw=fast"},
+			outDrives: nil,
+			expectedErr: func(a error) bool {
+				return a == errInvalidRateLimiter
+			},
+		},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -340,6 +364,73 @@ func TestParseNicConfig(t *testing.T) {
 	}
 }
 
+func TestParseTokenBuckets(t *testing.T) {
+	cases := []struct {
+		name       string
+		in         string
+		outBuckets map[string]*models.TokenBucket
+		outError   error
+	}{
+		{
+			name:       "no limits",
+			in:         "",
+			outBuckets: map[string]*models.TokenBucket{},
+			outError:   nil,
+		},
+		{
+			name: "size and refill",
+			in:   "rx-bw=100:10,tx-ops=5:1000:20",
+			outBuckets: map[string]*models.TokenBucket{
+				"rx-bw": {
+					Size:       firecracker.Int64(100),
+					RefillTime: firecracker.Int64(10),
+				},
+				"tx-ops": {
+					Size:         firecracker.Int64(5),
+					RefillTime:   firecracker.Int64(1000),
+					OneTimeBurst: firecracker.Int64(20),
+				},
+			},
+			outError: nil,
+		},
+		{
+			name:       "unknown key",
+			in:         "bw=100:10",
+			outBuckets: nil,
+			outError:   errInvalidRateLimiter,
+		},
+		{
+			name:       "missing refill",
+			in:         "rx-bw=100",
+			outBuckets: nil,
+			outError:   errInvalidRateLimiter,
+		},
+		{
+			name:       "negative size",
+			in:         "rx-bw=-1:10",
+			outBuckets: nil,
+			outError:   errInvalidRateLimiter,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			buckets, err := parseTokenBuckets(c.in, "rx-bw", "rx-ops", "tx-bw", "tx-ops")
+			if !reflect.DeepEqual(buckets, c.outBuckets) {
+				t.Errorf("expected %v but got %v for %s",
+					c.outBuckets,
+					buckets,
+					c.in)
+			}
+			if err != c.outError {
+				t.Errorf("expected error %s but got %s for input %s",
+					c.outError,
+					err,
+					c.in)
+			}
+		})
+	}
+}
+
 func TestParseVsocks(t *testing.T) {
 	cases := []struct {
 		name        string
@@ -32,13 +32,32 @@ type ComponentHealth struct {
 
 // SystemInfo represents system information
 type SystemInfo struct {
-	Version            string `json:"version"`
-	FirecrackerVersion string `json:"firecracker_version"`
-	GoVersion          string `json:"go_version"`
-	OS                 string `json:"os"`
-	Arch               string `json:"arch"`
-	NumCPU             int    `json:"num_cpu"`
-	TotalMemory        uint64 `json:"total_memory"`
+	Version            string         `json:"version"`
+	FirecrackerVersion string         `json:"firecracker_version"`
+	GoVersion          string         `json:"go_version"`
+	OS                 string         `json:"os"`
+	Arch               string         `json:"arch"`
+	NumCPU             int            `json:"num_cpu"`
+	TotalMemory        uint64         `json:"total_memory"`
+	Resources          *HostResources `json:"resources,omitempty"`
+}
+
+// HostResources reports the host's capacity for VMs. Allocatable applies
+// the overcommit ratios, committed is what running VMs were given and
+// available is what is left for VMs to start.
+type HostResources struct {
+	CPUs                int     `json:"cpus"`
+	MemoryMB            int64   `json:"memory_mb"`
+	CPUOvercommit       float64 `json:"cpu_overcommit"`
+	MemoryOvercommit    float64 `json:"memory_overcommit"`
+	ReservedMemoryMB    int64   `json:"reserved_memory_mb"`
+	AllocatableCPUs     int64   `json:"allocatable_cpus"`
+	AllocatableMemoryMB int64   `json:"allocatable_memory_mb"`
+	CommittedCPUs       int64   `json:"committed_cpus"`
+	CommittedMemoryMB   int64   `json:"committed_memory_mb"`
+	AvailableCPUs       int64   `json:"available_cpus"`
+	AvailableMemoryMB   int64   `json:"available_memory_mb"`
+	RunningVMs          int     `json:"running_vms"`
 }
 
 // PaginatedResponse wraps paginated results
@@ -52,14 +71,21 @@ type PaginatedResponse struct {
 
 // CreateVMRequest represents a request to create a new VM
 type CreateVMRequest struct {
-	Name   string   `json:"name"`
-	Config VMConfig `json:"config"`
+	Name      string            `json:"name"`
+	Config    VMConfig          `json:"config"`
+	Autostart bool              `json:"autostart,omitempty"`
+	BootOrder int               `json:"boot_order,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
 }
 
 // UpdateVMRequest represents a request to update a VM
 type UpdateVMRequest struct {
-	Name   string   `json:"name,omitempty"`
-	Config VMConfig `json:"config,omitempty"`
+	Name      string            `json:"name,omitempty"`
+	Config    VMConfig          `json:"config,omitempty"`
+	Autostart *bool             `json:"autostart,omitempty"`
+	BootOrder *int              `json:"boot_order,omitempty"`
+	OwnerID   string            `json:"owner_id,omitempty"` // Hands the VM to another user; admins only
+	Labels    map[string]string `json:"labels,omitempty"`   // Replaces all labels; {} removes them
 }
 
 // VMActionResponse represents a response to a VM action
@@ -69,11 +95,85 @@ type VMActionResponse struct {
 	VMID    string `json:"vm_id"`
 }
 
+// ShutdownVMRequest represents a request to shut down a VM gracefully
+type ShutdownVMRequest struct {
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"` // Grace period before a forced stop, default 30
+}
+
+// ShutdownVMResponse reports how a VM was shut down
+type ShutdownVMResponse struct {
+	VMActionResponse
+	Method     ShutdownMethod `json:"method"`
+	DurationMs int64          `json:"duration_ms"`
+}
+
+// BulkVMRequest selects the VMs a bulk action applies to by label
+type BulkVMRequest struct {
+	Selector       string `json:"selector"`                  // Required, e.g. env=staging,team!=infra
+	Concurrency    int    `json:"concurrency,omitempty"`     // VMs acted on at once; default and maximum: 8
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // Shutdown only: grace period shared by all VMs
+}
+
+// BulkVMResult is the outcome of a bulk action for a single VM
+type BulkVMResult struct {
+	VMID    string         `json:"vm_id"`
+	Name    string         `json:"name"`
+	Success bool           `json:"success"`
+	Error   string         `json:"error,omitempty"`
+	Method  ShutdownMethod `json:"method,omitempty"` // Shutdown only
+}
+
+// BulkVMResponse reports a bulk action per VM
+type BulkVMResponse struct {
+	Matched   int            `json:"matched"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+	Results   []BulkVMResult `json:"results"`
+}
+
+// CloneVMRequest represents a request to clone a stopped VM. Name is a
+// pattern where {name} is replaced by the source VM's name and {n} by the
+// number of the clone. Drives listed in SharedDrives ("1" is the root drive,
+// additional drives count up from "2") are attached read-only instead of
+// being copied.
+type CloneVMRequest struct {
+	Name         string   `json:"name,omitempty"`  // Default: {name}-clone, or {name}-clone-{n} for several
+	Count        int      `json:"count,omitempty"` // Default: 1
+	SharedDrives []string `json:"shared_drives,omitempty"`
+}
+
+// CreateSnapshotRequest represents a request to snapshot a running VM
+type CreateSnapshotRequest struct {
+	Type SnapshotType `json:"type,omitempty"` // full (default) or diff
+}
+
 // CreateConfigRequest represents a request to save a config template
 type CreateConfigRequest struct {
-	Name        string   `json:"name"`
-	Description string   `json:"description,omitempty"`
-	Config      VMConfig `json:"config"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Config      VMConfig          `json:"config"`
+}
+
+// UpdateRateLimitersRequest changes device rate limiters. Drives are keyed by
+// drive ID ("1" is the root drive), NICs by host device name. A limiter
+// replaces the current one; an empty limiter removes it.
+type UpdateRateLimitersRequest struct {
+	Drives map[string]*RateLimiter    `json:"drives,omitempty"`
+	NICs   map[string]NICRateLimiters `json:"nics,omitempty"`
+}
+
+// NICRateLimiters holds the receive and transmit limiters of a NIC
+type NICRateLimiters struct {
+	Rx *RateLimiter `json:"rx_rate_limiter,omitempty"`
+	Tx *RateLimiter `json:"tx_rate_limiter,omitempty"`
+}
+
+// UpdateBalloonRequest resizes a VM's balloon or changes how often it
+// reports statistics. Omitted fields are left unchanged.
+type UpdateBalloonRequest struct {
+	AmountMib             *int64 `json:"amount_mib,omitempty"`
+	StatsPollingIntervalS *int64 `json:"stats_polling_interval_s,omitempty"`
 }
 
 // LogEntry represents a log entry from a VM
@@ -89,3 +189,12 @@ type WebSocketMessage struct {
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
 }
+
+// ConsoleMessage is a control message sent by a console client as a text
+// frame. Binary frames carry raw terminal input instead.
+type ConsoleMessage struct {
+	Type string `json:"type"` // "input" or "resize"
+	Data string `json:"data,omitempty"`
+	Cols uint16 `json:"cols,omitempty"`
+	Rows uint16 `json:"rows,omitempty"`
+}
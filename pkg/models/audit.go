@@ -0,0 +1,111 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditResult is the outcome of an audited action
+type AuditResult string
+
+const (
+	AuditSuccess AuditResult = "success"
+	AuditFailure AuditResult = "failure"
+)
+
+// Audit actions of authentication events. Other actions are named after
+// the resource and route, such as vm.start.
+const (
+	AuditLogin          = "auth.login"
+	AuditSetup          = "auth.setup"
+	AuditPasswordChange = "auth.password"
+)
+
+// Audit actions of console sessions, which are recorded when a client
+// attaches to and detaches from a VM's serial console
+const (
+	AuditConsoleAttach = "console.attach"
+	AuditConsoleDetach = "console.detach"
+)
+
+// AuditUnknownUser is the username of requests rejected before the caller
+// was authenticated
+const AuditUnknownUser = "unknown"
+
+// AuditEntry records a mutating API request or an authentication event.
+// Entries are never changed or removed once written.
+type AuditEntry struct {
+	Sequence  uint64        `json:"sequence"`
+	Timestamp time.Time     `json:"timestamp"`
+	UserID    string        `json:"user_id,omitempty"`
+	Username  string        `json:"username,omitempty"` // Attempted username for failed logins
+	Role      UserRole      `json:"role,omitempty"`
+	Action    string        `json:"action"`
+	Method    string        `json:"method,omitempty"`
+	Path      string        `json:"path,omitempty"`
+	TargetID  string        `json:"target_id,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+	SourceIP  string        `json:"source_ip,omitempty"`
+	Result    AuditResult   `json:"result"`
+	Status    int           `json:"status,omitempty"` // HTTP status of the response
+	Changes   []AuditChange `json:"changes,omitempty"`
+}
+
+// SetStatus records the HTTP status of the response and the result it means
+func (e *AuditEntry) SetStatus(status int) {
+	e.Status = status
+	e.Result = AuditSuccess
+	if status >= 400 {
+		e.Result = AuditFailure
+	}
+}
+
+// AuditChange is a field changed by an audited action. Nested fields are
+// named by their JSON path, such as config.vcpu_count.
+type AuditChange struct {
+	Field string          `json:"field"`
+	Old   json.RawMessage `json:"old,omitempty"`
+	New   json.RawMessage `json:"new,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	Since  time.Time
+	Until  time.Time
+	User   string // User ID or username
+	Action string
+}
+
+// Matches reports whether an entry passes the filter
+func (f AuditFilter) Matches(entry *AuditEntry) bool {
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Timestamp.After(f.Until) {
+		return false
+	}
+	if f.User != "" && f.User != entry.UserID && f.User != entry.Username {
+		return false
+	}
+	return f.Action == "" || f.Action == entry.Action
+}
+
+// AuditPage is a page of audit entries, newest first. Next is passed as
+// before to get the following page and is omitted on the last one.
+type AuditPage struct {
+	Data []*AuditEntry `json:"data"`
+	Next uint64        `json:"next,omitempty"`
+}
@@ -25,16 +25,81 @@ var (
 	ErrConflictingLogOpts                = errors.New("vmm-log-fifo and firecracker-log are mutually exclusive")
 	ErrUnableToCreateFifoLogFile         = errors.New("failed to create fifo log file")
 	ErrInvalidMetadata                   = errors.New("metadata is not valid JSON")
+	ErrInvalidRateLimiter                = errors.New("rate limiter sizes and refill times must not be negative")
+	ErrInvalidBalloon                    = errors.New("balloon size must be between 0 and the VM's memory and the polling interval must not be negative")
+	ErrInvalidRestartPolicy              = errors.New("restart policy must be never, on-failure or always, with non-negative limits")
+	ErrInvalidLabels                     = errors.New("label keys and values must be alphanumeric with . _ - inside, keys may contain /, at most 63 characters")
+	ErrInvalidSelector                   = errors.New("invalid label selector")
+	ErrInvalidJailerConfig               = errors.New("jailer ID must be 1 to 64 letters, digits or dashes, the UID and GID must be allowed by the host, and the jailer binary, exec file and chroot base directory must be the ones configured on the host")
 )
 
 // VM errors
 var (
-	ErrVMNotFound       = errors.New("VM not found")
-	ErrVMAlreadyExists  = errors.New("VM already exists")
-	ErrVMNotRunning     = errors.New("VM is not running")
-	ErrVMAlreadyRunning = errors.New("VM is already running")
-	ErrVMStartFailed    = errors.New("failed to start VM")
-	ErrVMStopFailed     = errors.New("failed to stop VM")
+	ErrVMNotFound            = errors.New("VM not found")
+	ErrVMAlreadyExists       = errors.New("VM already exists")
+	ErrVMNotRunning          = errors.New("VM is not running")
+	ErrVMAlreadyRunning      = errors.New("VM is already running")
+	ErrVMStartFailed         = errors.New("failed to start VM")
+	ErrVMStopFailed          = errors.New("failed to stop VM")
+	ErrInvalidTransition     = errors.New("invalid VM status transition")
+	ErrConsoleNotFound       = errors.New("VM has no console attached")
+	ErrDriveNotFound         = errors.New("drive not found")
+	ErrNICNotFound           = errors.New("network interface not found")
+	ErrInvalidCloneCount     = errors.New("clone count must be between 1 and 32")
+	ErrInsufficientResources = errors.New("not enough host resources to start the VM")
+	ErrQuotaExceeded         = errors.New("quota exceeded")
+	ErrJailerIDInUse         = errors.New("jailer ID is already used by another VM")
+)
+
+// Balloon errors
+var (
+	ErrBalloonNotConfigured = errors.New("VM has no balloon device")
+	ErrBalloonStatsDisabled = errors.New("balloon statistics are disabled")
+	ErrBalloonStatsToggle   = errors.New("balloon statistics cannot be turned on or off while the VM is running")
+)
+
+// Network errors
+var (
+	ErrNetworkNotConfigured = errors.New("managed networking is not configured")
+	ErrInvalidSubnet        = errors.New("subnet must be an IPv4 CIDR with room for a gateway and guests")
+	ErrAddressPoolExhausted = errors.New("no free addresses left in the subnet")
+	ErrInvalidCNIConfig     = errors.New("a CNI interface needs a network name, must be the VM's only interface and rules out an ip= kernel argument")
+	ErrManagedNICDevice     = errors.New("managed NICs get a tap device named by agni and cannot name their own")
+)
+
+// Event errors
+var (
+	ErrEventBusClosed = errors.New("event bus is closed")
+)
+
+// Snapshot errors
+var (
+	ErrSnapshotNotFound     = errors.New("snapshot not found")
+	ErrInvalidSnapshotType  = errors.New("snapshot type must be full or diff")
+	ErrNoParentSnapshot     = errors.New("diff snapshot requires a full or diff snapshot taken or restored since the VM started")
+	ErrDirtyPagesNotTracked = errors.New("diff snapshots require track_dirty_pages in the VM config")
+	ErrSnapshotJailed       = errors.New("snapshots are not supported for jailed VMs")
+	ErrSnapshotInProgress   = errors.New("a snapshot of the VM is being taken")
+	ErrSnapshotDriveChanged = errors.New("a drive changed since the snapshot was taken, restoring it would corrupt the guest's filesystem")
+)
+
+// Image errors
+var (
+	ErrImageNotFound         = errors.New("image not found")
+	ErrInvalidImage          = errors.New("an image needs a name, a type of kernel, initrd or rootfs, an arch of x86_64 or aarch64 and a regular file")
+	ErrImageTypeMismatch     = errors.New("image has the wrong type for where it is referenced")
+	ErrImageArchMismatch     = errors.New("image architecture does not match the host")
+	ErrImageChecksumMismatch = errors.New("image file does not match its SHA-256 checksum")
+	ErrImageInUse            = errors.New("image is referenced by VMs")
+	ErrInvalidImageArchive   = errors.New("not a valid docker save or OCI layout archive")
+	ErrRootfsNoShell         = errors.New("agni-init needs /bin/sh in the image")
+)
+
+// Webhook errors
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrInvalidWebhook   = errors.New("a webhook needs a name, an http or https URL and known event types")
 )
 
 // Auth errors
@@ -46,12 +111,15 @@ var (
 	ErrUnauthorized       = errors.New("unauthorized")
 	ErrSetupRequired      = errors.New("initial setup required")
 	ErrSetupAlreadyDone   = errors.New("setup already completed")
+	ErrInvalidQuota       = errors.New("quota limits must not be negative")
+	ErrInvalidRole        = errors.New("role must be admin or user")
 )
 
 // Storage errors
 var (
 	ErrDatabaseNotInitialized = errors.New("database not initialized")
 	ErrConfigNotFound         = errors.New("configuration not found")
+	ErrInvalidSort            = errors.New("unsupported sort field")
 )
 
 // APIError represents an API error response
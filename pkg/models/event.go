@@ -0,0 +1,59 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package models
+
+import (
+	"time"
+)
+
+// EventType identifies a VM lifecycle event
+type EventType string
+
+const (
+	EventCreated       EventType = "created"
+	EventStarting      EventType = "starting"
+	EventRunning       EventType = "running"
+	EventStopped       EventType = "stopped"
+	EventCrashed       EventType = "crashed"
+	EventDeleted       EventType = "deleted"
+	EventConfigChanged EventType = "config-changed"
+)
+
+// Valid reports whether t is a known event type
+func (t EventType) Valid() bool {
+	switch t {
+	case EventCreated, EventStarting, EventRunning, EventStopped, EventCrashed, EventDeleted, EventConfigChanged:
+		return true
+	}
+	return false
+}
+
+// ActorSystem is the actor of events the daemon caused on its own, such as
+// crashes, automatic restarts and reconciliation
+const ActorSystem = "system"
+
+// Event is a VM lifecycle event. Sequence numbers increase monotonically
+// across daemon restarts, so a client can resume after the last one it saw.
+type Event struct {
+	Sequence  uint64    `json:"sequence"`
+	Type      EventType `json:"type"`
+	VMID      string    `json:"vm_id"`
+	VMName    string    `json:"vm_name"`
+	OwnerID   string    `json:"owner_id,omitempty"`
+	Actor     string    `json:"actor"`
+	OldStatus VMStatus  `json:"old_status,omitempty"`
+	NewStatus VMStatus  `json:"new_status,omitempty"`
+	Message   string    `json:"message,omitempty"` // Error of a crashed VM
+	Timestamp time.Time `json:"timestamp"`
+}
@@ -0,0 +1,78 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package models
+
+import (
+	"time"
+)
+
+// ImageType is the kind of file an image holds
+type ImageType string
+
+const (
+	ImageTypeKernel ImageType = "kernel"
+	ImageTypeInitrd ImageType = "initrd"
+	ImageTypeRootfs ImageType = "rootfs"
+)
+
+// Image is a kernel, initrd or root filesystem registered with agni. VM
+// configs can reference images by ID instead of a host path, and the file's
+// checksum is verified before every boot.
+type Image struct {
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Type        ImageType         `json:"type"`
+	Arch        string            `json:"arch,omitempty"` // x86_64 or aarch64, detected for ELF kernels
+	Path        string            `json:"path"`
+	SHA256      string            `json:"sha256"`
+	Size        int64             `json:"size"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// RegisterImageRequest represents a request to register an image file
+type RegisterImageRequest struct {
+	Name        string            `json:"name"`
+	Type        ImageType         `json:"type"`
+	Arch        string            `json:"arch,omitempty"`
+	Path        string            `json:"path"`
+	SHA256      string            `json:"sha256,omitempty"` // Checked against the file when given
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
+
+// BuildRootfsRequest represents a request to build a root filesystem image
+// from a container image tarball on the host and register it. With Init,
+// the image gets /sbin/agni-init, which runs the container's entrypoint;
+// boot it with init=/sbin/agni-init in the kernel arguments.
+type BuildRootfsRequest struct {
+	Name         string            `json:"name"`
+	Source       string            `json:"source"`              // docker save or OCI layout tarball
+	Reference    string            `json:"reference,omitempty"` // Image in the tarball; default: the first
+	Output       string            `json:"output,omitempty"`    // Default: the data directory
+	SizeMiB      int64             `json:"size_mib,omitempty"`  // Default: the contents plus headroom
+	Init         bool              `json:"init,omitempty"`
+	InitCommands []string          `json:"init_commands,omitempty"` // Run by agni-init before the entrypoint
+	Labels       map[string]string `json:"labels,omitempty"`
+	Description  string            `json:"description,omitempty"`
+}
+
+// UpdateImageRequest represents a request to update an image's metadata.
+// Labels replace the existing labels when given.
+type UpdateImageRequest struct {
+	Name        string            `json:"name,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Description string            `json:"description,omitempty"`
+}
@@ -34,6 +34,44 @@ type User struct {
 	CreatedAt    time.Time  `json:"created_at"`
 	UpdatedAt    time.Time  `json:"updated_at"`
 	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+	Quota        *UserQuota `json:"quota,omitempty"` // Nil means unlimited
+}
+
+// IsAdmin reports whether the user may see and manage everyone's resources
+func (u *User) IsAdmin() bool {
+	return u.Role == UserRoleAdmin
+}
+
+// UserQuota limits what a user's VMs may use. Zero means no limit. VMs and
+// disk count everything the user owns, vCPUs and memory only running VMs.
+type UserQuota struct {
+	MaxVMs      int   `json:"max_vms,omitempty"`
+	MaxCPUs     int64 `json:"max_cpus,omitempty"`
+	MaxMemoryMB int64 `json:"max_memory_mb,omitempty"`
+	MaxDiskMB   int64 `json:"max_disk_mb,omitempty"` // Apparent size of the VMs' drives, shared files counted once
+}
+
+// ResourceUsage is what a user's VMs use, counted the way quotas are
+type ResourceUsage struct {
+	VMs      int   `json:"vms"`
+	CPUs     int64 `json:"cpus"`
+	MemoryMB int64 `json:"memory_mb"`
+	DiskMB   int64 `json:"disk_mb"`
+}
+
+// QuotaStatus reports a user's quota next to their usage
+type QuotaStatus struct {
+	UserID string        `json:"user_id"`
+	Quota  *UserQuota    `json:"quota,omitempty"`
+	Usage  ResourceUsage `json:"usage"`
+}
+
+// CreateUserRequest represents a request to create a user account
+type CreateUserRequest struct {
+	Username string     `json:"username"`
+	Password string     `json:"password"`
+	Role     UserRole   `json:"role,omitempty"` // Default: user
+	Quota    *UserQuota `json:"quota,omitempty"`
 }
 
 // SafeUser returns a copy of the user without sensitive fields (for API responses)
@@ -45,6 +83,7 @@ func (u *User) SafeUser() User {
 		CreatedAt:   u.CreatedAt,
 		UpdatedAt:   u.UpdatedAt,
 		LastLoginAt: u.LastLoginAt,
+		Quota:       u.Quota,
 	}
 }
 
@@ -84,3 +123,9 @@ type SetupRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+// ChangePasswordRequest represents a request to change one's own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
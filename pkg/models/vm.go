@@ -25,60 +25,173 @@ const (
 	VMStatusStarting VMStatus = "starting"
 	VMStatusRunning  VMStatus = "running"
 	VMStatusStopping VMStatus = "stopping"
+	VMStatusPaused   VMStatus = "paused"
 	VMStatusError    VMStatus = "error"
 )
 
+// validTransitions lists the statuses a VM may move to from each status
+var validTransitions = map[VMStatus][]VMStatus{
+	VMStatusStopped:  {VMStatusStarting},
+	VMStatusStarting: {VMStatusRunning, VMStatusStopped, VMStatusError},
+	VMStatusRunning:  {VMStatusPaused, VMStatusStopping, VMStatusStopped, VMStatusError},
+	VMStatusPaused:   {VMStatusRunning, VMStatusStopping, VMStatusStopped, VMStatusError},
+	VMStatusStopping: {VMStatusStopped, VMStatusError},
+	VMStatusError:    {VMStatusStarting, VMStatusStopped},
+}
+
+// CanTransitionTo reports whether a VM in this status may move to next
+func (s VMStatus) CanTransitionTo(next VMStatus) bool {
+	for _, allowed := range validTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
 // VM represents a Firecracker microVM instance
 type VM struct {
-	ID         string     `json:"id"`
-	Name       string     `json:"name"`
-	Status     VMStatus   `json:"status"`
-	Config     VMConfig   `json:"config"`
-	Metrics    *VMMetrics `json:"metrics,omitempty"`
-	Error      string     `json:"error,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	StartedAt  *time.Time `json:"started_at,omitempty"`
-	StoppedAt  *time.Time `json:"stopped_at,omitempty"`
-	PID        int        `json:"pid,omitempty"`
-	SocketPath string     `json:"socket_path,omitempty"`
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	OwnerID    string            `json:"owner_id,omitempty"` // User the VM belongs to; unowned VMs are visible to admins only
+	Labels     map[string]string `json:"labels,omitempty"`
+	Status     VMStatus          `json:"status"`
+	Config     VMConfig          `json:"config"`
+	Metrics    *VMMetrics        `json:"metrics,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	StoppedAt  *time.Time        `json:"stopped_at,omitempty"`
+	PID        int               `json:"pid,omitempty"`
+	SocketPath string            `json:"socket_path,omitempty"`
+
+	// ExitCode is Firecracker's exit status the last time it exited, 128+N
+	// if it was killed by signal N. Unknown for VMs started by a previous daemon.
+	ExitCode     *int `json:"exit_code,omitempty"`
+	RestartCount int  `json:"restart_count,omitempty"` // Automatic restarts since the last manual start
+
+	Autostart bool `json:"autostart"`            // Start when the daemon boots
+	BootOrder int  `json:"boot_order,omitempty"` // Autostart VMs boot in ascending order
+}
+
+// ShutdownMethod tells how a VM was shut down
+type ShutdownMethod string
+
+const (
+	ShutdownGraceful ShutdownMethod = "graceful" // The guest powered off after Ctrl-Alt-Del
+	ShutdownForced   ShutdownMethod = "forced"   // Firecracker was stopped after the grace period
+)
+
+// RestartPolicyType decides when a VM is restarted after Firecracker exits
+type RestartPolicyType string
+
+const (
+	RestartNever     RestartPolicyType = "never"
+	RestartOnFailure RestartPolicyType = "on-failure" // Only after a non-zero exit
+	RestartAlways    RestartPolicyType = "always"     // Also after the guest shuts itself down
+)
+
+// RestartPolicy configures crash supervision. Restarts are delayed by an
+// exponential backoff; once MaxRetries restarts happened within the window
+// the VM is left in the error state.
+type RestartPolicy struct {
+	Policy           RestartPolicyType `json:"policy"`
+	MaxRetries       int               `json:"max_retries,omitempty"`        // 0 means no limit
+	WindowSeconds    int64             `json:"window_seconds,omitempty"`     // Default: 600
+	InitialBackoffMs int64             `json:"initial_backoff_ms,omitempty"` // Default: 1000
+	MaxBackoffMs     int64             `json:"max_backoff_ms,omitempty"`     // Default: 60000
 }
 
 // VMConfig holds the configuration for a VM
 type VMConfig struct {
-	Name              string        `json:"name"`
-	KernelPath        string        `json:"kernel_path"`
-	KernelOpts        string        `json:"kernel_opts"`
-	InitrdPath        string        `json:"initrd_path,omitempty"`
-	RootDrive         Drive         `json:"root_drive"`
-	AdditionalDrives  []Drive       `json:"additional_drives,omitempty"`
-	CPUs              int64         `json:"cpus"`
-	MemoryMB          int64         `json:"memory_mb"`
-	CPUTemplate       string        `json:"cpu_template,omitempty"`
-	DisableSMT        bool          `json:"disable_smt"`
-	NetworkInterfaces []NIC         `json:"network_interfaces,omitempty"`
-	VsockDevices      []Vsock       `json:"vsock_devices,omitempty"`
-	Metadata          string        `json:"metadata,omitempty"`
-	Jailer            *JailerConfig `json:"jailer,omitempty"`
-	LogLevel          string        `json:"log_level"`
+	Name              string         `json:"name"`
+	KernelPath        string         `json:"kernel_path"`
+	KernelOpts        string         `json:"kernel_opts"`
+	InitrdPath        string         `json:"initrd_path,omitempty"`
+	RootDrive         Drive          `json:"root_drive"`
+	AdditionalDrives  []Drive        `json:"additional_drives,omitempty"`
+	CPUs              int64          `json:"cpus"`
+	MemoryMB          int64          `json:"memory_mb"`
+	CPUTemplate       string         `json:"cpu_template,omitempty"`
+	DisableSMT        bool           `json:"disable_smt"`
+	NetworkInterfaces []NIC          `json:"network_interfaces,omitempty"`
+	VsockDevices      []Vsock        `json:"vsock_devices,omitempty"`
+	Metadata          string         `json:"metadata,omitempty"`
+	Jailer            *JailerConfig  `json:"jailer,omitempty"`
+	Balloon           *Balloon       `json:"balloon,omitempty"`
+	RestartPolicy     *RestartPolicy `json:"restart_policy,omitempty"`
+	LogLevel          string         `json:"log_level"`
+	TrackDirtyPages   bool           `json:"track_dirty_pages,omitempty"` // Required for diff snapshots
+
+	// Registered images used instead of KernelPath, InitrdPath and the root
+	// drive path. A writable root drive gets its own copy of the image when
+	// the VM is created, after which RootfsImageID is cleared.
+	KernelImageID string `json:"kernel_image_id,omitempty"`
+	InitrdImageID string `json:"initrd_image_id,omitempty"`
+	RootfsImageID string `json:"rootfs_image_id,omitempty"`
 }
 
 // Drive represents a block device
 type Drive struct {
-	ID       string `json:"id,omitempty"`
-	Path     string `json:"path"`
-	ReadOnly bool   `json:"read_only"`
-	IsRoot   bool   `json:"is_root,omitempty"`
-	PartUUID string `json:"part_uuid,omitempty"`
+	ID          string       `json:"id,omitempty"`
+	Path        string       `json:"path"`
+	ReadOnly    bool         `json:"read_only"`
+	IsRoot      bool         `json:"is_root,omitempty"`
+	PartUUID    string       `json:"part_uuid,omitempty"`
+	RateLimiter *RateLimiter `json:"rate_limiter,omitempty"`
 }
 
-// NIC represents a network interface configuration
+// NIC represents a network interface configuration. For managed NICs agni
+// creates the TAP device, attaches it to its bridge and assigns the guest an
+// address; Device, MacAddress, IPAddress and Gateway are filled in on start.
+// CNI NICs are set up by CNI plugins instead and report the same fields
+// while the VM runs.
 type NIC struct {
-	Device     string `json:"device"`
-	MacAddress string `json:"mac_address"`
-	AllowMMDS  bool   `json:"allow_mmds,omitempty"`
+	Device        string       `json:"device"`
+	MacAddress    string       `json:"mac_address"`
+	AllowMMDS     bool         `json:"allow_mmds,omitempty"`
+	Managed       bool         `json:"managed,omitempty"`
+	CNI           *CNIConfig   `json:"cni,omitempty"`
+	IPAddress     string       `json:"ip_address,omitempty"` // CIDR notation
+	Gateway       string       `json:"gateway,omitempty"`
+	RxRateLimiter *RateLimiter `json:"rx_rate_limiter,omitempty"`
+	TxRateLimiter *RateLimiter `json:"tx_rate_limiter,omitempty"`
+}
+
+// CNIConfig selects the CNI network a NIC is attached to. The network's
+// plugin chain must end in a plugin that hands a TAP device to the VM, such
+// as tc-redirect-tap.
+type CNIConfig struct {
+	NetworkName string   `json:"network_name"`
+	ConfDir     string   `json:"conf_dir,omitempty"` // Default: /etc/cni/conf.d
+	BinPath     []string `json:"bin_path,omitempty"` // Default: /opt/cni/bin
+	IfName      string   `json:"if_name,omitempty"`  // CNI_IFNAME inside the VM's network namespace
 }
 
-// Vsock represents a vsock device
+// IPAllocation records a guest address handed out from the managed pool
+type IPAllocation struct {
+	IP        string    `json:"ip"`
+	VMID      string    `json:"vm_id"`
+	Device    string    `json:"device"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RateLimiter throttles a device's bandwidth (bytes) and operations
+type RateLimiter struct {
+	Bandwidth *TokenBucket `json:"bandwidth,omitempty"`
+	Ops       *TokenBucket `json:"ops,omitempty"`
+}
+
+// TokenBucket holds Size tokens, refilled completely every RefillTimeMs.
+// OneTimeBurst tokens are available once on top of that.
+type TokenBucket struct {
+	Size         int64 `json:"size"`
+	RefillTimeMs int64 `json:"refill_time_ms"`
+	OneTimeBurst int64 `json:"one_time_burst,omitempty"`
+}
+
+// Vsock represents a vsock device. Path is assigned by agni inside the VM's
+// runtime directory.
 type Vsock struct {
 	Path string `json:"path"`
 	CID  uint32 `json:"cid"`
@@ -96,24 +209,82 @@ type JailerConfig struct {
 	Daemonize     bool   `json:"daemonize"`
 }
 
+// Balloon configures a memory balloon device. Inflating it to AmountMib hands
+// that much guest memory back to the host.
+type Balloon struct {
+	AmountMib             int64 `json:"amount_mib"`
+	DeflateOnOOM          bool  `json:"deflate_on_oom"`
+	StatsPollingIntervalS int64 `json:"stats_polling_interval_s,omitempty"` // 0 disables statistics
+}
+
+// BalloonStats holds the guest memory statistics reported by the balloon.
+// Memory figures are in bytes.
+type BalloonStats struct {
+	TargetMib       int64 `json:"target_mib"`
+	ActualMib       int64 `json:"actual_mib"`
+	TargetPages     int64 `json:"target_pages"`
+	ActualPages     int64 `json:"actual_pages"`
+	TotalMemory     int64 `json:"total_memory,omitempty"`
+	FreeMemory      int64 `json:"free_memory,omitempty"`
+	AvailableMemory int64 `json:"available_memory,omitempty"`
+	DiskCaches      int64 `json:"disk_caches,omitempty"`
+	SwapIn          int64 `json:"swap_in,omitempty"`
+	SwapOut         int64 `json:"swap_out,omitempty"`
+	MajorFaults     int64 `json:"major_faults,omitempty"`
+	MinorFaults     int64 `json:"minor_faults,omitempty"`
+}
+
 // VMMetrics holds runtime metrics for a VM
 type VMMetrics struct {
-	CPUUsage    float64   `json:"cpu_usage"`
-	MemoryUsed  int64     `json:"memory_used"`
-	MemoryTotal int64     `json:"memory_total"`
-	DiskRead    int64     `json:"disk_read_bytes"`
-	DiskWrite   int64     `json:"disk_write_bytes"`
-	NetRx       int64     `json:"net_rx_bytes"`
-	NetTx       int64     `json:"net_tx_bytes"`
-	Timestamp   time.Time `json:"timestamp"`
+	CPUUsage     float64   `json:"cpu_usage"`
+	MemoryUsed   int64     `json:"memory_used"`
+	MemoryTotal  int64     `json:"memory_total"`
+	DiskRead     int64     `json:"disk_read_bytes"`
+	DiskWrite    int64     `json:"disk_write_bytes"`
+	NetRx        int64     `json:"net_rx_bytes"`
+	NetTx        int64     `json:"net_tx_bytes"`
+	VCPUExits    int64     `json:"vcpu_exits"`
+	DeviceEvents int64     `json:"device_events"`
+	Timestamp    time.Time `json:"timestamp"`
 }
 
 // ConfigTemplate represents a saved VM configuration template
 type ConfigTemplate struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description,omitempty"`
-	Config      VMConfig  `json:"config"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          string            `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	OwnerID     string            `json:"owner_id,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Config      VMConfig          `json:"config"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// SnapshotType represents the kind of a VM snapshot
+type SnapshotType string
+
+const (
+	SnapshotTypeFull SnapshotType = "full"
+	SnapshotTypeDiff SnapshotType = "diff"
+)
+
+// Snapshot represents a persisted memory and device state snapshot of a VM
+type Snapshot struct {
+	ID            string          `json:"id"`
+	VMID          string          `json:"vm_id"`
+	Type          SnapshotType    `json:"type"`
+	MemFilePath   string          `json:"mem_file_path"`
+	StateFilePath string          `json:"state_file_path"`
+	ParentID      string          `json:"parent_id,omitempty"` // Previous snapshot a diff applies on top of
+	Drives        []SnapshotDrive `json:"drives,omitempty"`    // Drives are not part of the snapshot, only recorded
+	SizeBytes     int64           `json:"size_bytes"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// SnapshotDrive records a drive file as it was when a snapshot was taken. A
+// snapshot is only restored onto the same, unchanged drive.
+type SnapshotDrive struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
 }
@@ -0,0 +1,100 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package models
+
+import (
+	"time"
+)
+
+// Webhook is an endpoint that VM lifecycle events are POSTed to. Payloads
+// are signed with HMAC-SHA256 using the shared secret.
+type Webhook struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events,omitempty"` // Empty subscribes to every event
+	Secret    string      `json:"secret,omitempty"`
+	Enabled   bool        `json:"enabled"`
+	CreatedBy string      `json:"created_by,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+}
+
+// Redacted returns a copy of the webhook without its secret
+func (w *Webhook) Redacted() Webhook {
+	redacted := *w
+	redacted.Secret = ""
+	return redacted
+}
+
+// Wants reports whether the webhook is sent events of a type
+func (w *Webhook) Wants(eventType EventType) bool {
+	if !w.Enabled {
+		return false
+	}
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, t := range w.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateWebhookRequest represents a request to register a webhook. A secret
+// is generated when none is given and returned once.
+type CreateWebhookRequest struct {
+	Name    string      `json:"name"`
+	URL     string      `json:"url"`
+	Events  []EventType `json:"events,omitempty"`
+	Secret  string      `json:"secret,omitempty"`
+	Enabled *bool       `json:"enabled,omitempty"` // Defaults to true
+}
+
+// UpdateWebhookRequest represents a request to change a webhook. Only the
+// fields given are changed.
+type UpdateWebhookRequest struct {
+	Name    *string      `json:"name,omitempty"`
+	URL     *string      `json:"url,omitempty"`
+	Events  *[]EventType `json:"events,omitempty"`
+	Secret  *string      `json:"secret,omitempty"`
+	Enabled *bool        `json:"enabled,omitempty"`
+}
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery records sending one event to one webhook, including its
+// retries
+type WebhookDelivery struct {
+	ID            string         `json:"id"`
+	WebhookID     string         `json:"webhook_id"`
+	Event         Event          `json:"event"`
+	Status        DeliveryStatus `json:"status"`
+	Attempts      int            `json:"attempts"`
+	ResponseCode  int            `json:"response_code,omitempty"`
+	Error         string         `json:"error,omitempty"`
+	RedeliveryOf  string         `json:"redelivery_of,omitempty"`
+	NextAttemptAt *time.Time     `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}